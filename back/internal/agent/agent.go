@@ -0,0 +1,301 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"back/internal/collector"
+	models "back/internal/domain"
+)
+
+// Version is reported to the server with every push.
+const Version = "0.1.0"
+
+type Config struct {
+	ServerURL       string
+	Token           string // agent key issued by the server at enrollment
+	EnrollmentToken string // used to obtain an agent key when none is known
+	KeyFile         string // where the agent key is kept across restarts
+	SpoolDir        string // on-disk queue for samples not yet delivered, in memory when empty
+	Host            string
+	Interval        time.Duration
+	BatchSize       int // samples sent per request
+	MaxPending      int // samples kept while the server is unreachable
+}
+
+// ConfigFromEnv reads the agent configuration: MONITOVERSE_SERVER,
+// AGENT_TOKEN, AGENT_ENROLLMENT_TOKEN, AGENT_KEY_FILE, AGENT_SPOOL_DIR,
+// AGENT_SPOOL_MAX, MONITOVERSE_HOST and AGENT_INTERVAL_MS.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		ServerURL:       os.Getenv("MONITOVERSE_SERVER"),
+		Token:           os.Getenv("AGENT_TOKEN"),
+		EnrollmentToken: os.Getenv("AGENT_ENROLLMENT_TOKEN"),
+		KeyFile:         os.Getenv("AGENT_KEY_FILE"),
+		SpoolDir:        os.Getenv("AGENT_SPOOL_DIR"),
+		Host:            collector.Hostname(),
+		Interval:        time.Second,
+	}
+	if cfg.KeyFile == "" {
+		cfg.KeyFile = "monitoverse-agent.key"
+	}
+	if cfg.SpoolDir == "" {
+		cfg.SpoolDir = "monitoverse-agent-spool"
+	}
+	if n, err := strconv.Atoi(os.Getenv("AGENT_SPOOL_MAX")); err == nil && n > 0 {
+		cfg.MaxPending = n
+	}
+	if ms, err := strconv.Atoi(os.Getenv("AGENT_INTERVAL_MS")); err == nil && ms > 0 {
+		cfg.Interval = time.Duration(ms) * time.Millisecond
+	}
+	return cfg
+}
+
+func (c Config) validate() error {
+	if c.ServerURL == "" {
+		return fmt.Errorf("MONITOVERSE_SERVER is required in agent mode")
+	}
+	if c.Token == "" && c.EnrollmentToken == "" {
+		return fmt.Errorf("AGENT_TOKEN or AGENT_ENROLLMENT_TOKEN is required in agent mode")
+	}
+	return nil
+}
+
+// Agent collects the local metrics and pushes them to a Monitoverse server.
+type Agent struct {
+	cfg     Config
+	client  *http.Client
+	collect func() (models.MonitoringData, error)
+	pending queue
+}
+
+func New(cfg Config) (*Agent, error) {
+	if cfg.Token == "" && cfg.KeyFile != "" {
+		if key, err := os.ReadFile(cfg.KeyFile); err == nil {
+			cfg.Token = strings.TrimSpace(string(key))
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.MaxPending <= 0 {
+		// a day of samples at the default interval
+		cfg.MaxPending = 86400
+	}
+	cfg.ServerURL = strings.TrimRight(cfg.ServerURL, "/")
+
+	var pending queue = &memoryQueue{max: cfg.MaxPending}
+	if cfg.SpoolDir != "" {
+		spool, err := OpenSpool(cfg.SpoolDir, cfg.MaxPending)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spool: %w", err)
+		}
+		if spool.Len() > 0 {
+			log.Printf("agent: %d samples left in spool will be replayed", spool.Len())
+		}
+		pending = spool
+	}
+
+	return &Agent{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		collect: collector.Collect,
+		pending: pending,
+	}, nil
+}
+
+// Run collects and pushes samples every interval until ctx is cancelled.
+func (a *Agent) Run(ctx context.Context) error {
+	log.Printf("agent %s pushing to %s every %s", a.cfg.Host, a.cfg.ServerURL, a.cfg.Interval)
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			a.tick(ctx)
+		}
+	}
+}
+
+func (a *Agent) tick(ctx context.Context) {
+	data, err := a.collect()
+	if err != nil {
+		log.Println("agent: collect failed:", err)
+	} else {
+		data.Host = a.cfg.Host
+		if err := a.pending.Append(data); err != nil {
+			log.Println("agent: failed to queue sample:", err)
+		}
+	}
+
+	if a.cfg.Token == "" {
+		if err := a.enroll(ctx); err != nil {
+			log.Println("agent: enrollment failed:", err)
+			return
+		}
+	}
+
+	// Replay the queue oldest first; samples keep their original timestamps
+	// and the server drops the ones it already has.
+	for a.pending.Len() > 0 {
+		batch, err := a.pending.Peek(a.cfg.BatchSize)
+		if err != nil {
+			log.Println("agent: failed to read queue:", err)
+			return
+		}
+		if err := a.push(ctx, batch); err != nil {
+			var rejected *rejectedError
+			if !errors.As(err, &rejected) {
+				log.Printf("agent: push failed, %d samples queued: %v", a.pending.Len(), err)
+				return
+			}
+			// sending it again would fail the same way and hold back the
+			// samples queued after it
+			log.Printf("agent: dropping %d samples from %s to %s: %v", len(batch),
+				time.Unix(batch[0].Timestamp, 0).Format(time.RFC3339), time.Unix(batch[len(batch)-1].Timestamp, 0).Format(time.RFC3339), err)
+		}
+		if err := a.pending.Ack(len(batch)); err != nil {
+			log.Println("agent: failed to update queue:", err)
+			return
+		}
+	}
+}
+
+func (a *Agent) push(ctx context.Context, samples []models.MonitoringData) error {
+	body, err := json.Marshal(models.AgentSamples{
+		Host:         a.cfg.Host,
+		AgentVersion: Version,
+		Samples:      samples,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.ServerURL+"/agent/samples", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+
+	resp, err := a.do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode == http.StatusUnauthorized && a.cfg.EnrollmentToken != "" {
+		// The key was revoked or the host deleted: enroll again on next tick.
+		a.cfg.Token = ""
+	}
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("server answered %s", resp.Status)
+		if !retryable(resp.StatusCode) {
+			return &rejectedError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// rejectedError is a push the server refused for its content, which is
+// dropped rather than sent again.
+type rejectedError struct {
+	error
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.error
+}
+
+// retryable tells whether a push answered with status may succeed later:
+// server errors, throttling, and the authentication failures that hold for
+// every batch until the agent key is fixed or renewed.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return status < 400 || status >= 500
+}
+
+type enrollResponse struct {
+	AgentKey string `json:"agent_key"`
+}
+
+// enroll registers the host with the enrollment token and keeps the agent
+// key it receives, in memory and in the key file.
+func (a *Agent) enroll(ctx context.Context) error {
+	if a.cfg.EnrollmentToken == "" {
+		return fmt.Errorf("no agent key and no enrollment token")
+	}
+	info := collector.HostInfo()
+	info.Hostname = a.cfg.Host
+	info.AgentVersion = Version
+	body, err := json.Marshal(struct {
+		EnrollmentToken string `json:"enrollment_token"`
+		models.HostInfo
+	}{a.cfg.EnrollmentToken, info})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.ServerURL+"/agent/enroll", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := a.do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("host %s is already enrolled: restore its agent key or remove it from the inventory", a.cfg.Host)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("server answered %s", resp.Status)
+	}
+
+	var enrolled enrollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&enrolled); err != nil {
+		return err
+	}
+	if enrolled.AgentKey == "" {
+		return fmt.Errorf("server returned no agent key")
+	}
+	a.cfg.Token = enrolled.AgentKey
+	log.Printf("agent: enrolled %s", a.cfg.Host)
+
+	if a.cfg.KeyFile != "" {
+		if err := os.WriteFile(a.cfg.KeyFile, []byte(enrolled.AgentKey+"\n"), 0o600); err != nil {
+			log.Println("agent: failed to save agent key:", err)
+		}
+	}
+	return nil
+}
+
+func (a *Agent) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Content-Type", "application/json")
+	return a.client.Do(req)
+}
+
+func closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		log.Printf("agent: failed to close response body: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeServer struct {
+	mu       sync.Mutex
+	received []models.AgentSamples
+	fail     bool
+	reject   int // status answered once to the next push
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/agent/enroll" {
+		var req struct {
+			EnrollmentToken string `json:"enrollment_token"`
+			Hostname        string `json:"hostname"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.EnrollmentToken != "enroll" || req.Hostname == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"agent_key":"secret"}`))
+		return
+	}
+	if r.URL.Path != "/agent/samples" || r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if f.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if f.reject != 0 {
+		w.WriteHeader(f.reject)
+		f.reject = 0
+		return
+	}
+	var payload models.AgentSamples
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.received = append(f.received, payload)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newTestAgent(t *testing.T, url string) *Agent {
+	a, err := New(Config{ServerURL: url + "/", Token: "secret", Host: "web-1", BatchSize: 2})
+	require.NoError(t, err)
+	ts := int64(0)
+	a.collect = func() (models.MonitoringData, error) {
+		ts++
+		return models.MonitoringData{Timestamp: ts, CPU: float64(ts)}, nil
+	}
+	return a
+}
+
+func TestAgentPushesTaggedSamples(t *testing.T) {
+	server := &fakeServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	a.tick(context.Background())
+
+	require.Len(t, server.received, 1)
+	payload := server.received[0]
+	assert.Equal(t, "web-1", payload.Host)
+	assert.Equal(t, Version, payload.AgentVersion)
+	require.Len(t, payload.Samples, 1)
+	assert.Equal(t, "web-1", payload.Samples[0].Host)
+	assert.Equal(t, int64(1), payload.Samples[0].Timestamp)
+}
+
+func TestAgentKeepsSamplesWhileServerIsDown(t *testing.T) {
+	server := &fakeServer{fail: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	for i := 0; i < 3; i++ {
+		a.tick(context.Background())
+	}
+	assert.Equal(t, 3, a.pending.Len())
+
+	server.fail = false
+	a.tick(context.Background())
+	assert.Zero(t, a.pending.Len())
+
+	// 4 samples, batches of 2
+	require.Len(t, server.received, 2)
+	var timestamps []int64
+	for _, payload := range server.received {
+		for _, s := range payload.Samples {
+			timestamps = append(timestamps, s.Timestamp)
+		}
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4}, timestamps)
+}
+
+func TestAgentDropsRejectedBatches(t *testing.T) {
+	server := &fakeServer{fail: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	for i := 0; i < 3; i++ {
+		a.tick(context.Background())
+	}
+
+	// throttled: kept for the next tick
+	server.fail = false
+	server.reject = http.StatusTooManyRequests
+	a.tick(context.Background())
+	assert.Equal(t, 4, a.pending.Len())
+	assert.Empty(t, server.received)
+
+	// refused for its content: dropped, the samples behind it go through
+	server.reject = http.StatusUnprocessableEntity
+	a.tick(context.Background())
+	assert.Zero(t, a.pending.Len())
+	require.Len(t, server.received, 2)
+	assert.Equal(t, int64(3), server.received[0].Samples[0].Timestamp)
+}
+
+func TestRetryable(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusBadRequest: false, http.StatusRequestEntityTooLarge: false, http.StatusUnprocessableEntity: false,
+		http.StatusUnauthorized: true, http.StatusTooManyRequests: true, http.StatusInternalServerError: true, http.StatusBadGateway: true,
+	} {
+		assert.Equal(t, want, retryable(status), status)
+	}
+}
+
+func TestAgentSkipsFailedCollection(t *testing.T) {
+	server := &fakeServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	a := newTestAgent(t, ts.URL)
+	a.collect = func() (models.MonitoringData, error) {
+		return models.MonitoringData{}, errors.New("no /proc")
+	}
+	a.tick(context.Background())
+	assert.Empty(t, server.received)
+}
+
+func TestAgentEnrollsAndSavesKey(t *testing.T) {
+	server := &fakeServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "agent.key")
+	a, err := New(Config{ServerURL: ts.URL, EnrollmentToken: "enroll", KeyFile: keyFile, Host: "web-2"})
+	require.NoError(t, err)
+	a.collect = func() (models.MonitoringData, error) { return models.MonitoringData{Timestamp: 1}, nil }
+
+	a.tick(context.Background())
+	require.Len(t, server.received, 1)
+	assert.Equal(t, "web-2", server.received[0].Host)
+
+	saved, err := os.ReadFile(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "secret\n", string(saved))
+
+	// a restarted agent picks the key up from the file
+	restarted, err := New(Config{ServerURL: ts.URL, KeyFile: keyFile})
+	require.NoError(t, err)
+	assert.Equal(t, "secret", restarted.cfg.Token)
+}
+
+func TestNewRequiresServerAndToken(t *testing.T) {
+	_, err := New(Config{Token: "secret"})
+	assert.Error(t, err)
+	_, err = New(Config{ServerURL: "http://monitoverse:8081"})
+	assert.Error(t, err)
+}
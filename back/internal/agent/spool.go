@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	models "back/internal/domain"
+)
+
+// queue holds the samples not yet accepted by the server, oldest first.
+type queue interface {
+	Append(data models.MonitoringData) error
+	Peek(n int) ([]models.MonitoringData, error)
+	Ack(n int) error
+	Len() int
+}
+
+// memoryQueue is used when no spool directory is configured.
+type memoryQueue struct {
+	samples []models.MonitoringData
+	max     int
+}
+
+func (q *memoryQueue) Append(data models.MonitoringData) error {
+	q.samples = append(q.samples, data)
+	if len(q.samples) > q.max {
+		q.samples = q.samples[len(q.samples)-q.max:]
+	}
+	return nil
+}
+
+func (q *memoryQueue) Peek(n int) ([]models.MonitoringData, error) {
+	return q.samples[:min(n, len(q.samples))], nil
+}
+
+func (q *memoryQueue) Ack(n int) error {
+	q.samples = q.samples[min(n, len(q.samples)):]
+	return nil
+}
+
+func (q *memoryQueue) Len() int {
+	return len(q.samples)
+}
+
+const (
+	segmentExt  = ".jsonl"
+	cursorFile  = "cursor"
+	segmentSize = 1000 // samples per segment file
+)
+
+// Spool is a bounded on-disk queue of samples. Samples are appended as JSON
+// lines to numbered segment files; the cursor file records how many samples
+// of the oldest segment were already delivered. When the spool is full the
+// oldest samples are dropped by moving the cursor past them, which removes
+// the segments left empty.
+type Spool struct {
+	dir      string
+	max      int
+	segments []spoolSegment
+	cursor   int
+	dropped  int
+}
+
+type spoolSegment struct {
+	seq   int
+	count int
+}
+
+// OpenSpool opens (or creates) the spool in dir, keeping at most max samples.
+func OpenSpool(dir string, max int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, max: max}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		seq, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		count, err := countLines(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, spoolSegment{seq: seq, count: count})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	// A crash while appending can leave a partial line at the end of the
+	// last segment: cut it off.
+	if len(s.segments) > 0 {
+		last := &s.segments[len(s.segments)-1]
+		if err := truncatePartialLine(s.segmentPath(last.seq)); err != nil {
+			return nil, err
+		}
+		if last.count, err = countLines(s.segmentPath(last.seq)); err != nil {
+			return nil, err
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, cursorFile)); err == nil {
+		s.cursor, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	if len(s.segments) == 0 || s.cursor < 0 || s.cursor > s.segments[0].count {
+		s.cursor = 0
+	}
+	return s, nil
+}
+
+func (s *Spool) Len() int {
+	total := -s.cursor
+	for _, seg := range s.segments {
+		total += seg.count
+	}
+	return total
+}
+
+// Dropped returns how many samples were discarded because the spool was full.
+func (s *Spool) Dropped() int {
+	return s.dropped
+}
+
+func (s *Spool) Append(data models.MonitoringData) error {
+	line, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if len(s.segments) == 0 || s.segments[len(s.segments)-1].count >= segmentSize {
+		seq := 1
+		if len(s.segments) > 0 {
+			seq = s.segments[len(s.segments)-1].seq + 1
+		}
+		s.segments = append(s.segments, spoolSegment{seq: seq})
+	}
+	last := &s.segments[len(s.segments)-1]
+
+	f, err := os.OpenFile(s.segmentPath(last.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	last.count++
+
+	if excess := s.Len() - s.max; excess > 0 {
+		s.dropped += excess
+		return s.Ack(excess)
+	}
+	return nil
+}
+
+// Peek returns up to n samples from the head of the spool without removing them.
+func (s *Spool) Peek(n int) ([]models.MonitoringData, error) {
+	var result []models.MonitoringData
+	skip := s.cursor
+	for _, seg := range s.segments {
+		if len(result) >= n {
+			break
+		}
+		samples, err := s.readSegment(seg.seq, skip, n-len(result))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, samples...)
+		skip = 0
+	}
+	return result, nil
+}
+
+// Ack removes the first n samples, which the server accepted.
+func (s *Spool) Ack(n int) error {
+	s.cursor += n
+	for len(s.segments) > 0 && s.cursor >= s.segments[0].count {
+		if err := s.removeOldest(); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(s.dir, cursorFile), []byte(strconv.Itoa(s.cursor)), 0o600)
+}
+
+func (s *Spool) removeOldest() error {
+	oldest := s.segments[0]
+	if err := os.Remove(s.segmentPath(oldest.seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.segments = s.segments[1:]
+	s.cursor = max(s.cursor-oldest.count, 0)
+	return nil
+}
+
+func (s *Spool) segmentPath(seq int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%010d%s", seq, segmentExt))
+}
+
+func (s *Spool) readSegment(seq, skip, n int) ([]models.MonitoringData, error) {
+	f, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var samples []models.MonitoringData
+	scanner := bufio.NewScanner(f)
+	for i := 0; scanner.Scan() && len(samples) < n; i++ {
+		if i < skip {
+			continue
+		}
+		var data models.MonitoringData
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			return nil, fmt.Errorf("corrupted spool segment %d: %w", seq, err)
+		}
+		samples = append(samples, data)
+	}
+	return samples, scanner.Err()
+}
+
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
+
+func truncatePartialLine(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 || data[len(data)-1] == '\n' {
+		return err
+	}
+	return os.Truncate(path, int64(strings.LastIndexByte(string(data), '\n')+1))
+}
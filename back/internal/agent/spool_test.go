@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func timestamps(samples []models.MonitoringData) []int64 {
+	var ts []int64
+	for _, s := range samples {
+		ts = append(ts, s.Timestamp)
+	}
+	return ts
+}
+
+func TestSpoolKeepsOrderAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir, 10)
+	require.NoError(t, err)
+
+	for i := int64(1); i <= 5; i++ {
+		require.NoError(t, spool.Append(models.MonitoringData{Timestamp: i}))
+	}
+	batch, err := spool.Peek(2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, timestamps(batch))
+	require.NoError(t, spool.Ack(2))
+
+	reopened, err := OpenSpool(dir, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, reopened.Len())
+	batch, err = reopened.Peek(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4, 5}, timestamps(batch))
+
+	require.NoError(t, reopened.Ack(3))
+	assert.Zero(t, reopened.Len())
+	require.NoError(t, reopened.Append(models.MonitoringData{Timestamp: 6}))
+	batch, err = reopened.Peek(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{6}, timestamps(batch))
+}
+
+func TestSpoolDropsOldestSegmentsWhenFull(t *testing.T) {
+	spool, err := OpenSpool(t.TempDir(), segmentSize)
+	require.NoError(t, err)
+
+	total := 2*segmentSize + 10
+	for i := 1; i <= total; i++ {
+		require.NoError(t, spool.Append(models.MonitoringData{Timestamp: int64(i)}))
+	}
+	assert.LessOrEqual(t, spool.Len(), segmentSize)
+	assert.Equal(t, total, spool.Len()+spool.Dropped())
+
+	batch, err := spool.Peek(1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(spool.Dropped()+1), batch[0].Timestamp)
+}
+
+func TestSpoolBoundBelowSegmentSize(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir, 5)
+	require.NoError(t, err)
+
+	for i := int64(1); i <= 12; i++ {
+		require.NoError(t, spool.Append(models.MonitoringData{Timestamp: i}))
+	}
+	assert.Equal(t, 5, spool.Len())
+	assert.Equal(t, 7, spool.Dropped())
+	batch, err := spool.Peek(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{8, 9, 10, 11, 12}, timestamps(batch))
+
+	reopened, err := OpenSpool(dir, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, reopened.Len())
+}
+
+func TestSpoolIgnoresPartialLastLine(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenSpool(dir, 10)
+	require.NoError(t, err)
+	require.NoError(t, spool.Append(models.MonitoringData{Timestamp: 1}))
+
+	// simulate a crash in the middle of a write
+	f, err := os.OpenFile(spool.segmentPath(1), os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"timestamp":2,"cp`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := OpenSpool(dir, 10)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Append(models.MonitoringData{Timestamp: 3}))
+	batch, err := reopened.Peek(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, timestamps(batch))
+}
+
+func TestAgentReplaysSpoolAfterRestart(t *testing.T) {
+	server := &fakeServer{fail: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	spoolDir := filepath.Join(t.TempDir(), "spool")
+	cfg := Config{ServerURL: ts.URL, Token: "secret", Host: "web-1", SpoolDir: spoolDir, BatchSize: 2}
+	a, err := New(cfg)
+	require.NoError(t, err)
+	next := int64(0)
+	a.collect = func() (models.MonitoringData, error) {
+		next++
+		return models.MonitoringData{Timestamp: next}, nil
+	}
+	for i := 0; i < 3; i++ {
+		a.tick(context.Background())
+	}
+
+	// the agent restarts while the server is back
+	server.fail = false
+	restarted, err := New(cfg)
+	require.NoError(t, err)
+	restarted.collect = a.collect
+	restarted.tick(context.Background())
+
+	var received []int64
+	for _, payload := range server.received {
+		received = append(received, timestamps(payload.Samples)...)
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4}, received)
+	assert.Zero(t, restarted.pending.Len())
+}
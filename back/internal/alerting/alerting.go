@@ -0,0 +1,167 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrRuleExists = errors.New("rule already exists")
+
+// Sources of the points, rules can be restricted to one of them.
+const (
+	SourceCollector = "collector" // host samples of the built-in collectors
+	SourceSeries    = "series"    // application metrics (StatsD, plugins, logs, checks, remote_write)
+)
+
+// Point is a single metric observation fed to the rules.
+type Point struct {
+	Metric    string
+	Source    string
+	Host      string
+	Labels    map[string]string // application metrics only
+	Timestamp int64
+	Value     float64
+}
+
+// seriesKey identifies the series of p among the points of its metric,
+// the state of a rule being kept per series.
+func (p Point) seriesKey() string {
+	if len(p.Labels) == 0 {
+		return p.Host
+	}
+	names := make([]string, 0, len(p.Labels))
+	for name := range p.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(p.Host)
+	for _, name := range names {
+		fmt.Fprintf(&b, ",%s=%s", name, p.Labels[name])
+	}
+	return b.String()
+}
+
+// Alert is emitted when a rule's series goes from normal to firing.
+type Alert struct {
+	ID        int64              `json:"id"`
+	Rule      string             `json:"rule"`
+	Type      string             `json:"type"`
+	Metric    string             `json:"metric"`
+	Host      string             `json:"host,omitempty"`
+	Labels    map[string]string  `json:"labels,omitempty"`
+	Value     float64            `json:"value"`
+	Message   string             `json:"message"`
+	Details   map[string]float64 `json:"details,omitempty"`
+	Timestamp int64              `json:"timestamp"`
+}
+
+// Rule evaluates points of the metric it watches. Evaluate returns a non-nil
+// alert only when the series transitions into the firing state, so a rule
+// that stays broken does not flood the alert log.
+type Rule interface {
+	Name() string
+	Type() string
+	Matches(p Point) bool
+	Evaluate(p Point) *Alert
+	Config() RuleConfig
+}
+
+type Engine struct {
+	mu     sync.Mutex
+	rules  []Rule
+	alerts []Alert
+	nextID int64
+	limit  int
+}
+
+func NewEngine(limit int) *Engine {
+	return &Engine{limit: limit, nextID: 1}
+}
+
+func (e *Engine) AddRule(rule Rule) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.rules {
+		if r.Name() == rule.Name() {
+			return fmt.Errorf("%w: %s", ErrRuleExists, rule.Name())
+		}
+	}
+	e.rules = append(e.rules, rule)
+	return nil
+}
+
+func (e *Engine) RemoveRule(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, r := range e.rules {
+		if r.Name() == name {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) Rules() []RuleConfig {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	configs := make([]RuleConfig, 0, len(e.rules))
+	for _, r := range e.rules {
+		configs = append(configs, r.Config())
+	}
+	return configs
+}
+
+// Observe runs every matching rule against p and records the alerts fired.
+func (e *Engine) Observe(p Point) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var fired []Alert
+	for _, r := range e.rules {
+		if !r.Matches(p) {
+			continue
+		}
+		alert := r.Evaluate(p)
+		if alert == nil {
+			continue
+		}
+		alert.ID = e.nextID
+		e.nextID++
+		if alert.Timestamp == 0 {
+			alert.Timestamp = time.Now().Unix()
+		}
+		e.alerts = append(e.alerts, *alert)
+		fired = append(fired, *alert)
+	}
+	if e.limit > 0 && len(e.alerts) > e.limit {
+		e.alerts = e.alerts[len(e.alerts)-e.limit:]
+	}
+	return fired
+}
+
+// Alerts returns the recorded alerts with an ID greater than sinceID,
+// optionally restricted to a rule type and a host.
+func (e *Engine) Alerts(sinceID int64, ruleType, host string) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := []Alert{}
+	for _, a := range e.alerts {
+		if a.ID <= sinceID {
+			continue
+		}
+		if ruleType != "" && a.Type != ruleType {
+			continue
+		}
+		if host != "" && a.Host != host {
+			continue
+		}
+		result = append(result, a)
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package alerting
+
+import (
+	"testing"
+
+	"back/internal/anomaly"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdRuleFiresOnTransition(t *testing.T) {
+	engine := NewEngine(10)
+	rule, err := NewRule(RuleConfig{Name: "cpu-high", Type: TypeThreshold, Metric: "cpu", Operator: ">", Threshold: 90})
+	require.NoError(t, err)
+	require.NoError(t, engine.AddRule(rule))
+
+	assert.Empty(t, engine.Observe(Point{Metric: "cpu", Timestamp: 1, Value: 50}))
+	assert.Len(t, engine.Observe(Point{Metric: "cpu", Timestamp: 2, Value: 95}), 1)
+	// still firing, no new alert
+	assert.Empty(t, engine.Observe(Point{Metric: "cpu", Timestamp: 3, Value: 97}))
+	assert.Empty(t, engine.Observe(Point{Metric: "cpu", Timestamp: 4, Value: 10}))
+	assert.Len(t, engine.Observe(Point{Metric: "cpu", Timestamp: 5, Value: 99}), 1)
+	// other metrics are ignored
+	assert.Empty(t, engine.Observe(Point{Metric: "memory", Timestamp: 6, Value: 99}))
+
+	alerts := engine.Alerts(0, "", "")
+	require.Len(t, alerts, 2)
+	assert.Equal(t, int64(1), alerts[0].ID)
+	assert.Equal(t, int64(2), alerts[0].Timestamp)
+	assert.Len(t, engine.Alerts(1, "", ""), 1)
+}
+
+func TestAnomalyRuleTracksHostsSeparately(t *testing.T) {
+	engine := NewEngine(10)
+	rule, err := NewRule(RuleConfig{
+		Name:    "cpu-anomaly",
+		Type:    TypeAnomaly,
+		Metric:  "cpu",
+		Anomaly: &anomaly.Config{Window: 20, MinSamples: 10},
+	})
+	require.NoError(t, err)
+	require.NoError(t, engine.AddRule(rule))
+
+	for i := int64(0); i < 20; i++ {
+		engine.Observe(Point{Metric: "cpu", Host: "web-1", Timestamp: i, Value: 2})
+		engine.Observe(Point{Metric: "cpu", Host: "db-1", Timestamp: i, Value: 60})
+	}
+
+	assert.Empty(t, engine.Observe(Point{Metric: "cpu", Host: "db-1", Timestamp: 21, Value: 60}))
+	fired := engine.Observe(Point{Metric: "cpu", Host: "web-1", Timestamp: 21, Value: 40})
+	require.Len(t, fired, 1)
+	assert.Equal(t, TypeAnomaly, fired[0].Type)
+	assert.Equal(t, "web-1", fired[0].Host)
+	assert.InDelta(t, 2, fired[0].Details["expected"], 0.01)
+
+	assert.Len(t, engine.Alerts(0, TypeAnomaly, ""), 1)
+	assert.Empty(t, engine.Alerts(0, TypeAnomaly, "db-1"))
+	assert.Empty(t, engine.Alerts(0, TypeThreshold, ""))
+}
+
+func TestEngineRules(t *testing.T) {
+	engine := NewEngine(10)
+	rule, err := NewRule(RuleConfig{Name: "mem", Type: TypeAnomaly, Metric: "memory"})
+	require.NoError(t, err)
+	require.NoError(t, engine.AddRule(rule))
+	assert.ErrorIs(t, engine.AddRule(rule), ErrRuleExists)
+
+	rules := engine.Rules()
+	require.Len(t, rules, 1)
+	assert.Equal(t, anomaly.ModeRolling, rules[0].Anomaly.Mode)
+
+	assert.True(t, engine.RemoveRule("mem"))
+	assert.False(t, engine.RemoveRule("mem"))
+}
+
+func TestNewRuleValidation(t *testing.T) {
+	_, err := NewRule(RuleConfig{Name: "x", Type: "unknown", Metric: "cpu"})
+	assert.Error(t, err)
+	_, err = NewRule(RuleConfig{Name: "x", Type: TypeThreshold, Metric: "cpu", Operator: "=="})
+	assert.Error(t, err)
+	_, err = NewRule(RuleConfig{Name: "x", Type: TypeAnomaly, Metric: "cpu", Anomaly: &anomaly.Config{Mode: "bogus"}})
+	assert.Error(t, err)
+}
+
+func TestRulesTrackLabelledSeriesSeparately(t *testing.T) {
+	engine := NewEngine(10)
+	rule, err := NewRule(RuleConfig{Name: "slow", Type: TypeThreshold, Metric: "api.latency.p95", Operator: ">", Threshold: 500})
+	require.NoError(t, err)
+	require.NoError(t, engine.AddRule(rule))
+
+	a := map[string]string{"route": "/a"}
+	b := map[string]string{"route": "/b"}
+	assert.Len(t, engine.Observe(Point{Metric: "api.latency.p95", Host: "web-1", Labels: a, Timestamp: 1, Value: 800}), 1)
+	fired := engine.Observe(Point{Metric: "api.latency.p95", Host: "web-1", Labels: b, Timestamp: 1, Value: 900})
+	require.Len(t, fired, 1)
+	assert.Equal(t, b, fired[0].Labels)
+	assert.Empty(t, engine.Observe(Point{Metric: "api.latency.p95", Host: "web-1", Labels: a, Timestamp: 2, Value: 800}))
+}
+
+func TestRuleLabels(t *testing.T) {
+	rule, err := NewRule(RuleConfig{Name: "web-expires", Type: TypeThreshold, Metric: "check.tls_expiry_days", Labels: map[string]string{"check": "web"}, Operator: "<", Threshold: 7})
+	require.NoError(t, err)
+	assert.True(t, rule.Matches(Point{Metric: "check.tls_expiry_days", Labels: map[string]string{"check": "web", "type": "tls"}}))
+	assert.False(t, rule.Matches(Point{Metric: "check.tls_expiry_days", Labels: map[string]string{"check": "api"}}))
+	assert.False(t, rule.Matches(Point{Metric: "check.tls_expiry_days"}))
+}
+
+func TestRuleSourceRestrictsPoints(t *testing.T) {
+	engine := NewEngine(10)
+	rule, err := NewRule(RuleConfig{Name: "cpu-high", Type: TypeThreshold, Metric: "cpu", Source: SourceCollector, Operator: ">", Threshold: 90})
+	require.NoError(t, err)
+	require.NoError(t, engine.AddRule(rule))
+
+	// an application metric of the same name is not the host CPU
+	assert.Empty(t, engine.Observe(Point{Metric: "cpu", Source: SourceSeries, Timestamp: 1, Value: 95}))
+	assert.Len(t, engine.Observe(Point{Metric: "cpu", Source: SourceCollector, Timestamp: 2, Value: 95}), 1)
+
+	_, err = NewRule(RuleConfig{Name: "bad", Type: TypeThreshold, Metric: "cpu", Source: "moon", Operator: ">"})
+	assert.Error(t, err)
+}
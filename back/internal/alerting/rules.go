@@ -0,0 +1,160 @@
+package alerting
+
+import (
+	"fmt"
+
+	"back/internal/anomaly"
+)
+
+const (
+	TypeThreshold = "threshold"
+	TypeAnomaly   = "anomaly"
+)
+
+// RuleConfig is the JSON representation of a rule, used by the API.
+type RuleConfig struct {
+	Name   string            `json:"name" binding:"required"`
+	Type   string            `json:"type" binding:"required"`
+	Metric string            `json:"metric" binding:"required"`
+	Source string            `json:"source,omitempty"` // empty matches every source
+	Host   string            `json:"host,omitempty"`   // empty matches every host
+	Labels map[string]string `json:"labels,omitempty"` // the series must carry these labels
+
+	// threshold rules
+	Operator  string  `json:"operator,omitempty"` // ">", ">=", "<", "<="
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// anomaly rules
+	Anomaly *anomaly.Config `json:"anomaly,omitempty"`
+}
+
+// NewRule builds the rule described by cfg.
+func NewRule(cfg RuleConfig) (Rule, error) {
+	if cfg.Name == "" || cfg.Metric == "" {
+		return nil, fmt.Errorf("rule name and metric are required")
+	}
+	switch cfg.Source {
+	case "", SourceCollector, SourceSeries:
+	default:
+		return nil, fmt.Errorf("unknown source %q", cfg.Source)
+	}
+	switch cfg.Type {
+	case TypeThreshold:
+		switch cfg.Operator {
+		case ">", ">=", "<", "<=":
+		default:
+			return nil, fmt.Errorf("unsupported operator %q", cfg.Operator)
+		}
+		return &thresholdRule{cfg: cfg, firing: map[string]bool{}}, nil
+	case TypeAnomaly:
+		detectorCfg := anomaly.Config{}
+		if cfg.Anomaly != nil {
+			detectorCfg = *cfg.Anomaly
+		}
+		if err := detectorCfg.Validate(); err != nil {
+			return nil, err
+		}
+		// Store the effective settings so the API shows what is really used.
+		effective := anomaly.NewDetector(detectorCfg).Config()
+		cfg.Anomaly = &effective
+		return &anomalyRule{cfg: cfg, detectors: map[string]*anomaly.Detector{}, firing: map[string]bool{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", cfg.Type)
+	}
+}
+
+func matches(cfg RuleConfig, p Point) bool {
+	if p.Metric != cfg.Metric || (cfg.Host != "" && cfg.Host != p.Host) || (cfg.Source != "" && cfg.Source != p.Source) {
+		return false
+	}
+	for name, value := range cfg.Labels {
+		if p.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+type thresholdRule struct {
+	cfg    RuleConfig
+	firing map[string]bool // per series
+}
+
+func (r *thresholdRule) Name() string         { return r.cfg.Name }
+func (r *thresholdRule) Type() string         { return TypeThreshold }
+func (r *thresholdRule) Config() RuleConfig   { return r.cfg }
+func (r *thresholdRule) Matches(p Point) bool { return matches(r.cfg, p) }
+
+func (r *thresholdRule) Evaluate(p Point) *Alert {
+	var breached bool
+	switch r.cfg.Operator {
+	case ">":
+		breached = p.Value > r.cfg.Threshold
+	case ">=":
+		breached = p.Value >= r.cfg.Threshold
+	case "<":
+		breached = p.Value < r.cfg.Threshold
+	case "<=":
+		breached = p.Value <= r.cfg.Threshold
+	}
+
+	key := p.seriesKey()
+	wasFiring := r.firing[key]
+	r.firing[key] = breached
+	if !breached || wasFiring {
+		return nil
+	}
+	return &Alert{
+		Rule:      r.cfg.Name,
+		Type:      TypeThreshold,
+		Metric:    p.Metric,
+		Host:      p.Host,
+		Labels:    p.Labels,
+		Value:     p.Value,
+		Message:   fmt.Sprintf("%s is %.2f (%s %.2f)", p.Metric, p.Value, r.cfg.Operator, r.cfg.Threshold),
+		Timestamp: p.Timestamp,
+	}
+}
+
+type anomalyRule struct {
+	cfg       RuleConfig
+	detectors map[string]*anomaly.Detector // per series
+	firing    map[string]bool
+}
+
+func (r *anomalyRule) Name() string         { return r.cfg.Name }
+func (r *anomalyRule) Type() string         { return TypeAnomaly }
+func (r *anomalyRule) Config() RuleConfig   { return r.cfg }
+func (r *anomalyRule) Matches(p Point) bool { return matches(r.cfg, p) }
+
+func (r *anomalyRule) Evaluate(p Point) *Alert {
+	key := p.seriesKey()
+	detector, ok := r.detectors[key]
+	if !ok {
+		detector = anomaly.NewDetector(*r.cfg.Anomaly)
+		r.detectors[key] = detector
+	}
+	res := detector.Observe(p.Timestamp, p.Value)
+
+	wasFiring := r.firing[key]
+	r.firing[key] = res.Anomalous
+	if !res.Anomalous || wasFiring {
+		return nil
+	}
+	return &Alert{
+		Rule:   r.cfg.Name,
+		Type:   TypeAnomaly,
+		Metric: p.Metric,
+		Host:   p.Host,
+		Labels: p.Labels,
+		Value:  p.Value,
+		Message: fmt.Sprintf("%s is %.2f, expected %.2f ± %.2f (%s baseline)",
+			p.Metric, p.Value, res.Expected, res.StdDev, r.cfg.Anomaly.Mode),
+		Details: map[string]float64{
+			"expected": res.Expected,
+			"stddev":   res.StdDev,
+			"score":    res.Score,
+		},
+		Timestamp: p.Timestamp,
+	}
+}
@@ -0,0 +1,179 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// ModeRolling compares each value with the mean/stddev of the last N values.
+	ModeRolling = "rolling"
+	// ModeSeasonal compares each value with the baseline of the same hour of the week.
+	ModeSeasonal = "seasonal"
+
+	hoursPerWeek = 7 * 24
+)
+
+// Config tunes a Detector. Zero values are replaced by sensible defaults.
+type Config struct {
+	Mode       string  `json:"mode"`
+	Window     int     `json:"window"`      // rolling mode: number of samples in the baseline
+	Threshold  float64 `json:"threshold"`   // z-score above which a value is anomalous
+	MinSamples int     `json:"min_samples"` // samples needed in the baseline before flagging anything
+	MinStdDev  float64 `json:"min_stddev"`  // floor for the stddev so flat series do not flag tiny moves
+}
+
+func (c Config) withDefaults() Config {
+	if c.Mode == "" {
+		c.Mode = ModeRolling
+	}
+	if c.Window <= 0 {
+		c.Window = 300
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 4
+	}
+	if c.MinSamples <= 0 {
+		if c.Mode == ModeSeasonal {
+			c.MinSamples = 30
+		} else {
+			c.MinSamples = c.Window / 2
+		}
+	}
+	if c.MinStdDev <= 0 {
+		c.MinStdDev = 0.5
+	}
+	return c
+}
+
+// Validate reports whether the configuration can be used to build a Detector.
+func (c Config) Validate() error {
+	switch c.Mode {
+	case "", ModeRolling, ModeSeasonal:
+	default:
+		return fmt.Errorf("unknown anomaly mode %q", c.Mode)
+	}
+	if c.Window < 0 || c.MinSamples < 0 || c.Threshold < 0 || c.MinStdDev < 0 {
+		return fmt.Errorf("anomaly parameters must not be negative")
+	}
+	return nil
+}
+
+// Result is the outcome of scoring a single value against the baseline.
+type Result struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+	Expected  float64 `json:"expected"`
+	StdDev    float64 `json:"stddev"`
+	Score     float64 `json:"score"`
+	Anomalous bool    `json:"anomalous"`
+}
+
+// Detector scores a single metric stream. It is not safe for concurrent use.
+type Detector struct {
+	cfg Config
+
+	// rolling baseline
+	window []float64
+	next   int
+	sum    float64
+	sumSq  float64
+
+	// seasonal baseline, one accumulator per hour of the week
+	buckets [hoursPerWeek]welford
+}
+
+func NewDetector(cfg Config) *Detector {
+	cfg = cfg.withDefaults()
+	return &Detector{cfg: cfg}
+}
+
+func (d *Detector) Config() Config {
+	return d.cfg
+}
+
+// Observe scores value against the current baseline and then folds it into
+// the baseline. The value is only flagged once enough history was seen.
+func (d *Detector) Observe(timestamp int64, value float64) Result {
+	res := Result{Timestamp: timestamp, Value: value}
+
+	var mean, stddev float64
+	var n int
+	if d.cfg.Mode == ModeSeasonal {
+		b := &d.buckets[hourOfWeek(timestamp)]
+		mean, stddev, n = b.mean, b.stddev(), b.n
+	} else {
+		mean, stddev, n = d.rollingStats()
+	}
+
+	if n > 0 {
+		res.Expected = mean
+		res.StdDev = stddev
+		res.Score = math.Abs(value-mean) / math.Max(stddev, d.cfg.MinStdDev)
+		res.Anomalous = n >= d.cfg.MinSamples && res.Score >= d.cfg.Threshold
+	}
+
+	d.add(timestamp, value)
+	return res
+}
+
+func (d *Detector) add(timestamp int64, value float64) {
+	if d.cfg.Mode == ModeSeasonal {
+		d.buckets[hourOfWeek(timestamp)].add(value)
+		return
+	}
+	if len(d.window) < d.cfg.Window {
+		d.window = append(d.window, value)
+	} else {
+		old := d.window[d.next]
+		d.sum -= old
+		d.sumSq -= old * old
+		d.window[d.next] = value
+		d.next = (d.next + 1) % d.cfg.Window
+	}
+	d.sum += value
+	d.sumSq += value * value
+}
+
+func (d *Detector) rollingStats() (mean, stddev float64, n int) {
+	n = len(d.window)
+	if n == 0 {
+		return 0, 0, 0
+	}
+	mean = d.sum / float64(n)
+	variance := d.sumSq/float64(n) - mean*mean
+	if variance < 0 {
+		// rounding noise on flat series
+		variance = 0
+	}
+	return mean, math.Sqrt(variance), n
+}
+
+// hourOfWeek maps a unix timestamp to 0..167, Monday 00:00 UTC being 0.
+func hourOfWeek(timestamp int64) int {
+	t := time.Unix(timestamp, 0).UTC()
+	day := (int(t.Weekday()) + 6) % 7
+	return day*24 + t.Hour()
+}
+
+// welford keeps a running mean/variance without storing the values.
+type welford struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (w *welford) add(x float64) {
+	w.n++
+	delta := x - w.mean
+	w.mean += delta / float64(w.n)
+	w.m2 += delta * (x - w.mean)
+}
+
+func (w *welford) stddev() float64 {
+	if w.n < 2 {
+		return 0
+	}
+	return math.Sqrt(w.m2 / float64(w.n))
+}
@@ -0,0 +1,70 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollingDetectorFlagsSpike(t *testing.T) {
+	d := NewDetector(Config{Window: 60, Threshold: 4, MinSamples: 30})
+
+	ts := time.Date(2025, 1, 6, 3, 0, 0, 0, time.UTC).Unix()
+	for i := 0; i < 60; i++ {
+		res := d.Observe(ts+int64(i), 2+float64(i%3)*0.5)
+		assert.False(t, res.Anomalous)
+	}
+
+	res := d.Observe(ts+60, 40)
+	assert.True(t, res.Anomalous)
+	assert.InDelta(t, 2.5, res.Expected, 0.01)
+	assert.Greater(t, res.Score, 4.0)
+}
+
+func TestRollingDetectorWaitsForMinSamples(t *testing.T) {
+	d := NewDetector(Config{Window: 60, MinSamples: 30})
+
+	ts := time.Now().Unix()
+	for i := 0; i < 10; i++ {
+		d.Observe(ts+int64(i), 2)
+	}
+	assert.False(t, d.Observe(ts+10, 90).Anomalous)
+}
+
+func TestRollingDetectorMinStdDevOnFlatSeries(t *testing.T) {
+	d := NewDetector(Config{Window: 10, MinSamples: 5, Threshold: 4, MinStdDev: 1})
+
+	ts := time.Now().Unix()
+	for i := 0; i < 10; i++ {
+		d.Observe(ts+int64(i), 5)
+	}
+	// stddev is 0, the floor keeps a 1 point move from being flagged
+	assert.False(t, d.Observe(ts+10, 6).Anomalous)
+	assert.True(t, d.Observe(ts+11, 20).Anomalous)
+}
+
+func TestSeasonalDetectorUsesHourOfWeek(t *testing.T) {
+	d := NewDetector(Config{Mode: ModeSeasonal, MinSamples: 3, Threshold: 4})
+
+	// Four weeks where Monday 03:00 is quiet and Monday 14:00 is busy.
+	monday := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	for week := 0; week < 4; week++ {
+		base := monday.AddDate(0, 0, 7*week)
+		d.Observe(base.Add(3*time.Hour).Unix(), 2+float64(week%2))
+		d.Observe(base.Add(14*time.Hour).Unix(), 40+float64(week%2))
+	}
+
+	next := monday.AddDate(0, 0, 28)
+	assert.False(t, d.Observe(next.Add(14*time.Hour).Unix(), 41).Anomalous)
+	res := d.Observe(next.Add(3*time.Hour).Unix(), 40)
+	assert.True(t, res.Anomalous)
+	assert.InDelta(t, 2.5, res.Expected, 0.01)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{}.Validate())
+	assert.NoError(t, Config{Mode: ModeSeasonal}.Validate())
+	assert.Error(t, Config{Mode: "weekly"}.Validate())
+	assert.Error(t, Config{Window: -1}.Validate())
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	models "back/internal/domain"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds of a push of samples, rejected beyond with 413. Agents send 100
+// samples per request by default.
+const (
+	maxAgentSamples   = 1000
+	maxAgentBodyBytes = 4 << 20
+)
+
+type EnrollRequest struct {
+	EnrollmentToken string `json:"enrollment_token" binding:"required"`
+	models.HostInfo
+}
+
+func RegisterAgentRoutes(r *gin.Engine, hostService services.HostService) {
+	agent := r.Group("/agent")
+	{
+		agent.POST("/enroll", func(c *gin.Context) { EnrollAgent(c, hostService) })
+		agent.POST("/samples", func(c *gin.Context) { ReceiveAgentSamples(c, hostService) })
+		agent.POST("/write", func(c *gin.Context) { ReceiveRemoteWrite(c, hostService) })
+	}
+}
+
+// EnrollAgent registers a remote host with an enrollment token and hands
+// back the agent key it must use for every following request. An agent
+// re-enrolling a known hostname must also send its current agent key as a
+// bearer token.
+func EnrollAgent(c *gin.Context, hostService services.HostService) {
+	var req EnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	var currentKey string
+	if key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		currentKey = key
+	}
+	host, agentKey, err := hostService.Enroll(req.EnrollmentToken, currentKey, req.HostInfo)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidEnrollmentToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrHostAlreadyEnrolled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enroll host"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"host": host, "agent_key": agentKey})
+}
+
+// ReceiveAgentSamples stores the samples pushed by a remote agent, tagging
+// each of them with the host the agent key belongs to.
+func ReceiveAgentSamples(c *gin.Context, hostService services.HostService) {
+	host, ok := authenticateAgent(c, hostService)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAgentBodyBytes)
+	var req models.AgentSamples
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request too large", "details": fmt.Sprintf("at most %d bytes", maxAgentBodyBytes)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if len(req.Samples) > maxAgentSamples {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Too many samples", "details": fmt.Sprintf("at most %d samples per request", maxAgentSamples)})
+		return
+	}
+
+	if err := hostService.Heartbeat(host, req.AgentVersion); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update host"})
+		return
+	}
+
+	accepted := 0
+	for _, data := range req.Samples {
+		data.Host = host.Hostname
+		if _, ok := recordMonitoringData(data); ok {
+			accepted++
+		}
+	}
+	c.JSON(http.StatusAccepted, gin.H{"accepted": accepted, "duplicates": len(req.Samples) - accepted})
+}
+
+func authenticateAgent(c *gin.Context, hostService services.HostService) (*models.Host, bool) {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid Authorization header"})
+		return nil, false
+	}
+	host, err := hostService.Authenticate(strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid agent key"})
+		return nil, false
+	}
+	return host, true
+}
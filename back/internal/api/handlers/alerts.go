@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"back/internal/alerting"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var alertEngine = newAlertEngine()
+
+// alertRuleService stores the rules created through the API, which only
+// live in memory when nil.
+var alertRuleService services.AlertRuleService
+
+// StartAlertRules adds the stored rules to the engine and stores the new
+// ones through service.
+func StartAlertRules(service services.AlertRuleService) error {
+	alertRuleService = service
+	configs, err := service.List()
+	if err != nil {
+		return err
+	}
+	for _, cfg := range configs {
+		rule, err := alerting.NewRule(cfg)
+		if err == nil {
+			err = alertEngine.AddRule(rule)
+		}
+		if err != nil {
+			log.Printf("alert rule %s: %v", cfg.Name, err)
+		}
+	}
+	return nil
+}
+
+// newAlertEngine installs the default rules: anomaly detection on the CPU and
+// memory measured by the collectors, which catches what a static threshold
+// would miss, and failing synthetic checks.
+func newAlertEngine() *alerting.Engine {
+	engine := alerting.NewEngine(1000)
+	defaults := []alerting.RuleConfig{
+		{Name: "cpu-anomaly", Type: alerting.TypeAnomaly, Metric: "cpu", Source: alerting.SourceCollector},
+		{Name: "memory-anomaly", Type: alerting.TypeAnomaly, Metric: "memory", Source: alerting.SourceCollector},
+		{Name: "check-down", Type: alerting.TypeThreshold, Metric: "check.up", Operator: "<", Threshold: 1},
+	}
+	for _, cfg := range defaults {
+		rule, err := alerting.NewRule(cfg)
+		if err != nil {
+			panic(err)
+		}
+		if err := engine.AddRule(rule); err != nil {
+			panic(err)
+		}
+	}
+	return engine
+}
+
+func RegisterAlertRoutes(r *gin.RouterGroup) {
+	r.GET("/alerts", func(c *gin.Context) {
+		sinceID, _ := strconv.ParseInt(c.Query("since_id"), 10, 64)
+		c.JSON(http.StatusOK, alertEngine.Alerts(sinceID, c.Query("type"), c.Query("host")))
+	})
+
+	r.GET("/monitoring/anomalies", func(c *gin.Context) {
+		sinceID, _ := strconv.ParseInt(c.Query("since_id"), 10, 64)
+		c.JSON(http.StatusOK, alertEngine.Alerts(sinceID, alerting.TypeAnomaly, c.Query("host")))
+	})
+
+	rules := r.Group("/alerts/rules")
+	{
+		rules.GET("", func(c *gin.Context) {
+			c.JSON(http.StatusOK, alertEngine.Rules())
+		})
+		rules.POST("", CreateAlertRule)
+		rules.DELETE("/:name", func(c *gin.Context) {
+			if alertRuleService != nil {
+				if err := alertRuleService.Delete(c.Param("name")); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule", "details": err.Error()})
+					return
+				}
+			}
+			if !alertEngine.RemoveRule(c.Param("name")) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+				return
+			}
+			c.Status(http.StatusNoContent)
+		})
+	}
+}
+
+func CreateAlertRule(c *gin.Context) {
+	var req alerting.RuleConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	rule, err := alerting.NewRule(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Warm the rule up with the stored samples so an anomaly baseline does
+	// not start from scratch. Alerts raised during the replay are dropped.
+	for _, data := range getMonitoringHistory(allHosts) {
+		for _, p := range monitoringPoints(data) {
+			if rule.Matches(p) {
+				rule.Evaluate(p)
+			}
+		}
+	}
+	for _, p := range seriesPoints() {
+		if rule.Matches(p) {
+			rule.Evaluate(p)
+		}
+	}
+
+	if err := alertEngine.AddRule(rule); err != nil {
+		if errors.Is(err, alerting.ErrRuleExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if alertRuleService != nil {
+		if err := alertRuleService.Create(req); err != nil {
+			alertEngine.RemoveRule(req.Name)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store rule", "details": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusCreated, rule.Config())
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"back/internal/alerting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAlertRuleService struct {
+	rules   []alerting.RuleConfig
+	deleted []string
+}
+
+func (m *mockAlertRuleService) Create(cfg alerting.RuleConfig) error {
+	m.rules = append(m.rules, cfg)
+	return nil
+}
+func (m *mockAlertRuleService) Delete(name string) error {
+	m.deleted = append(m.deleted, name)
+	return nil
+}
+func (m *mockAlertRuleService) List() ([]alerting.RuleConfig, error) { return m.rules, nil }
+
+func hasAlertRule(name string) bool {
+	for _, cfg := range alertEngine.Rules() {
+		if cfg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAlertRulesStored(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterAlertRoutes(r.Group(""))
+
+	stored := alerting.RuleConfig{Name: "stored-queue-high", Type: alerting.TypeThreshold, Metric: "app.queue", Operator: ">", Threshold: 100}
+	service := &mockAlertRuleService{rules: []alerting.RuleConfig{stored}}
+	require.NoError(t, StartAlertRules(service))
+	defer func() { alertRuleService = nil }()
+	defer alertEngine.RemoveRule("stored-queue-high")
+	assert.True(t, hasAlertRule("stored-queue-high"), "restored on startup")
+
+	body, _ := json.Marshal(alerting.RuleConfig{Name: "new-queue-high", Type: alerting.TypeThreshold, Metric: "app.queue", Operator: ">", Threshold: 200})
+	req := httptest.NewRequest(http.MethodPost, "/alerts/rules", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, service.rules, 2)
+	assert.Equal(t, "new-queue-high", service.rules[1].Name)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/alerts/rules/new-queue-high", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"new-queue-high"}, service.deleted)
+	assert.False(t, hasAlertRule("new-queue-high"))
+}
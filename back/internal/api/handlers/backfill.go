@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"back/internal/collector"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SampleFrame is sent instead of the bare value on streams opened with a
+// backfill, so that the client can place replayed samples on its chart and
+// resume from the last ID it received after a reconnect.
+type SampleFrame struct {
+	ID        int64  `json:"id"`
+	Host      string `json:"host"`
+	Timestamp int64  `json:"timestamp"`
+	Value     any    `json:"value"`
+	Delta     bool   `json:"delta,omitempty"` // value is a difference, see codec.go
+}
+
+// backfillRequest selects the history sent before live updates: the Last
+// samples, or every sample after SinceID, or since the Since unix timestamp.
+type backfillRequest struct {
+	Last    int
+	SinceID int64
+	Since   int64
+}
+
+func (b backfillRequest) requested() bool {
+	return b.Last > 0 || b.SinceID > 0 || b.Since > 0
+}
+
+// parseBackfill reads the `backfill`, `since_id` and `since` query parameters.
+func parseBackfill(c *gin.Context) (backfillRequest, error) {
+	var b backfillRequest
+	var err error
+	if v := c.Query("backfill"); v != "" {
+		if b.Last, err = strconv.Atoi(v); err != nil || b.Last < 0 {
+			return b, errors.New("backfill must be a non-negative number of samples")
+		}
+	}
+	if v := c.Query("since_id"); v != "" {
+		if b.SinceID, err = strconv.ParseInt(v, 10, 64); err != nil || b.SinceID < 0 {
+			return b, errors.New("since_id must be a sample ID")
+		}
+	}
+	if v := c.Query("since"); v != "" {
+		if b.Since, err = strconv.ParseInt(v, 10, 64); err != nil || b.Since < 0 {
+			return b, errors.New("since must be a unix timestamp")
+		}
+	}
+	return b, nil
+}
+
+// cursor returns the sample ID after which the stream of host starts. With
+// no backfill the stream starts at the latest sample.
+func (b backfillRequest) cursor(host string) int64 {
+	monitoringMu.RLock()
+	defer monitoringMu.RUnlock()
+	history := monitoringHistory[host]
+	if len(history) == 0 {
+		return b.SinceID
+	}
+	latest := history[len(history)-1].ID
+
+	switch {
+	case b.SinceID > 0:
+		return b.SinceID
+	case b.Since > 0:
+		for _, data := range history {
+			if data.Timestamp >= b.Since {
+				return data.ID - 1
+			}
+		}
+		return latest
+	case b.Last > 0:
+		if b.Last >= len(history) {
+			return history[0].ID - 1
+		}
+		return history[len(history)-b.Last-1].ID
+	}
+	return latest - 1
+}
+
+// metricWebSocketHandler serves the WebSocket of a metric. Without backfill
+// parameters it is the plain stream of bare values of MakeWebSocketHandler;
+// with them the recorded history is replayed as SampleFrames, followed by
+// the samples recorded afterwards.
+func metricWebSocketHandler(source metricSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := queryTokenClaims(c); !ok {
+			return
+		}
+		backfill, err := parseBackfill(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backfill", "details": err.Error()})
+			return
+		}
+		if !backfill.requested() {
+			streamValues(c, source.interval, source.data)
+			return
+		}
+
+		interval := source.interval
+		if ms, err := strconv.Atoi(c.Query("interval_ms")); err == nil {
+			interval = clampInterval(ms)
+		}
+		host := c.DefaultQuery("host", collector.Hostname())
+		policy, err := parseSlowPolicy(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slow_policy", "details": err.Error()})
+			return
+		}
+
+		conn, err := monitoringUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Println("Erreur d'upgrade:", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		client := newWSClient(conn, policy)
+		defer client.Close()
+		go client.Discard()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		cursor := backfill.cursor(host)
+		for {
+			for _, data := range monitoringHistorySince(host, cursor) {
+				frame := SampleFrame{ID: data.ID, Host: data.Host, Timestamp: data.Timestamp, Value: source.project(data)}
+				if err := client.SendWait(frame); err != nil {
+					return
+				}
+				cursor = data.ID
+			}
+			select {
+			case <-ticker.C:
+			case <-client.Done():
+				return
+			}
+		}
+	}
+}
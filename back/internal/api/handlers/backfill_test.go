@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialMetric(t *testing.T, ts *httptest.Server, path string) *websocket.Conn {
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + path + "&token=" + createTestToken()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func readSampleFrames(t *testing.T, conn *websocket.Conn, n int) []SampleFrame {
+	frames := make([]SampleFrame, n)
+	for i := range frames {
+		require.NoError(t, conn.ReadJSON(&frames[i]))
+	}
+	return frames
+}
+
+func sampleValues(frames []SampleFrame) []any {
+	var values []any
+	for _, frame := range frames {
+		values = append(values, frame.Value)
+	}
+	return values
+}
+
+func TestBackfillCursor(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-backfill-cursor")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 100}, {Timestamp: 110}, {Timestamp: 120},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	history := getMonitoringHistory("test-backfill-cursor")
+	require.Len(t, history, 3)
+
+	cursor := func(b backfillRequest) int64 { return b.cursor("test-backfill-cursor") }
+	assert.Equal(t, history[1].ID, cursor(backfillRequest{}))
+	assert.Equal(t, history[0].ID, cursor(backfillRequest{Last: 2}))
+	assert.Equal(t, history[0].ID-1, cursor(backfillRequest{Last: 10}))
+	assert.Equal(t, history[0].ID, cursor(backfillRequest{SinceID: history[0].ID}))
+	assert.Equal(t, history[0].ID, cursor(backfillRequest{Since: 105}))
+	assert.Equal(t, history[2].ID, cursor(backfillRequest{Since: 200}))
+}
+
+func TestMetricWebSocketBackfill(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-backfill")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 100, CPU: 1}, {Timestamp: 110, CPU: 2}, {Timestamp: 120, CPU: 3},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	history := getMonitoringHistory("test-backfill")
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	conn := dialMetric(t, ts, "/monitoring/cpu?interval_ms=250&host=test-backfill&backfill=2")
+	frames := readSampleFrames(t, conn, 2)
+	assert.Equal(t, []any{2.0, 3.0}, sampleValues(frames))
+	assert.Equal(t, SampleFrame{ID: history[2].ID, Host: "test-backfill", Timestamp: 120, Value: 3.0}, frames[1])
+
+	// live samples follow the backfill
+	w = pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{{Timestamp: 130, CPU: 4}}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, []any{4.0}, sampleValues(readSampleFrames(t, conn, 1)))
+
+	// a reconnecting client resumes after the last ID it received
+	conn = dialMetric(t, ts, "/monitoring/cpu?interval_ms=250&host=test-backfill&since_id="+strconv.FormatInt(history[1].ID, 10))
+	assert.Equal(t, []any{3.0, 4.0}, sampleValues(readSampleFrames(t, conn, 2)))
+
+	conn = dialMetric(t, ts, "/monitoring/cpu?interval_ms=250&host=test-backfill&since=110")
+	assert.Equal(t, []any{2.0, 3.0, 4.0}, sampleValues(readSampleFrames(t, conn, 3)))
+
+	req := httptest.NewRequest(http.MethodGet, "/monitoring/cpu?backfill=abc&token="+createTestToken(), nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// parameters are only validated for authenticated callers
+	req = httptest.NewRequest(http.MethodGet, "/monitoring/cpu?backfill=abc", nil)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestMonitoringStreamBackfill(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-stream-backfill")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 1, Memory: 10}, {Timestamp: 2, Memory: 20},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	history := getMonitoringHistory("test-stream-backfill")
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	conn := dialStream(t, ts)
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "subscribe", ID: "mem", Metric: "memory", Host: "test-stream-backfill", IntervalMs: 250, Backfill: 5}))
+
+	first := readFrame(t, conn, "data", "mem")
+	assert.Equal(t, 10.0, first.Value)
+	assert.Equal(t, history[0].ID, first.SampleID)
+	assert.Equal(t, int64(1), first.Timestamp)
+	assert.Equal(t, history[1].ID, readFrame(t, conn, "data", "mem").SampleID)
+}
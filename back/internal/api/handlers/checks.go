@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"back/internal/alerting"
+	"back/internal/checks"
+	"back/internal/collector"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkResultLimit keeps a week of results of a check run every minute.
+const checkResultLimit = 7 * 24 * 60
+
+var checkManager = checks.NewManager(checkResultLimit, nil, recordCheckResult)
+
+// StartChecks runs the stored checks, with the alert rules of their lead
+// times, and stores the new ones through checkService.
+func StartChecks(checkService services.CheckService) error {
+	checkManager = checks.NewManager(checkResultLimit, checkService, recordCheckResult)
+	if err := checkManager.Restore(); err != nil {
+		return err
+	}
+	for _, status := range checkManager.List() {
+		if err := addCheckRules(status.Config); err != nil {
+			log.Printf("check %s: %v", status.Name, err)
+		}
+	}
+	return nil
+}
+
+// recordCheckResult stores the result as check.* series, where the
+// check-down rule watches check.up.
+func recordCheckResult(cfg checks.Config, res checks.Result) {
+	samples := res.Samples(cfg)
+	for i := range samples {
+		if samples[i].Host == "" {
+			samples[i].Host = collector.Hostname()
+		}
+	}
+	RecordSeries(samples)
+}
+
+// expiryRules are the alert rules of the lead times of a tls check, firing
+// when check.tls_expiry_days goes below each of them.
+func expiryRules(cfg checks.Config) []alerting.RuleConfig {
+	var rules []alerting.RuleConfig
+	for _, days := range cfg.LeadTimes() {
+		rules = append(rules, alerting.RuleConfig{
+			Name:      fmt.Sprintf("%s-expires-%dd", cfg.Name, days),
+			Type:      alerting.TypeThreshold,
+			Metric:    "check.tls_expiry_days",
+			Labels:    map[string]string{"check": cfg.Name},
+			Operator:  "<",
+			Threshold: float64(days),
+		})
+	}
+	return rules
+}
+
+// addCheckRules adds the expiry rules of a check, none of them on error.
+func addCheckRules(cfg checks.Config) error {
+	var added []string
+	for _, ruleCfg := range expiryRules(cfg) {
+		rule, err := alerting.NewRule(ruleCfg)
+		if err == nil {
+			err = alertEngine.AddRule(rule)
+		}
+		if err != nil {
+			for _, name := range added {
+				alertEngine.RemoveRule(name)
+			}
+			return err
+		}
+		added = append(added, ruleCfg.Name)
+	}
+	return nil
+}
+
+func removeCheckRules(cfg checks.Config) {
+	for _, rule := range expiryRules(cfg) {
+		alertEngine.RemoveRule(rule.Name)
+	}
+}
+
+func removeCheck(name string) error {
+	status, ok := checkManager.Status(name)
+	if !ok {
+		return checks.ErrCheckNotFound
+	}
+	if err := checkManager.Remove(name); err != nil {
+		return err
+	}
+	removeCheckRules(status.Config)
+	return nil
+}
+
+func RegisterCheckRoutes(r *gin.RouterGroup) {
+	group := r.Group("/checks")
+	{
+		group.GET("", func(c *gin.Context) {
+			c.JSON(http.StatusOK, checkManager.List())
+		})
+		group.POST("", CreateCheck)
+		group.GET("/:name", func(c *gin.Context) {
+			status, ok := checkManager.Status(c.Param("name"))
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Check not found"})
+				return
+			}
+			c.JSON(http.StatusOK, status)
+		})
+		group.GET("/:name/results", func(c *gin.Context) {
+			sinceID, _ := strconv.ParseInt(c.Query("since_id"), 10, 64)
+			results, ok := checkManager.Results(c.Param("name"), sinceID)
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Check not found"})
+				return
+			}
+			c.JSON(http.StatusOK, results)
+		})
+		group.DELETE("/:name", func(c *gin.Context) {
+			err := removeCheck(c.Param("name"))
+			if errors.Is(err, checks.ErrCheckNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Check not found"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete check", "details": err.Error()})
+				return
+			}
+			c.Status(http.StatusNoContent)
+		})
+	}
+}
+
+func CreateCheck(c *gin.Context) {
+	var req checks.Config
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The expiry rules go first, so that they see the first result.
+	if err := addCheckRules(req); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := checkManager.Add(req); err != nil {
+		removeCheckRules(req)
+		if errors.Is(err, checks.ErrCheckExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create check", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, req)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"back/internal/alerting"
+	"back/internal/checks"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createChecksTestServer() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterCheckRoutes(r.Group(""))
+	return r
+}
+
+func postCheck(r *gin.Engine, cfg checks.Config) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(cfg)
+	req := httptest.NewRequest(http.MethodPost, "/checks", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestChecksAPI(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer target.Close()
+	r := createChecksTestServer()
+
+	var lastAlert int64
+	if alerts := alertEngine.Alerts(0, "", ""); len(alerts) > 0 {
+		lastAlert = alerts[len(alerts)-1].ID
+	}
+
+	cfg := checks.Config{Name: "api-health", Type: checks.TypeHTTP, Target: target.URL + "/health"}
+	require.Equal(t, http.StatusCreated, postCheck(r, cfg).Code)
+	defer checkManager.Remove("api-health")
+	assert.Equal(t, http.StatusConflict, postCheck(r, cfg).Code)
+	assert.Equal(t, http.StatusBadRequest, postCheck(r, checks.Config{Name: "bad", Type: "icmp", Target: "x"}).Code)
+
+	// the failing first run fires the check-down rule
+	var alerts []alerting.Alert
+	require.Eventually(t, func() bool {
+		alerts = alertEngine.Alerts(lastAlert, alerting.TypeThreshold, "127.0.0.1")
+		return len(alerts) > 0
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "check-down", alerts[0].Rule)
+	assert.Equal(t, "api-health", alerts[0].Labels["check"])
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/checks/api-health", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var status checks.Status
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.NotNil(t, status.Last)
+	assert.Equal(t, http.StatusInternalServerError, status.Last.StatusCode)
+	assert.Equal(t, 0.0, status.Uptime["24h"])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/checks/api-health/results", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var results []checks.Result
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Len(t, results, 1)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/checks/api-health", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/checks/api-health/results", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTLSCheckLeadTimeRules(t *testing.T) {
+	t.Setenv("CHECKS_CERT_DIR", t.TempDir())
+	r := createChecksTestServer()
+	cfg := checks.Config{Name: "cert", Type: checks.TypeTLS, Target: "file://nonexistent.pem", IntervalMS: 3600000,
+		TLS: &checks.TLSConfig{LeadTimeDays: []int{21, 3}}}
+	require.Equal(t, http.StatusCreated, postCheck(r, cfg).Code)
+
+	var names []string
+	for _, rule := range alertEngine.Rules() {
+		if rule.Metric == "check.tls_expiry_days" {
+			names = append(names, rule.Name)
+			assert.Equal(t, map[string]string{"check": "cert"}, rule.Labels)
+		}
+	}
+	assert.Equal(t, []string{"cert-expires-21d", "cert-expires-3d"}, names)
+
+	// a second check of the same name leaves the rules alone
+	assert.Equal(t, http.StatusConflict, postCheck(r, cfg).Code)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/checks/cert", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	for _, rule := range alertEngine.Rules() {
+		assert.NotEqual(t, "check.tls_expiry_days", rule.Metric)
+	}
+}
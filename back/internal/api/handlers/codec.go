@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket subprotocols of the monitoring streams. Without one the frames
+// are JSON text, as before; clients opt into the compact encodings by
+// asking for them in Sec-WebSocket-Protocol.
+const (
+	subprotocolJSON         = "monitoverse.v1.json"
+	subprotocolMsgpack      = "monitoverse.v1.msgpack"
+	subprotocolMsgpackDelta = "monitoverse.v1.msgpack+delta"
+)
+
+// deltaKeyframeEvery is how often a delta stream sends the absolute value,
+// bounding the drift a client accumulates when summing float deltas.
+const deltaKeyframeEvery = 60
+
+// monitoringUpgrader is shared by the monitoring WebSockets. It negotiates
+// permessage-deflate and the frame encoding, in server preference order.
+var monitoringUpgrader = websocket.Upgrader{
+	CheckOrigin:       func(r *http.Request) bool { return true },
+	EnableCompression: true,
+	Subprotocols:      []string{subprotocolMsgpackDelta, subprotocolMsgpack, subprotocolJSON},
+}
+
+// DeltaFrame wraps the bare values of the per-metric sockets with the delta
+// encoding, which needs to tell deltas from absolute values.
+type DeltaFrame struct {
+	Value any  `json:"value"`
+	Delta bool `json:"delta,omitempty"`
+}
+
+// frameCodec encodes the frames of one connection. It runs in the writer
+// goroutine, after the slow-client policy, so a dropped frame never breaks
+// the chain of deltas.
+type frameCodec struct {
+	binary bool
+	delta  bool
+	last   map[string]any
+	count  map[string]int
+}
+
+func newFrameCodec(subprotocol string) *frameCodec {
+	switch subprotocol {
+	case subprotocolMsgpack:
+		return &frameCodec{binary: true}
+	case subprotocolMsgpackDelta:
+		return &frameCodec{binary: true, delta: true, last: map[string]any{}, count: map[string]int{}}
+	default:
+		return &frameCodec{}
+	}
+}
+
+func (f *frameCodec) encode(v any) (int, []byte, error) {
+	if f.delta {
+		v = f.applyDelta(v)
+	}
+	if !f.binary {
+		data, err := json.Marshal(v)
+		return websocket.TextMessage, data, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetOmitEmpty(true)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	err := enc.Encode(v)
+	return websocket.BinaryMessage, buf.Bytes(), err
+}
+
+// applyDelta replaces the value of a data frame by its difference with the
+// previous value of the same stream, keyed by subscription on /monitoring/stream.
+func (f *frameCodec) applyDelta(v any) any {
+	switch frame := v.(type) {
+	case StreamFrame:
+		if frame.Type == "subscribed" || frame.Type == "unsubscribed" {
+			delete(f.last, frame.ID)
+			delete(f.count, frame.ID)
+		}
+		if frame.Type != "data" {
+			return frame
+		}
+		frame.Value, frame.Delta = f.deltaOf(frame.ID, frame.Value)
+		return frame
+	case SampleFrame:
+		frame.Value, frame.Delta = f.deltaOf("", frame.Value)
+		return frame
+	default:
+		value, delta := f.deltaOf("", v)
+		return DeltaFrame{Value: value, Delta: delta}
+	}
+}
+
+func (f *frameCodec) deltaOf(key string, value any) (any, bool) {
+	prev, ok := f.last[key]
+	f.last[key] = value
+	n := f.count[key]
+	f.count[key] = n + 1
+	if !ok || n%deltaKeyframeEvery == 0 {
+		return value, false
+	}
+
+	switch current := value.(type) {
+	case float64:
+		if p, ok := prev.(float64); ok {
+			return current - p, true
+		}
+	case map[string]float64:
+		p, ok := prev.(map[string]float64)
+		if !ok || len(p) != len(current) {
+			return value, false
+		}
+		diff := make(map[string]float64, len(current))
+		for k, v := range current {
+			old, ok := p[k]
+			if !ok {
+				return value, false
+			}
+			diff[k] = v - old
+		}
+		return diff, true
+	}
+	return value, false
+}
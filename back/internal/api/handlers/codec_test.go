@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestFrameCodecDelta(t *testing.T) {
+	codec := newFrameCodec(subprotocolMsgpackDelta)
+
+	assert.Equal(t, DeltaFrame{Value: 10.0}, codec.applyDelta(10.0))
+	assert.Equal(t, DeltaFrame{Value: 2.5, Delta: true}, codec.applyDelta(12.5))
+
+	disk := newFrameCodec(subprotocolMsgpackDelta)
+	disk.applyDelta(map[string]float64{"/": 50, "/home": 60})
+	assert.Equal(t, DeltaFrame{Value: map[string]float64{"/": 1, "/home": 0}, Delta: true},
+		disk.applyDelta(map[string]float64{"/": 51, "/home": 60}))
+
+	// subscriptions of /monitoring/stream are keyed by ID, and restart on subscribe
+	frame := codec.applyDelta(StreamFrame{Type: "data", ID: "a", Value: 5.0}).(StreamFrame)
+	assert.False(t, frame.Delta)
+	frame = codec.applyDelta(StreamFrame{Type: "data", ID: "a", Value: 4.0}).(StreamFrame)
+	assert.Equal(t, -1.0, frame.Value)
+	assert.True(t, frame.Delta)
+	codec.applyDelta(StreamFrame{Type: "subscribed", ID: "a"})
+	frame = codec.applyDelta(StreamFrame{Type: "data", ID: "a", Value: 7.0}).(StreamFrame)
+	assert.Equal(t, 7.0, frame.Value)
+	assert.False(t, frame.Delta)
+
+	// a keyframe is sent periodically
+	codec = newFrameCodec(subprotocolMsgpackDelta)
+	keyframes := 0
+	for i := 0; i < 2*deltaKeyframeEvery; i++ {
+		if !codec.applyDelta(SampleFrame{Value: float64(i)}).(SampleFrame).Delta {
+			keyframes++
+		}
+	}
+	assert.Equal(t, 2, keyframes)
+}
+
+func TestMetricWebSocketMsgpackDelta(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-msgpack")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 1, CPU: 10}, {Timestamp: 2, CPU: 12.5}, {Timestamp: 3, CPU: 12},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocolMsgpackDelta}, EnableCompression: true}
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/monitoring/cpu?interval_ms=250&host=test-msgpack&backfill=3&token=" + createTestToken()
+	conn, resp, err := dialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	assert.Equal(t, subprotocolMsgpackDelta, conn.Subprotocol())
+	assert.Contains(t, resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var values []float64
+	var deltas []bool
+	for i := 0; i < 3; i++ {
+		messageType, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, websocket.BinaryMessage, messageType)
+		var frame struct {
+			Host  string  `msgpack:"host"`
+			Value float64 `msgpack:"value"`
+			Delta bool    `msgpack:"delta"`
+		}
+		require.NoError(t, msgpack.Unmarshal(data, &frame))
+		assert.Equal(t, "test-msgpack", frame.Host)
+		values = append(values, frame.Value)
+		deltas = append(deltas, frame.Delta)
+	}
+	assert.Equal(t, []float64{10, 2.5, -0.5}, values)
+	assert.Equal(t, []bool{false, true, true}, deltas)
+}
+
+func TestMetricWebSocketDefaultsToJSON(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-json")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{{Timestamp: 1, CPU: 10}}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	conn := dialMetric(t, ts, "/monitoring/cpu?interval_ms=250&host=test-json")
+	assert.Empty(t, conn.Subprotocol())
+	messageType, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, messageType)
+	assert.Equal(t, "10", string(data))
+}
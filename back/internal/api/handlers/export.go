@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"back/internal/collector"
+	models "back/internal/domain"
+	"back/internal/export"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery is how many rows are written between two flushes of the response.
+const exportFlushEvery = 500
+
+// RegisterExportRoutes registers the export of the monitoring history.
+func RegisterExportRoutes(r *gin.RouterGroup) {
+	r.GET("/monitoring/export", ExportMonitoring)
+}
+
+// ExportMonitoring streams the stored samples as CSV, NDJSON or Parquet.
+//
+// Query parameters: format (csv by default), host (local host by default, a
+// comma separated list or "all"), metrics (comma separated, all by default),
+// from and to (unix seconds, inclusive), step (seconds, no aggregation by
+// default) and agg (avg, min, max or last).
+func ExportMonitoring(c *gin.Context) {
+	format, err := export.ParseFormat(c.DefaultQuery("format", string(export.CSV)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format", "details": err.Error()})
+		return
+	}
+
+	metrics := map[string]bool{}
+	for _, p := range monitoringPoints(models.MonitoringData{}) {
+		metrics[p.Metric] = true
+	}
+	if list := c.Query("metrics"); list != "" {
+		selected := map[string]bool{}
+		for _, metric := range strings.Split(list, ",") {
+			if !metrics[metric] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid metrics", "details": fmt.Sprintf("unknown metric %q", metric)})
+				return
+			}
+			selected[metric] = true
+		}
+		metrics = selected
+	}
+
+	var from, to, step int64
+	for name, dst := range map[string]*int64{"from": &from, "to": &to, "step": &step} {
+		if v := c.Query(name); v != "" {
+			if *dst, err = strconv.ParseInt(v, 10, 64); err != nil || *dst < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name, "details": "must be a non-negative integer"})
+				return
+			}
+		}
+	}
+
+	agg := c.DefaultQuery("agg", export.AggAvg)
+	if !export.ValidAggregation(agg) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid agg", "details": fmt.Sprintf("unknown aggregation %q", agg)})
+		return
+	}
+
+	hosts := strings.Split(c.DefaultQuery("host", collector.Hostname()), ",")
+	if len(hosts) == 1 && hosts[0] == allHosts {
+		hosts = monitoredHosts()
+	}
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="monitoring-export.%s"`, format))
+	w, err := export.NewWriter(format, c.Writer)
+	if err == nil && step > 0 {
+		w, err = export.NewAggregatingWriter(w, step, agg)
+	}
+	if err != nil {
+		log.Println("Export interrompu:", err)
+		return
+	}
+
+	rows := 0
+	for _, host := range hosts {
+		for _, data := range getMonitoringHistory(host) {
+			if data.Timestamp < from || (to > 0 && data.Timestamp > to) {
+				continue
+			}
+			for _, p := range monitoringPoints(data) {
+				if !metrics[p.Metric] {
+					continue
+				}
+				if err := w.WriteRow(export.Row{Timestamp: p.Timestamp, Host: p.Host, Metric: p.Metric, Value: p.Value}); err != nil {
+					log.Println("Export interrompu:", err)
+					return
+				}
+				if rows++; rows%exportFlushEvery == 0 {
+					c.Writer.Flush()
+				}
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		log.Println("Export interrompu:", err)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	models "back/internal/domain"
+	"back/internal/export"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getExport(r http.Handler, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/monitoring/export?"+query, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestExportMonitoring(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	RegisterExportRoutes(&r.RouterGroup)
+	agentKey := enrollTestAgent(t, r, "test-export")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 60, CPU: 10, Memory: 40}, {Timestamp: 90, CPU: 20, Memory: 50}, {Timestamp: 120, CPU: 30, Memory: 60},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	w = getExport(r, "host=test-export&metrics=cpu&from=90")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "time,host,metric,value\n"+
+		"1970-01-01T00:01:30Z,test-export,cpu,20\n"+
+		"1970-01-01T00:02:00Z,test-export,cpu,30\n", w.Body.String())
+
+	w = getExport(r, "host=test-export&metrics=cpu,memory&to=119&step=60&agg=max&format=ndjson")
+	require.Equal(t, http.StatusOK, w.Code)
+	var rows []export.Row
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var row export.Row
+		require.NoError(t, json.Unmarshal([]byte(line), &row))
+		rows = append(rows, row)
+	}
+	assert.Equal(t, []export.Row{
+		{Timestamp: 60, Host: "test-export", Metric: "cpu", Value: 20},
+		{Timestamp: 60, Host: "test-export", Metric: "memory", Value: 50},
+	}, rows)
+
+	w = getExport(r, "host=test-export&format=parquet")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "PAR1"))
+	assert.True(t, strings.HasSuffix(w.Body.String(), "PAR1"))
+
+	for _, query := range []string{"format=xlsx", "metrics=load", "step=-1", "agg=median"} {
+		assert.Equal(t, http.StatusBadRequest, getExport(r, query).Code, query)
+	}
+}
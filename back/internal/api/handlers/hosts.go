@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EnrollmentTokenRequest struct {
+	Description string `json:"description"`
+	TTLHours    int    `json:"ttl_hours"` // 0 means the token never expires
+}
+
+type UpdateHostRequest struct {
+	Labels map[string]string `json:"labels"`
+}
+
+func RegisterHostRoutes(r *gin.RouterGroup, hostService services.HostService) {
+	hosts := r.Group("/hosts")
+	{
+		hosts.GET("", func(c *gin.Context) { GetHosts(c, hostService) })
+		hosts.GET("/:id", func(c *gin.Context) { GetHost(c, hostService) })
+		hosts.PUT("/:id", func(c *gin.Context) { UpdateHost(c, hostService) })
+		hosts.DELETE("/:id", func(c *gin.Context) { DeleteHost(c, hostService) })
+	}
+
+	// enrollment tokens register agents: administrators only
+	tokens := r.Group("/enrollment-tokens")
+	{
+		tokens.GET("", func(c *gin.Context) { GetEnrollmentTokens(c, hostService) })
+		tokens.POST("", func(c *gin.Context) { CreateEnrollmentToken(c, hostService) })
+		tokens.DELETE("/:id", func(c *gin.Context) { RevokeEnrollmentToken(c, hostService) })
+	}
+}
+
+func GetHosts(c *gin.Context, hostService services.HostService) {
+	hosts, err := hostService.GetAllHosts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list hosts"})
+		return
+	}
+	c.JSON(http.StatusOK, hosts)
+}
+
+func GetHost(c *gin.Context, hostService services.HostService) {
+	host, err := hostService.GetHostByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Host not found"})
+		return
+	}
+	c.JSON(http.StatusOK, host)
+}
+
+func UpdateHost(c *gin.Context, hostService services.HostService) {
+	var req UpdateHostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	host, err := hostService.UpdateHostLabels(c.Param("id"), req.Labels)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Host not found"})
+		return
+	}
+	c.JSON(http.StatusOK, host)
+}
+
+func DeleteHost(c *gin.Context, hostService services.HostService) {
+	host, err := hostService.DeleteHost(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Host not found"})
+		return
+	}
+	forgetMonitoringHost(host.Hostname)
+	c.Status(http.StatusNoContent)
+}
+
+func GetEnrollmentTokens(c *gin.Context, hostService services.HostService) {
+	if !requireAdmin(c) {
+		return
+	}
+	tokens, err := hostService.GetEnrollmentTokens()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list enrollment tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func CreateEnrollmentToken(c *gin.Context, hostService services.HostService) {
+	if !requireAdmin(c) {
+		return
+	}
+	var req EnrollmentTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if req.TTLHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl_hours must not be negative"})
+		return
+	}
+
+	plain, token, err := hostService.CreateEnrollmentToken(req.Description, time.Duration(req.TTLHours)*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create enrollment token"})
+		return
+	}
+
+	// The plain token is only returned once
+	c.JSON(http.StatusCreated, gin.H{"token": plain, "enrollment_token": token})
+}
+
+func RevokeEnrollmentToken(c *gin.Context, hostService services.HostService) {
+	if !requireAdmin(c) {
+		return
+	}
+	if err := hostService.RevokeEnrollmentToken(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Enrollment token not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
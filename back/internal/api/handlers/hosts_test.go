@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrollmentTokensAdminOnly(t *testing.T) {
+	t.Setenv("ADMIN_EMAILS", "admin@example.com")
+	server := func(email string) *gin.Engine {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		protected := r.Group("")
+		protected.Use(func(c *gin.Context) { c.Set("user_email", email) })
+		RegisterHostRoutes(protected, newMockHostService())
+		return r
+	}
+	do := func(r *gin.Engine, method, path, body string) int {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	user := server("test@example.com")
+	assert.Equal(t, http.StatusForbidden, do(user, http.MethodGet, "/enrollment-tokens", ""))
+	assert.Equal(t, http.StatusForbidden, do(user, http.MethodPost, "/enrollment-tokens", `{"description":"ci"}`))
+	assert.Equal(t, http.StatusForbidden, do(user, http.MethodDelete, "/enrollment-tokens/1", ""))
+
+	admin := server("admin@example.com")
+	assert.Equal(t, http.StatusOK, do(admin, http.MethodGet, "/enrollment-tokens", ""))
+	assert.Equal(t, http.StatusCreated, do(admin, http.MethodPost, "/enrollment-tokens", `{"description":"ci"}`))
+	assert.Equal(t, http.StatusNoContent, do(admin, http.MethodDelete, "/enrollment-tokens/1", ""))
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"back/internal/collector"
+	"back/internal/logs"
+	"back/internal/series"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type logMetric struct {
+	rule   logs.MetricRule
+	cancel context.CancelFunc
+}
+
+// logMetrics are keyed by metric name.
+var logMetrics = map[string]*logMetric{}
+var logMetricsMu sync.Mutex
+
+// logMetricService stores the rules, which only live in memory when nil.
+var logMetricService services.LogMetricService
+
+// StartLogMetrics counts the stored rules and stores the new ones through
+// service. It is called once the log sources are tailed; a rule whose
+// source is gone is kept but not counted.
+func StartLogMetrics(service services.LogMetricService) error {
+	logMetricsMu.Lock()
+	defer logMetricsMu.Unlock()
+	logMetricService = service
+	rules, err := service.List()
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if _, ok := logMetrics[rule.Metric]; ok {
+			continue
+		}
+		if err := startLogMetric(rule); err != nil {
+			log.Printf("log metric %s: %v", rule.Metric, err)
+			// listed, so that it can be deleted
+			logMetrics[rule.Metric] = &logMetric{rule: rule, cancel: func() {}}
+		}
+	}
+	return nil
+}
+
+// startLogMetric counts the lines of a rule, logMetricsMu being held.
+func startLogMetric(rule logs.MetricRule) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := logHub.Count(ctx, rule, func(count int, at time.Time) {
+		RecordSeries([]series.Sample{{
+			Metric:    rule.Metric,
+			Host:      collector.Hostname(),
+			Labels:    map[string]string{"source": rule.Source},
+			Timestamp: at.Unix(),
+			Value:     float64(count),
+		}})
+	})
+	if err != nil {
+		cancel()
+		return err
+	}
+	logMetrics[rule.Metric] = &logMetric{rule: rule, cancel: cancel}
+	return nil
+}
+
+// RegisterLogMetricRoutes manages the rules turning log lines into series:
+// the count of matching lines per interval, recorded like any application
+// metric and labeled with the log source, so that charts and alert rules
+// can use it.
+func RegisterLogMetricRoutes(r *gin.RouterGroup) {
+	rules := r.Group("/logs/metrics")
+	{
+		rules.GET("", func(c *gin.Context) {
+			logMetricsMu.Lock()
+			defer logMetricsMu.Unlock()
+			list := make([]logs.MetricRule, 0, len(logMetrics))
+			for _, m := range logMetrics {
+				list = append(list, m.rule)
+			}
+			sort.Slice(list, func(i, j int) bool { return list[i].Metric < list[j].Metric })
+			c.JSON(http.StatusOK, list)
+		})
+		rules.POST("", CreateLogMetric)
+		rules.DELETE("/:metric", func(c *gin.Context) {
+			logMetricsMu.Lock()
+			defer logMetricsMu.Unlock()
+			m, ok := logMetrics[c.Param("metric")]
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Log metric not found"})
+				return
+			}
+			if logMetricService != nil {
+				if err := logMetricService.Delete(m.rule.Metric); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete log metric", "details": err.Error()})
+					return
+				}
+			}
+			m.cancel()
+			delete(logMetrics, c.Param("metric"))
+			c.Status(http.StatusNoContent)
+		})
+	}
+}
+
+func CreateLogMetric(c *gin.Context) {
+	var rule logs.MetricRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logMetricsMu.Lock()
+	defer logMetricsMu.Unlock()
+	if _, ok := logMetrics[rule.Metric]; ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "Log metric already exists"})
+		return
+	}
+	if err := startLogMetric(rule); err != nil {
+		if errors.Is(err, logs.ErrUnknownSource) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Log source not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if logMetricService != nil {
+		if err := logMetricService.Create(rule); err != nil {
+			logMetrics[rule.Metric].cancel()
+			delete(logMetrics, rule.Metric)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store log metric", "details": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusCreated, rule)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"back/internal/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	logHistoryLimit = 1000 // lines kept per source
+	logDefaultLines = 100
+	logPollInterval = time.Second
+)
+
+var logHub = logs.NewHub(nil, logHistoryLimit, logPollInterval)
+
+// StartLogTailing tails the log sources in the background.
+func StartLogTailing(sources []logs.Source) {
+	logHub = logs.NewHub(sources, logHistoryLimit, logPollInterval)
+	go logHub.Run(context.Background())
+}
+
+// RegisterLogRoutes exposes the log sources. Like the terminal, every
+// route takes the JWT as `?token=`, and is for administrators only: the
+// logs hold whatever the server and its applications wrote.
+func RegisterLogRoutes(r *gin.Engine) {
+	r.GET("/logs/sources", func(c *gin.Context) {
+		if !requireLogAdmin(c) {
+			return
+		}
+		c.JSON(http.StatusOK, logHub.Sources())
+	})
+	r.GET("/logs/:source/lines", GetLogLines)
+	r.GET("/logs/:source/stream", StreamLogs)
+}
+
+// requireLogAdmin authenticates the `?token=` of a log route and lets
+// administrators only through.
+func requireLogAdmin(c *gin.Context) bool {
+	claims, ok := queryTokenClaims(c)
+	if !ok {
+		return false
+	}
+	c.Set("user_email", claims.Email)
+	return requireAdmin(c)
+}
+
+// parseLogFilter reads the `q` (substring) and `regex` query parameters.
+func parseLogFilter(c *gin.Context) (logs.Filter, bool) {
+	f := logs.Filter{Contains: c.Query("q")}
+	if expr := c.Query("regex"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid regex", "details": err.Error()})
+			return f, false
+		}
+		f.Regex = re
+	}
+	return f, true
+}
+
+func logSourceError(c *gin.Context, err error) {
+	if errors.Is(err, logs.ErrUnknownSource) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Log source not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// GetLogLines returns the last `n` lines of a source matching the filter.
+func GetLogLines(c *gin.Context) {
+	if !requireLogAdmin(c) {
+		return
+	}
+	n := logDefaultLines
+	if v := c.Query("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid n", "details": "must be a positive integer"})
+			return
+		}
+	}
+	filter, ok := parseLogFilter(c)
+	if !ok {
+		return
+	}
+	lines, err := logHub.Last(c.Param("source"), min(n, logHistoryLimit), filter)
+	if err != nil {
+		logSourceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lines)
+}
+
+// StreamLogs sends the new lines of a source matching the filter over a
+// WebSocket, after the last `backfill` ones.
+func StreamLogs(c *gin.Context) {
+	if !requireLogAdmin(c) {
+		return
+	}
+	filter, ok := parseLogFilter(c)
+	if !ok {
+		return
+	}
+	backfill, err := strconv.Atoi(c.DefaultQuery("backfill", "0"))
+	if err != nil || backfill < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backfill", "details": "must be a non-negative integer"})
+		return
+	}
+	policy, err := parseSlowPolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slow_policy", "details": err.Error()})
+		return
+	}
+
+	// subscribe before reading the backfill so that no line falls in between
+	sub, err := logHub.Subscribe(c.Param("source"), wsQueueSize)
+	if err != nil {
+		logSourceError(c, err)
+		return
+	}
+	defer sub.Close()
+
+	conn, err := monitoringUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Println("Erreur d'upgrade:", err)
+		return
+	}
+	client := newWSClient(conn, policy)
+	defer client.Close()
+	go client.Discard()
+
+	var lastID int64
+	if backfill > 0 {
+		lines, _ := logHub.Last(c.Param("source"), min(backfill, logHistoryLimit), filter)
+		for _, line := range lines {
+			if err := client.SendWait(line); err != nil {
+				return
+			}
+			lastID = line.ID
+		}
+	}
+
+	for {
+		select {
+		case line := <-sub.C:
+			if line.ID <= lastID || !filter.Match(line.Text) {
+				continue
+			}
+			if err := client.Send(line); err != nil {
+				return
+			}
+		case <-client.Done():
+			return
+		}
+	}
+}
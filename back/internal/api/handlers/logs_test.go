@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"back/internal/logs"
+	"back/internal/series"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestLogHub tails a fresh app.log, polled every 10ms, the test
+// token being the one of an administrator.
+func startTestLogHub(t *testing.T) string {
+	t.Setenv("ADMIN_EMAILS", "test@example.com")
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("GET /health 200\nPOST /login 401\nGET /api 500\n"), 0o644))
+
+	previous := logHub
+	ctx, cancel := context.WithCancel(context.Background())
+	logHub = logs.NewHub([]logs.Source{{Name: "app", Pattern: path}}, 100, 10*time.Millisecond)
+	go logHub.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		logHub = previous
+	})
+	require.Eventually(t, func() bool {
+		lines, _ := logHub.Last("app", 10, logs.Filter{})
+		return len(lines) == 3
+	}, time.Second, 10*time.Millisecond)
+	return path
+}
+
+func createLogsTestServer() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterLogRoutes(r)
+	return r
+}
+
+func getLogLines(r *gin.Engine, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs/app/lines?token="+createTestToken()+query, nil))
+	return w
+}
+
+func TestLogLines(t *testing.T) {
+	startTestLogHub(t)
+	r := createLogsTestServer()
+
+	w := getLogLines(r, "&n=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	var lines []logs.Line
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &lines))
+	require.Len(t, lines, 2)
+	assert.Equal(t, "POST /login 401", lines[0].Text)
+
+	w = getLogLines(r, "&q=GET&regex=%20[45]\\d\\d$")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &lines))
+	require.Len(t, lines, 1)
+	assert.Equal(t, "GET /api 500", lines[0].Text)
+
+	assert.Equal(t, http.StatusBadRequest, getLogLines(r, "&regex=(").Code)
+	assert.Equal(t, http.StatusBadRequest, getLogLines(r, "&n=-1").Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs/app/lines", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs/nginx/lines?token="+createTestToken(), nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs/sources?token="+createTestToken(), nil))
+	var sources []logs.SourceInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sources))
+	require.Len(t, sources, 1)
+	assert.Len(t, sources[0].Files, 1)
+}
+
+func TestLogRoutesAdminOnly(t *testing.T) {
+	startTestLogHub(t)
+	t.Setenv("ADMIN_EMAILS", "admin@example.com")
+	r := createLogsTestServer()
+
+	for _, path := range []string{"/logs/sources", "/logs/app/lines", "/logs/app/stream"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?token="+createTestToken(), nil))
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+	}
+}
+
+func TestLogStream(t *testing.T) {
+	path := startTestLogHub(t)
+	ts := httptest.NewServer(createLogsTestServer())
+	defer ts.Close()
+
+	conn := dialMetric(t, ts, "/logs/app/stream?backfill=5&regex=%20[45]\\d\\d$")
+	var line logs.Line
+	require.NoError(t, conn.ReadJSON(&line))
+	assert.Equal(t, "POST /login 401", line.Text)
+	require.NoError(t, conn.ReadJSON(&line))
+	assert.Equal(t, "GET /api 500", line.Text)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString("GET /health 200\nGET /orders 503\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, conn.ReadJSON(&line))
+	assert.Equal(t, "GET /orders 503", line.Text)
+	assert.Equal(t, path, line.File)
+}
+
+func TestLogMetrics(t *testing.T) {
+	path := startTestLogHub(t)
+	r := createLogsTestServer()
+	RegisterLogMetricRoutes(r.Group(""))
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/logs/metrics", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	require.Equal(t, http.StatusCreated, post(`{"metric": "log.app.server_errors", "source": "app", "regex": " 5\\d\\d$", "interval_ms": 1000}`))
+	defer func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/logs/metrics/log.app.server_errors", nil))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	}()
+	assert.Equal(t, http.StatusConflict, post(`{"metric": "log.app.server_errors", "source": "app", "regex": "x"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"metric": "log.m", "source": "nginx", "regex": "x"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"metric": "log.m", "source": "app", "regex": "("}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"metric": "cpu", "source": "app", "regex": "x"}`))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString("GET /a 502\nGET /b 200\nGET /c 500\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	filter := series.Filter{Metric: "log.app.server_errors", Labels: map[string]string{"source": "app"}}
+	require.Eventually(t, func() bool {
+		for _, ser := range metricSeries.Query(filter, 0, 0) {
+			for _, p := range ser.Points {
+				if p.Value == 2 {
+					return true
+				}
+			}
+		}
+		return false
+	}, 3*time.Second, 20*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs/metrics", nil))
+	var rules []logs.MetricRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rules))
+	assert.Equal(t, []logs.MetricRule{{Metric: "log.app.server_errors", Source: "app", Regex: " 5\\d\\d$", IntervalMS: 1000}}, rules)
+}
+
+type mockLogMetricService struct {
+	rules   []logs.MetricRule
+	deleted []string
+}
+
+func (m *mockLogMetricService) Create(rule logs.MetricRule) error {
+	m.rules = append(m.rules, rule)
+	return nil
+}
+func (m *mockLogMetricService) Delete(metric string) error {
+	m.deleted = append(m.deleted, metric)
+	return nil
+}
+func (m *mockLogMetricService) List() ([]logs.MetricRule, error) { return m.rules, nil }
+
+func TestLogMetricsRestored(t *testing.T) {
+	startTestLogHub(t)
+	r := createLogsTestServer()
+	RegisterLogMetricRoutes(r.Group(""))
+
+	service := &mockLogMetricService{rules: []logs.MetricRule{
+		{Metric: "log.app.errors", Source: "app", Regex: "ERROR"},
+		{Metric: "log.gone.errors", Source: "gone", Regex: "ERROR"},
+	}}
+	require.NoError(t, StartLogMetrics(service))
+	defer func() { logMetricService = nil }()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs/metrics", nil))
+	var rules []logs.MetricRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rules))
+	assert.Equal(t, service.rules, rules, "a rule of a missing source is listed too")
+
+	req := httptest.NewRequest(http.MethodPost, "/logs/metrics", strings.NewReader(`{"metric": "log.app.warnings", "source": "app", "regex": "WARN"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Len(t, service.rules, 3)
+
+	for _, metric := range []string{"log.app.errors", "log.gone.errors", "log.app.warnings"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/logs/metrics/"+metric, nil))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	}
+	assert.Equal(t, []string{"log.app.errors", "log.gone.errors", "log.app.warnings"}, service.deleted)
+}
@@ -1,342 +1,332 @@
 package handlers
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"sort"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
+	"back/internal/alerting"
 	authutil "back/internal/authutil"
+	"back/internal/collector"
+	models "back/internal/domain"
 	"back/internal/services"
 
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
-	"golang.org/x/sys/unix"
 )
 
-// MonitoringData holds a snapshot of all metrics at a point in time
-type MonitoringData struct {
-	ID        int64   `json:"id"`
-	Timestamp int64   `json:"timestamp"`
-	CPU       float64 `json:"cpu"`
-	Memory    float64 `json:"memory"`
-	DiskRoot  float64 `json:"disk_root"`
-	DiskHome  float64 `json:"disk_home"`
-}
+// allHosts is the `host` query value selecting every monitored host.
+const allHosts = "all"
+
+const monitoringHistoryLimit = 1000
 
-var monitoringHistory []MonitoringData
+// monitoringHistory keeps the last samples of each host, keyed by host name.
+var monitoringHistory = map[string][]models.MonitoringData{}
+
+// monitoringSeen indexes the millisecond timestamps in monitoringHistory per host.
+var monitoringSeen = map[string]map[int64]struct{}{}
 var monitoringID int64 = 1
+var monitoringMu sync.RWMutex
 
 func RegisterMonitoringRoutes(r *gin.Engine, userService services.UserService) {
 
 	r.GET("/monitoring/history", func(c *gin.Context) {
-		c.JSON(200, monitoringHistory)
+		c.JSON(200, getMonitoringHistory(c.DefaultQuery("host", collector.Hostname())))
 	})
 
-	r.GET("/monitoring/cpu", MakeWebSocketHandler(1000*time.Millisecond, func() (any, error) {
-		cpuUsage, err := getCPUUsage()
-		if err != nil {
-			return nil, err
-		}
-		memoryUsage, _ := getMemoryUsage()
-		diskUsage, _ := getDiskUsage()
-		now := time.Now().Unix()
-		data := MonitoringData{
-			ID:        monitoringID,
-			Timestamp: now,
-			CPU:       cpuUsage,
-			Memory:    memoryUsage,
-			DiskRoot:  diskUsage["/"],
-			DiskHome:  diskUsage["/home"],
-		}
-		monitoringID++
-		monitoringHistory = append(monitoringHistory, data)
-		if len(monitoringHistory) > 1000 {
-			monitoringHistory = monitoringHistory[len(monitoringHistory)-1000:]
-		}
-		return cpuUsage, nil
-	}))
+	for name, source := range monitoringSources {
+		r.GET("/monitoring/"+name, metricWebSocketHandler(source))
+	}
 
-	r.GET("/monitoring/memory", MakeWebSocketHandler(1000*time.Millisecond, func() (interface{}, error) {
-		usage, err := getMemoryUsage()
-		if err != nil {
-			return nil, err
-		}
-		return usage, nil
-	}))
+	// One socket for every metric and host, see stream.go
+	r.GET("/monitoring/stream", handleMonitoringStream)
+}
 
-	r.GET("/monitoring/disk", MakeWebSocketHandler(10000*time.Millisecond, func() (interface{}, error) {
-		usage, err := getDiskUsage()
-		if err != nil {
-			return nil, err
-		}
-		return usage, nil
-	}))
+// metricSource describes one live metric stream. The local host is measured
+// on each tick while remote hosts are served from the samples their agent pushed.
+type metricSource struct {
+	interval time.Duration
+	collect  func() (any, error)
+	project  func(models.MonitoringData) any
 }
 
-type dataFunc func() (any, error)
+var monitoringSources = map[string]metricSource{
+	"cpu": {
+		interval: 1000 * time.Millisecond,
+		// Only StartMonitoringBackground records the local samples: the
+		// streams, as many as the clients open, would flood the history, the
+		// sinks and the alert baselines.
+		collect: func() (any, error) {
+			return collector.CPUUsage()
+		},
+		project: func(data models.MonitoringData) any { return data.CPU },
+	},
+	"memory": {
+		interval: 1000 * time.Millisecond,
+		collect: func() (any, error) {
+			return collector.MemoryUsage()
+		},
+		project: func(data models.MonitoringData) any { return data.Memory },
+	},
+	"disk": {
+		interval: 10000 * time.Millisecond,
+		collect: func() (any, error) {
+			return collector.DiskUsage()
+		},
+		project: func(data models.MonitoringData) any {
+			return map[string]float64{"/": data.DiskRoot, "/home": data.DiskHome}
+		},
+	},
+}
 
-func MakeWebSocketHandler(interval time.Duration, dataFn dataFunc) gin.HandlerFunc {
-	var upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
+func (m metricSource) data(host string) (any, error) {
+	if host == "" || host == collector.Hostname() {
+		return m.collect()
 	}
-	return func(c *gin.Context) {
-		tokenString := c.Query("token")
-		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
-			return
-		}
-		token, err := jwt.ParseWithClaims(tokenString, &authutil.Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return authutil.GetJWTSecret(), nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
-		}
+	data, ok := latestMonitoringData(host)
+	if !ok {
+		return nil, fmt.Errorf("no data for host %q", host)
+	}
+	return m.project(data), nil
+}
 
-		// Determine effective interval (allow override via query param `interval_ms`)
-		effectiveInterval := interval
-		if msStr := c.Query("interval_ms"); msStr != "" {
-			if ms, err := strconv.Atoi(msStr); err == nil {
-				if ms < 250 {
-					ms = 250
-				}
-				if ms > 60000 {
-					ms = 60000
-				}
-				effectiveInterval = time.Duration(ms) * time.Millisecond
-			}
-		}
+// dataFunc returns the value to send for the host requested by the client,
+// empty meaning the local host.
+type dataFunc func(host string) (any, error)
 
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-		if err != nil {
-			log.Println("Erreur d'upgrade:", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+func MakeWebSocketHandler(interval time.Duration, dataFn dataFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := queryTokenClaims(c); !ok {
 			return
 		}
-
-		ticker := time.NewTicker(effectiveInterval)
-		defer ticker.Stop()
-
-		done := make(chan struct{})
-
-		go func() {
-			for {
-				select {
-				case <-ticker.C:
-					value, err := dataFn()
-					if err != nil {
-						log.Println("Erreur récupération data:", err)
-						continue
-					}
-					msg, _ := json.Marshal(value)
-					if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-						log.Println("Erreur envoi message:", err)
-						return
-					}
-
-				case <-done:
-					return
-				}
-			}
-		}()
-
-		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
-				log.Println("Client déconnecté:", err)
-				close(done)
-				break
-			}
-		}
+		streamValues(c, interval, dataFn)
 	}
 }
 
-func getDiskUsage() (map[string]float64, error) {
-	usageMap := make(map[string]float64)
+// streamValues sends the values of dataFn over a WebSocket every interval,
+// the token being already checked.
+func streamValues(c *gin.Context, interval time.Duration, dataFn dataFunc) {
+	// Determine effective interval (allow override via query param `interval_ms`)
+	effectiveInterval := interval
+	if ms, err := strconv.Atoi(c.Query("interval_ms")); err == nil {
+		effectiveInterval = clampInterval(ms)
+	}
 
-	rootUsage, err := usageFor("/")
+	host := c.Query("host")
+	policy, err := parseSlowPolicy(c)
 	if err != nil {
-		return nil, fmt.Errorf("disk usage error for '/': %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slow_policy", "details": err.Error()})
+		return
 	}
-	usageMap["/"] = rootUsage
 
-	homeUsage, err := usageFor("/home")
+	conn, err := monitoringUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		return nil, fmt.Errorf("disk usage error for '/home': %v", err)
+		log.Println("Erreur d'upgrade:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
-	usageMap["/home"] = homeUsage
+	client := newWSClient(conn, policy)
+	defer client.Close()
+	go client.Discard()
 
-	return usageMap, nil
-}
-
-func usageFor(path string) (float64, error) {
-	var stat unix.Statfs_t
-	if err := unix.Statfs(path, &stat); err != nil {
-		return 0, err
-	}
+	ticker := time.NewTicker(effectiveInterval)
+	defer ticker.Stop()
 
-	total := stat.Blocks * uint64(stat.Bsize)
-	free := stat.Bfree * uint64(stat.Bsize)
-	used := total - free
+	for {
+		select {
+		case <-ticker.C:
+			value, err := dataFn(host)
+			if err != nil {
+				log.Println("Erreur récupération data:", err)
+				continue
+			}
+			if err := client.Send(value); err != nil {
+				return
+			}
 
-	if total == 0 {
-		return 0, fmt.Errorf("total blocks are zero on path: %s", path)
+		case <-client.Done():
+			return
+		}
 	}
-
-	usagePercent := float64(used) / float64(total) * 100.0
-	return usagePercent, nil
-}
-
-type cpuTimes struct {
-	user    uint64
-	nice    uint64
-	system  uint64
-	idle    uint64
-	iowait  uint64
-	irq     uint64
-	softirq uint64
-	steal   uint64
-	total   uint64
 }
 
-func getCPUUsage() (float64, error) {
-	c1, err := readCPUSnapshot()
-	if err != nil {
-		return 0.0, err
+// queryTokenClaims validates the JWT passed as `?token=`, browsers being
+// unable to set headers on WebSocket requests. It aborts the request when
+// the token is missing or invalid.
+func queryTokenClaims(c *gin.Context) (*authutil.Claims, bool) {
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return nil, false
 	}
-
-	time.Sleep(100 * time.Millisecond)
-
-	c2, err := readCPUSnapshot()
-	if err != nil {
-		return 0.0, err
+	claims := &authutil.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return authutil.GetJWTSecret(), nil
+	})
+	if err != nil || !token.Valid {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil, false
 	}
+	return claims, true
+}
 
-	idleDelta := float64((c2.idle + c2.iowait) - (c1.idle + c1.iowait))
-	totalDelta := float64(c2.total - c1.total)
-
-	if totalDelta == 0 {
-		return 0.0, nil
+// clampInterval bounds a client requested interval to 250ms..60s.
+func clampInterval(ms int) time.Duration {
+	if ms < 250 {
+		ms = 250
 	}
-
-	usage := (1.0 - idleDelta/totalDelta) * 100.0
-	return usage, nil
+	if ms > 60000 {
+		ms = 60000
+	}
+	return time.Duration(ms) * time.Millisecond
 }
 
-// readCPUSnapshot parses the first "cpu " line in /proc/stat to extract CPU counters
-func readCPUSnapshot() (*cpuTimes, error) {
-	data, err := os.ReadFile("/proc/stat")
+// StartMonitoringBackground records a local sample every second and keeps
+// the local host marked online in the inventory.
+func StartMonitoringBackground(hostService services.HostService) {
+	local, err := hostService.RegisterLocal(collector.HostInfo())
 	if err != nil {
-		return nil, err
+		log.Println("Failed to register local host:", err)
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "cpu ") {
-			fields := strings.Fields(line)
-			if len(fields) < 8 {
-				break
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			<-ticker.C
+			data, err := collector.Collect()
+			if err != nil {
+				continue
 			}
-
-			user, _ := strconv.ParseUint(fields[1], 10, 64)
-			nice, _ := strconv.ParseUint(fields[2], 10, 64)
-			system, _ := strconv.ParseUint(fields[3], 10, 64)
-			idle, _ := strconv.ParseUint(fields[4], 10, 64)
-			iowait, _ := strconv.ParseUint(fields[5], 10, 64)
-			irq, _ := strconv.ParseUint(fields[6], 10, 64)
-			softirq, _ := strconv.ParseUint(fields[7], 10, 64)
-
-			var steal uint64
-			if len(fields) > 8 {
-				steal, _ = strconv.ParseUint(fields[8], 10, 64)
+			recordMonitoringData(data)
+			if local != nil {
+				if err := hostService.Heartbeat(local, ""); err != nil {
+					log.Println("Failed to update local host:", err)
+				}
 			}
-
-			total := user + nice + system + idle + iowait + irq + softirq + steal
-			return &cpuTimes{
-				user:    user,
-				nice:    nice,
-				system:  system,
-				idle:    idle,
-				iowait:  iowait,
-				irq:     irq,
-				softirq: softirq,
-				steal:   steal,
-				total:   total,
-			}, nil
 		}
-	}
-	return nil, fmt.Errorf("could not find 'cpu ' line in /proc/stat")
+	}()
 }
 
-func getMemoryUsage() (float64, error) {
-	file, err := os.Open("/proc/meminfo")
-	if err != nil {
-		return 0, err
+// recordMonitoringData assigns the sample an ID, appends it to the history
+// and runs it through the alert rules. A sample whose host and millisecond
+// timestamp are already in the history is a replay and is dropped; samples
+// within the same second are distinct.
+func recordMonitoringData(data models.MonitoringData) (models.MonitoringData, bool) {
+	if data.TimestampMS == 0 {
+		// agents older than timestamp_ms only send seconds
+		data.TimestampMS = data.Timestamp * 1000
+	} else if data.Timestamp == 0 {
+		data.Timestamp = data.TimestampMS / 1000
 	}
-	defer func() {
-		if cerr := file.Close(); cerr != nil {
-			log.Printf("warning: échec de la fermeture du fichier : %v", cerr)
-		}
-	}()
 
-	var totalMem, availableMem uint64
-	scanner := bufio.NewScanner(file)
+	monitoringMu.Lock()
+	seen := monitoringSeen[data.Host]
+	if seen == nil {
+		seen = map[int64]struct{}{}
+		monitoringSeen[data.Host] = seen
+	}
+	if _, ok := seen[data.TimestampMS]; ok {
+		monitoringMu.Unlock()
+		return data, false
+	}
+	data.ID = monitoringID
+	monitoringID++
+	history := append(monitoringHistory[data.Host], data)
+	seen[data.TimestampMS] = struct{}{}
+	if len(history) > monitoringHistoryLimit {
+		for _, old := range history[:len(history)-monitoringHistoryLimit] {
+			delete(seen, old.TimestampMS)
+		}
+		history = history[len(history)-monitoringHistoryLimit:]
+	}
+	monitoringHistory[data.Host] = history
+	sinks := monitoringSinks
+	monitoringMu.Unlock()
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	for _, sink := range sinks {
+		sink.Record(data)
+	}
 
-		if strings.HasPrefix(line, "MemTotal:") {
-			fields := strings.Fields(line)
-			totalMem, _ = strconv.ParseUint(fields[1], 10, 64)
-		} else if strings.HasPrefix(line, "MemAvailable:") {
-			fields := strings.Fields(line)
-			availableMem, _ = strconv.ParseUint(fields[1], 10, 64)
+	for _, p := range monitoringPoints(data) {
+		for _, alert := range alertEngine.Observe(p) {
+			log.Printf("alert %s fired: %s", alert.Rule, alert.Message)
 		}
 	}
+	return data, true
+}
 
-	if totalMem == 0 {
-		return 0, fmt.Errorf("could not find MemTotal in /proc/meminfo")
+func latestMonitoringData(host string) (models.MonitoringData, bool) {
+	monitoringMu.RLock()
+	defer monitoringMu.RUnlock()
+	history := monitoringHistory[host]
+	if len(history) == 0 {
+		return models.MonitoringData{}, false
 	}
+	return history[len(history)-1], true
+}
 
-	used := totalMem - availableMem
-	usage := (float64(used) / float64(totalMem)) * 100.0
+// monitoringHistorySince returns the samples of host whose ID is above id.
+func monitoringHistorySince(host string, id int64) []models.MonitoringData {
+	monitoringMu.RLock()
+	defer monitoringMu.RUnlock()
+	history := monitoringHistory[host]
+	i := sort.Search(len(history), func(i int) bool { return history[i].ID > id })
+	samples := make([]models.MonitoringData, len(history)-i)
+	copy(samples, history[i:])
+	return samples
+}
 
-	return usage, nil
+// forgetMonitoringHost drops the history of a host removed from the inventory.
+func forgetMonitoringHost(host string) {
+	monitoringMu.Lock()
+	defer monitoringMu.Unlock()
+	delete(monitoringHistory, host)
+	delete(monitoringSeen, host)
+	metricSeries.ForgetHost(host)
 }
 
-func StartMonitoringBackground() {
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-		for {
-			<-ticker.C
-			cpuUsage, err := getCPUUsage()
-			if err != nil {
-				continue
-			}
-			memoryUsage, _ := getMemoryUsage()
-			diskUsage, _ := getDiskUsage()
-			now := time.Now().Unix()
-			data := MonitoringData{
-				ID:        monitoringID,
-				Timestamp: now,
-				CPU:       cpuUsage,
-				Memory:    memoryUsage,
-				DiskRoot:  diskUsage["/"],
-				DiskHome:  diskUsage["/home"],
-			}
-			monitoringID++
-			monitoringHistory = append(monitoringHistory, data)
-			if len(monitoringHistory) > 1000 {
-				monitoringHistory = monitoringHistory[len(monitoringHistory)-1000:]
-			}
-		}
-	}()
+// getMonitoringHistory returns a copy of the history of host, or of every
+// host ordered by sample ID when host is allHosts.
+func getMonitoringHistory(host string) []models.MonitoringData {
+	monitoringMu.RLock()
+	defer monitoringMu.RUnlock()
+	if host != allHosts {
+		history := make([]models.MonitoringData, len(monitoringHistory[host]))
+		copy(history, monitoringHistory[host])
+		return history
+	}
+	history := []models.MonitoringData{}
+	for _, samples := range monitoringHistory {
+		history = append(history, samples...)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].ID < history[j].ID })
+	return history
+}
+
+// monitoredHosts returns the names of the hosts with samples in the history.
+func monitoredHosts() []string {
+	monitoringMu.RLock()
+	defer monitoringMu.RUnlock()
+	hosts := make([]string, 0, len(monitoringHistory))
+	for host := range monitoringHistory {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// monitoringPoints flattens a sample into one alerting point per metric.
+func monitoringPoints(data models.MonitoringData) []alerting.Point {
+	return []alerting.Point{
+		{Metric: "cpu", Source: alerting.SourceCollector, Host: data.Host, Timestamp: data.Timestamp, Value: data.CPU},
+		{Metric: "memory", Source: alerting.SourceCollector, Host: data.Host, Timestamp: data.Timestamp, Value: data.Memory},
+		{Metric: "disk_root", Source: alerting.SourceCollector, Host: data.Host, Timestamp: data.Timestamp, Value: data.DiskRoot},
+		{Metric: "disk_home", Source: alerting.SourceCollector, Host: data.Host, Timestamp: data.Timestamp, Value: data.DiskHome},
+	}
 }
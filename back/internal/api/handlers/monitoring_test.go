@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"back/internal/alerting"
+	"back/internal/collector"
+	models "back/internal/domain"
+	"back/internal/series"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Mock host service: one enrollment token, agent keys named after the host
+type mockHostService struct {
+	hosts map[string]*models.Host // by agent key
+}
+
+func newMockHostService() *mockHostService {
+	return &mockHostService{hosts: map[string]*models.Host{}}
+}
+
+func (m *mockHostService) CreateEnrollmentToken(description string, ttl time.Duration) (string, *models.EnrollmentToken, error) {
+	return "enroll-secret", &models.EnrollmentToken{ID: "1", Description: description}, nil
+}
+func (m *mockHostService) GetEnrollmentTokens() ([]models.EnrollmentToken, error) {
+	return []models.EnrollmentToken{}, nil
+}
+func (m *mockHostService) RevokeEnrollmentToken(id string) error { return nil }
+func (m *mockHostService) Enroll(token, agentKey string, info models.HostInfo) (*models.Host, string, error) {
+	if token != "enroll-secret" {
+		return nil, "", services.ErrInvalidEnrollmentToken
+	}
+	if _, ok := m.hosts["key-"+info.Hostname]; ok && agentKey != "key-"+info.Hostname {
+		return nil, "", services.ErrHostAlreadyEnrolled
+	}
+	host := &models.Host{ID: info.Hostname, Hostname: info.Hostname}
+	m.hosts["key-"+info.Hostname] = host
+	return host, "key-" + info.Hostname, nil
+}
+func (m *mockHostService) RegisterLocal(info models.HostInfo) (*models.Host, error) {
+	return &models.Host{ID: info.Hostname, Hostname: info.Hostname}, nil
+}
+func (m *mockHostService) Authenticate(agentKey string) (*models.Host, error) {
+	if host, ok := m.hosts[agentKey]; ok {
+		return host, nil
+	}
+	return nil, services.ErrInvalidAgentKey
+}
+func (m *mockHostService) Heartbeat(host *models.Host, agentVersion string) error { return nil }
+func (m *mockHostService) GetHostByID(id string) (*models.Host, error) {
+	return nil, errors.New("not found")
+}
+func (m *mockHostService) GetAllHosts() ([]models.Host, error) { return []models.Host{}, nil }
+func (m *mockHostService) UpdateHostLabels(id string, labels map[string]string) (*models.Host, error) {
+	return nil, errors.New("not found")
+}
+func (m *mockHostService) DeleteHost(id string) (*models.Host, error) {
+	return nil, errors.New("not found")
+}
+
+func createMonitoringTestServer(hostService services.HostService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterMonitoringRoutes(r, &mockUserService{})
+	RegisterAgentRoutes(r, hostService)
+	return r
+}
+
+// enrollTestAgent enrolls hostname, starting from an empty history
+func enrollTestAgent(t *testing.T, r *gin.Engine, hostname string) string {
+	forgetMonitoringHost(hostname)
+	body, _ := json.Marshal(EnrollRequest{EnrollmentToken: "enroll-secret", HostInfo: models.HostInfo{Hostname: hostname}})
+	req := httptest.NewRequest(http.MethodPost, "/agent/enroll", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp struct {
+		AgentKey string `json:"agent_key"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.AgentKey
+}
+
+func pushAgentSamples(r *gin.Engine, token string, payload models.AgentSamples) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/agent/samples", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAgentSamplesAreTaggedWithHost(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-agent-host")
+
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{
+		Host: "spoofed",
+		Samples: []models.MonitoringData{
+			{Host: "spoofed", Timestamp: 100, CPU: 12},
+			{Timestamp: 101, CPU: 13},
+		},
+	})
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/monitoring/history?host=test-agent-host", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var history []models.MonitoringData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history, 2)
+	for _, data := range history {
+		assert.Equal(t, "test-agent-host", data.Host)
+	}
+	assert.Equal(t, int64(100), history[0].Timestamp)
+	assert.Less(t, history[0].ID, history[1].ID)
+}
+
+func TestAgentSamplesAreDeduplicated(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-agent-dedup")
+
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 10, CPU: 1}, {Timestamp: 11, CPU: 2},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	// the agent replays a batch whose response it never received
+	w = pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 11, CPU: 2}, {Timestamp: 12, CPU: 3},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"accepted": 1, "duplicates": 1}`, w.Body.String())
+
+	history := getMonitoringHistory("test-agent-dedup")
+	require.Len(t, history, 3)
+	assert.Equal(t, int64(12), history[2].Timestamp)
+}
+
+func TestAgentSamplesTooLarge(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-agent-large")
+
+	samples := make([]models.MonitoringData, maxAgentSamples+1)
+	for i := range samples {
+		samples[i].Timestamp = int64(i + 1)
+	}
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: samples})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = pushAgentSamples(r, agentKey, models.AgentSamples{AgentVersion: strings.Repeat("x", maxAgentBodyBytes)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, getMonitoringHistory("test-agent-large"))
+}
+
+func TestAgentSamplesWithinOneSecondAreKept(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-agent-subsecond")
+
+	// AGENT_INTERVAL_MS=250
+	samples := []models.MonitoringData{
+		{Timestamp: 20, TimestampMS: 20000, CPU: 1}, {Timestamp: 20, TimestampMS: 20250, CPU: 2},
+		{Timestamp: 20, TimestampMS: 20500, CPU: 3}, {Timestamp: 20, TimestampMS: 20750, CPU: 4},
+	}
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: samples})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"accepted": 4, "duplicates": 0}`, w.Body.String())
+
+	w = pushAgentSamples(r, agentKey, models.AgentSamples{Samples: samples[2:]})
+	assert.JSONEq(t, `{"accepted": 0, "duplicates": 2}`, w.Body.String())
+	assert.Len(t, getMonitoringHistory("test-agent-subsecond"), 4)
+}
+
+func TestAgentSamplesAuthentication(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	payload := models.AgentSamples{Samples: []models.MonitoringData{{Timestamp: 1}}}
+
+	assert.Equal(t, http.StatusUnauthorized, pushAgentSamples(r, "", payload).Code)
+	assert.Equal(t, http.StatusUnauthorized, pushAgentSamples(r, "wrong", payload).Code)
+
+	body, _ := json.Marshal(EnrollRequest{EnrollmentToken: "wrong", HostInfo: models.HostInfo{Hostname: "x"}})
+	req := httptest.NewRequest(http.MethodPost, "/agent/enroll", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	agentKey := enrollTestAgent(t, r, "test-agent-auth")
+	assert.Equal(t, http.StatusAccepted, pushAgentSamples(r, agentKey, payload).Code)
+
+	// a known hostname is only re-enrolled with its current key
+	body, _ = json.Marshal(EnrollRequest{EnrollmentToken: "enroll-secret", HostInfo: models.HostInfo{Hostname: "test-agent-auth"}})
+	req = httptest.NewRequest(http.MethodPost, "/agent/enroll", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/agent/enroll", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+agentKey)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestMonitoringStreamForRemoteHost(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-agent-stream")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 1, CPU: 10, DiskRoot: 50, DiskHome: 60},
+		{Timestamp: 2, CPU: 42.5, DiskRoot: 51, DiskHome: 61},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/monitoring/cpu?interval_ms=250&host=test-agent-stream&token=" + createTestToken()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer func() {
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	}()
+
+	var cpu float64
+	require.NoError(t, conn.ReadJSON(&cpu))
+	assert.Equal(t, 42.5, cpu)
+
+	disk, err := monitoringSources["disk"].data("test-agent-stream")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"/": 51, "/home": 61}, disk)
+
+	_, err = monitoringSources["memory"].data("unknown-host")
+	assert.Error(t, err)
+}
+
+func TestCPUStreamDoesNotRecord(t *testing.T) {
+	ts := httptest.NewServer(createMonitoringTestServer(newMockHostService()))
+	defer ts.Close()
+	before := len(getMonitoringHistory(collector.Hostname()))
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/monitoring/cpu?interval_ms=250&token=" + createTestToken()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	for range 3 {
+		var cpu float64
+		require.NoError(t, conn.ReadJSON(&cpu))
+	}
+	assert.Len(t, getMonitoringHistory(collector.Hostname()), before)
+}
+
+func TestDefaultAnomalyRulesWatchCollectorsOnly(t *testing.T) {
+	for _, cfg := range alertEngine.Rules() {
+		if cfg.Name != "cpu-anomaly" && cfg.Name != "memory-anomaly" {
+			continue
+		}
+		rule, err := alerting.NewRule(cfg)
+		require.NoError(t, err)
+		matched := false
+		for _, p := range monitoringPoints(models.MonitoringData{Host: "web-1", Timestamp: 1}) {
+			matched = matched || rule.Matches(p)
+		}
+		assert.True(t, matched)
+		// StatsD, plugin or log metrics that happen to be named cpu or memory
+		assert.False(t, rule.Matches(seriesPoint(series.Sample{Metric: cfg.Metric, Host: "web-1"})))
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"back/internal/remotewrite"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReceiveRemoteWrite stores the series pushed by a Prometheus server or
+// agent with remote_write, authenticated with an agent key as bearer
+// token. Every series belongs to the host of that key: an agent key cannot
+// write the metrics of another host, the instance label being kept as a
+// plain label.
+func ReceiveRemoteWrite(c *gin.Context, hostService services.HostService) {
+	host, ok := authenticateAgent(c, hostService)
+	if !ok {
+		return
+	}
+	// remote_write 2.0 is announced with proto=io.prometheus.write.v2.Request
+	contentType := c.GetHeader("Content-Type")
+	if c.ContentType() != "application/x-protobuf" || strings.Contains(contentType, "io.prometheus.write.v2") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only remote_write 1.0 protobuf requests are supported"})
+		return
+	}
+	if encoding := c.GetHeader("Content-Encoding"); encoding != "" && encoding != "snappy" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported Content-Encoding", "details": encoding})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, remotewrite.MaxDecodedSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+	timeSeries, err := remotewrite.Decode(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	if err := hostService.Heartbeat(host, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update host"})
+		return
+	}
+	RecordSeries(remotewrite.ToSamples(timeSeries, host.Hostname))
+	c.Status(http.StatusNoContent)
+}
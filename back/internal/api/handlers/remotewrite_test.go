@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"back/internal/remotewrite"
+	"back/internal/series"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postRemoteWrite(r *gin.Engine, token, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/agent/write", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRemoteWrite(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	token := enrollTestAgent(t, r, "prom-host")
+	forgetMonitoringHost("exporter-1")
+
+	body := remotewrite.Encode([]remotewrite.TimeSeries{
+		{
+			Labels:  []remotewrite.Label{{Name: "__name__", Value: "node_load1"}, {Name: "instance", Value: "exporter-1:9100"}},
+			Samples: []remotewrite.Sample{{Value: 0.5, Timestamp: 1700000000000}},
+		},
+		{
+			Labels:  []remotewrite.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "prometheus"}},
+			Samples: []remotewrite.Sample{{Value: 1, Timestamp: 1700000000000}},
+		},
+	})
+	w := postRemoteWrite(r, token, "application/x-protobuf", body)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	// the instance label does not move the series to another host
+	assert.Empty(t, metricSeries.List(series.Filter{Host: "exporter-1"}))
+	result := metricSeries.Query(series.Filter{Metric: "node_load1", Host: "prom-host", Labels: map[string]string{"instance": "exporter-1:9100"}}, 0, 0)
+	require.Len(t, result, 1)
+	assert.Equal(t, []series.Point{{Timestamp: 1700000000, Value: 0.5}}, result[0].Points)
+	assert.Len(t, metricSeries.List(series.Filter{Metric: "up", Host: "prom-host", Labels: map[string]string{"job": "prometheus"}}), 1)
+}
+
+func TestRemoteWriteRejects(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	token := enrollTestAgent(t, r, "prom-host")
+
+	assert.Equal(t, http.StatusUnauthorized, postRemoteWrite(r, "wrong", "application/x-protobuf", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, postRemoteWrite(r, token, "application/x-protobuf", []byte("garbage")).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType,
+		postRemoteWrite(r, token, "application/x-protobuf;proto=io.prometheus.write.v2.Request", remotewrite.Encode(nil)).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, postRemoteWrite(r, token, "application/json", nil).Code)
+}
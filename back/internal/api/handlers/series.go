@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"back/internal/alerting"
+	"back/internal/series"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMetricSeries bounds the number of application series, a badly tagged
+// metric being enough to create one per request.
+const maxMetricSeries = 10000
+
+// metricSeries holds the application metrics, next to the host samples
+// of monitoringHistory.
+var metricSeries = series.NewStore(monitoringHistoryLimit, maxMetricSeries)
+
+// RecordSeries stores application samples and runs them through the alert
+// rules, which match them by metric name like the host metrics.
+func RecordSeries(samples []series.Sample) {
+	for _, sample := range samples {
+		if !metricSeries.Add(sample) {
+			continue
+		}
+		for _, alert := range alertEngine.Observe(seriesPoint(sample)) {
+			log.Printf("alert %s fired: %s", alert.Rule, alert.Message)
+		}
+	}
+}
+
+func seriesPoint(sample series.Sample) alerting.Point {
+	return alerting.Point{Metric: sample.Metric, Source: alerting.SourceSeries, Host: sample.Host, Labels: sample.Labels, Timestamp: sample.Timestamp, Value: sample.Value}
+}
+
+// seriesPoints returns every stored application point, for rules to warm up.
+func seriesPoints() []alerting.Point {
+	var points []alerting.Point
+	for _, ser := range metricSeries.Query(series.Filter{}, 0, 0) {
+		for _, p := range ser.Points {
+			points = append(points, alerting.Point{Metric: ser.Metric, Source: alerting.SourceSeries, Host: ser.Host, Labels: ser.Labels, Timestamp: p.Timestamp, Value: p.Value})
+		}
+	}
+	return points
+}
+
+// RegisterSeriesRoutes exposes the application metrics.
+//
+// Both routes filter on metric, host and labels ("name:value" pairs,
+// comma separated); the data route also takes from and to (unix seconds).
+func RegisterSeriesRoutes(r *gin.RouterGroup) {
+	r.GET("/monitoring/series", func(c *gin.Context) {
+		c.JSON(http.StatusOK, metricSeries.List(seriesFilter(c)))
+	})
+
+	r.GET("/monitoring/series/data", func(c *gin.Context) {
+		var from, to int64
+		for name, dst := range map[string]*int64{"from": &from, "to": &to} {
+			if v := c.Query(name); v != "" {
+				var err error
+				if *dst, err = strconv.ParseInt(v, 10, 64); err != nil || *dst < 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name, "details": "must be a non-negative integer"})
+					return
+				}
+			}
+		}
+		c.JSON(http.StatusOK, metricSeries.Query(seriesFilter(c), from, to))
+	})
+}
+
+func seriesFilter(c *gin.Context) series.Filter {
+	f := series.Filter{Metric: c.Query("metric"), Host: c.Query("host")}
+	if list := c.Query("labels"); list != "" {
+		f.Labels = map[string]string{}
+		for _, pair := range strings.Split(list, ",") {
+			name, value, _ := strings.Cut(pair, ":")
+			f.Labels[name] = value
+		}
+	}
+	return f
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"back/internal/alerting"
+	"back/internal/series"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createSeriesTestServer() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	RegisterSeriesRoutes(r.Group(""))
+	return r
+}
+
+func TestSeriesRoutes(t *testing.T) {
+	forgetMonitoringHost("series-host")
+	RecordSeries([]series.Sample{
+		{Metric: "checkout.count", Host: "series-host", Labels: map[string]string{"env": "prod"}, Timestamp: 100, Value: 3},
+		{Metric: "checkout.count", Host: "series-host", Labels: map[string]string{"env": "prod"}, Timestamp: 110, Value: 5},
+		{Metric: "checkout.count", Host: "series-host", Labels: map[string]string{"env": "dev"}, Timestamp: 110, Value: 1},
+	})
+	r := createSeriesTestServer()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/monitoring/series?host=series-host", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var infos []series.Info
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &infos))
+	require.Len(t, infos, 2)
+	assert.Equal(t, "dev", infos[0].Labels["env"])
+	assert.Equal(t, 2, infos[1].Count)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/monitoring/series/data?metric=checkout.count&labels=env:prod&from=105", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var result []series.Series
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Len(t, result, 1)
+	assert.Equal(t, []series.Point{{Timestamp: 110, Value: 5}}, result[0].Points)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/monitoring/series/data?from=abc", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSeriesAlerts(t *testing.T) {
+	forgetMonitoringHost("series-host")
+	rule, err := alerting.NewRule(alerting.RuleConfig{Name: "checkout-errors", Type: alerting.TypeThreshold, Metric: "checkout.errors", Operator: ">", Threshold: 10})
+	require.NoError(t, err)
+	require.NoError(t, alertEngine.AddRule(rule))
+	defer alertEngine.RemoveRule("checkout-errors")
+
+	last := int64(0)
+	if alerts := alertEngine.Alerts(0, "", ""); len(alerts) > 0 {
+		last = alerts[len(alerts)-1].ID
+	}
+	RecordSeries([]series.Sample{{Metric: "checkout.errors", Host: "series-host", Timestamp: 100, Value: 42}})
+
+	alerts := alertEngine.Alerts(last, alerting.TypeThreshold, "series-host")
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "checkout.errors", alerts[0].Metric)
+}
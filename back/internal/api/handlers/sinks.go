@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	models "back/internal/domain"
+	"back/internal/sink"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MonitoringSink receives every recorded sample, local or pushed by an
+// agent, to forward it to an external system. Record must not block.
+type MonitoringSink interface {
+	Record(data models.MonitoringData)
+	Stats() sink.Stats
+}
+
+// monitoringSinks are guarded by monitoringMu.
+var monitoringSinks []MonitoringSink
+
+func AddMonitoringSink(s MonitoringSink) {
+	monitoringMu.Lock()
+	defer monitoringMu.Unlock()
+	monitoringSinks = append(monitoringSinks, s)
+}
+
+// RegisterSinkRoutes exposes the counters of the output sinks.
+func RegisterSinkRoutes(r *gin.RouterGroup) {
+	r.GET("/monitoring/sinks", func(c *gin.Context) {
+		monitoringMu.RLock()
+		sinks := monitoringSinks
+		monitoringMu.RUnlock()
+
+		stats := make([]sink.Stats, 0, len(sinks))
+		for _, s := range sinks {
+			stats = append(stats, s.Stats())
+		}
+		c.JSON(http.StatusOK, stats)
+	})
+}
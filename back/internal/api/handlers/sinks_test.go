@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	models "back/internal/domain"
+	"back/internal/sink"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	samples []models.MonitoringData
+}
+
+func (s *recordingSink) Record(data models.MonitoringData) {
+	s.samples = append(s.samples, data)
+}
+
+func (s *recordingSink) Stats() sink.Stats {
+	return sink.Stats{Name: "recording", Pending: len(s.samples)}
+}
+
+func TestMonitoringSinks(t *testing.T) {
+	recorder := &recordingSink{}
+	AddMonitoringSink(recorder)
+	defer func() {
+		monitoringMu.Lock()
+		monitoringSinks = monitoringSinks[:len(monitoringSinks)-1]
+		monitoringMu.Unlock()
+	}()
+
+	r := createMonitoringTestServer(newMockHostService())
+	token := enrollTestAgent(t, r, "sink-host")
+	w := pushAgentSamples(r, token, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 100, CPU: 10},
+		{Timestamp: 101, CPU: 20},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Len(t, recorder.samples, 2)
+	assert.Equal(t, "sink-host", recorder.samples[0].Host)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterSinkRoutes(router.Group(""))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/monitoring/sinks", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats []sink.Stats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, []sink.Stats{{Name: "recording", Pending: 2}}, stats)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"back/internal/collector"
+	models "back/internal/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sseKeepAlive = 15 * time.Second
+
+// RegisterMonitoringSSERoutes exposes every live metric stream as
+// Server-Sent Events, for clients behind proxies that break WebSocket
+// upgrades. The group is expected to check the bearer token header.
+func RegisterMonitoringSSERoutes(r *gin.RouterGroup) {
+	for name, source := range monitoringSources {
+		r.GET("/monitoring/"+name+"/sse", makeSSEHandler(name, source))
+	}
+}
+
+// makeSSEHandler streams the recorded samples of a host, each event id
+// being the sample ID. A client reconnecting with Last-Event-ID first gets
+// the samples it missed that are still in the history; a new client can ask
+// for a backfill like on the WebSockets.
+func makeSSEHandler(name string, source metricSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host := c.DefaultQuery("host", collector.Hostname())
+
+		interval := time.Second
+		if ms, err := strconv.Atoi(c.Query("interval_ms")); err == nil {
+			interval = clampInterval(ms)
+		}
+
+		var lastID int64
+		if id, err := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64); err == nil {
+			lastID = id
+		} else {
+			backfill, err := parseBackfill(c)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backfill", "details": err.Error()})
+				return
+			}
+			lastID = backfill.cursor(host)
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", interval.Milliseconds()); err != nil {
+			return
+		}
+		c.Writer.Flush()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			for _, data := range monitoringHistorySince(host, lastID) {
+				if err := writeSSEvent(c, name, data, source.project(data)); err != nil {
+					return
+				}
+				lastID = data.ID
+			}
+			c.Writer.Flush()
+
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+func writeSSEvent(c *gin.Context, event string, data models.MonitoringData, value any) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", data.ID, event, payload)
+	return err
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// readSSEvents reads n events from an SSE response, ignoring comments and retry lines
+func readSSEvents(t *testing.T, resp *http.Response, n int) []sseEvent {
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.data != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	require.Len(t, events, n)
+	return events
+}
+
+func openSSE(t *testing.T, ctx context.Context, url, lastEventID string) *http.Response {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return resp
+}
+
+func TestMonitoringSSEResume(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	RegisterMonitoringSSERoutes(&r.RouterGroup)
+	agentKey := enrollTestAgent(t, r, "test-agent-sse")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{
+		{Timestamp: 1, CPU: 10}, {Timestamp: 2, CPU: 20}, {Timestamp: 3, CPU: 30},
+	}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	history := getMonitoringHistory("test-agent-sse")
+	require.Len(t, history, 3)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url := ts.URL + "/monitoring/cpu/sse?interval_ms=250&host=test-agent-sse"
+
+	// a new client starts from the latest sample
+	resp := openSSE(t, ctx, url, "")
+	events := readSSEvents(t, resp, 1)
+	assert.Equal(t, sseEvent{id: strconv.FormatInt(history[2].ID, 10), event: "cpu", data: "30"}, events[0])
+
+	// then gets the samples recorded afterwards
+	w = pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{{Timestamp: 4, CPU: 40}}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	events = readSSEvents(t, resp, 1)
+	assert.Equal(t, "40", events[0].data)
+	_ = resp.Body.Close()
+
+	// a reconnecting client gets what it missed since its last event
+	resp = openSSE(t, ctx, url, strconv.FormatInt(history[0].ID, 10))
+	defer func() { _ = resp.Body.Close() }()
+	events = readSSEvents(t, resp, 3)
+	assert.Equal(t, []string{"20", "30", "40"}, []string{events[0].data, events[1].data, events[2].data})
+	assert.Equal(t, strconv.FormatInt(history[1].ID, 10), events[0].id)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"back/internal/collector"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxStreamSubscriptions = 64
+
+// StreamRequest is sent by the client on /monitoring/stream. ID identifies
+// the subscription in the frames; it defaults to "metric@host". Backfill,
+// SinceID and Since replay the history before the live frames, as the
+// query parameters of the same names do on the per-metric sockets.
+type StreamRequest struct {
+	Type       string `json:"type"` // "subscribe" or "unsubscribe"
+	ID         string `json:"id,omitempty"`
+	Metric     string `json:"metric,omitempty"`
+	Host       string `json:"host,omitempty"`
+	IntervalMs int    `json:"interval_ms,omitempty"`
+	Backfill   int    `json:"backfill,omitempty"`
+	SinceID    int64  `json:"since_id,omitempty"`
+	Since      int64  `json:"since,omitempty"`
+}
+
+// StreamFrame is sent by the server, tagged with the subscription it belongs to.
+type StreamFrame struct {
+	Type      string `json:"type"` // "data", "subscribed", "unsubscribed" or "error"
+	ID        string `json:"id,omitempty"`
+	Metric    string `json:"metric,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	SampleID  int64  `json:"sample_id,omitempty"` // set on subscriptions with a backfill
+	Value     any    `json:"value,omitempty"`
+	Delta     bool   `json:"delta,omitempty"` // value is a difference, see codec.go
+	Error     string `json:"error,omitempty"`
+}
+
+// streamSession is one /monitoring/stream connection and its subscriptions.
+type streamSession struct {
+	client *wsClient
+
+	mu            sync.Mutex
+	subscriptions map[string]chan struct{} // subscription ID -> stop
+}
+
+func handleMonitoringStream(c *gin.Context) {
+	if _, ok := queryTokenClaims(c); !ok {
+		return
+	}
+	policy, err := parseSlowPolicy(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid slow_policy", "details": err.Error()})
+		return
+	}
+
+	conn, err := monitoringUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Println("Erreur d'upgrade:", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	session := &streamSession{client: newWSClient(conn, policy), subscriptions: map[string]chan struct{}{}}
+	defer session.close()
+
+	for {
+		var req StreamRequest
+		if err := session.client.ReadJSON(&req); err != nil {
+			log.Println("Client déconnecté:", err)
+			return
+		}
+		switch req.Type {
+		case "subscribe":
+			session.subscribe(req)
+		case "unsubscribe":
+			session.unsubscribe(req)
+		default:
+			session.send(StreamFrame{Type: "error", ID: req.ID, Error: fmt.Sprintf("unknown message type %q", req.Type)})
+		}
+	}
+}
+
+func subscriptionID(req StreamRequest) string {
+	if req.ID != "" {
+		return req.ID
+	}
+	return req.Metric + "@" + req.Host
+}
+
+func (s *streamSession) subscribe(req StreamRequest) {
+	id := subscriptionID(req)
+	source, ok := monitoringSources[req.Metric]
+	if !ok {
+		s.send(StreamFrame{Type: "error", ID: id, Metric: req.Metric, Error: "unknown metric"})
+		return
+	}
+	interval := source.interval
+	if req.IntervalMs > 0 {
+		interval = clampInterval(req.IntervalMs)
+	}
+
+	s.mu.Lock()
+	if stop, exists := s.subscriptions[id]; exists {
+		// subscribing again replaces the previous subscription, e.g. to change the interval
+		close(stop)
+		delete(s.subscriptions, id)
+	}
+	if len(s.subscriptions) >= maxStreamSubscriptions {
+		s.mu.Unlock()
+		s.send(StreamFrame{Type: "error", ID: id, Error: "too many subscriptions"})
+		return
+	}
+	stop := make(chan struct{})
+	s.subscriptions[id] = stop
+	s.mu.Unlock()
+
+	s.send(StreamFrame{Type: "subscribed", ID: id, Metric: req.Metric, Host: req.Host})
+	backfill := backfillRequest{Last: req.Backfill, SinceID: req.SinceID, Since: req.Since}
+	if backfill.requested() {
+		go s.runSamples(id, req.Metric, req.Host, source, interval, backfill, stop)
+		return
+	}
+	go s.run(id, req.Metric, req.Host, source, interval, stop)
+}
+
+func (s *streamSession) unsubscribe(req StreamRequest) {
+	id := subscriptionID(req)
+	s.mu.Lock()
+	stop, ok := s.subscriptions[id]
+	if ok {
+		close(stop)
+		delete(s.subscriptions, id)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.send(StreamFrame{Type: "error", ID: id, Error: "unknown subscription"})
+		return
+	}
+	s.send(StreamFrame{Type: "unsubscribed", ID: id})
+}
+
+func (s *streamSession) run(id, metric, host string, source metricSource, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			value, err := source.data(host)
+			if err != nil {
+				log.Println("Erreur récupération data:", err)
+				continue
+			}
+			frame := StreamFrame{Type: "data", ID: id, Metric: metric, Host: host, Timestamp: time.Now().Unix(), Value: value}
+			if err := s.send(frame); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runSamples replays the recorded samples selected by backfill, then the
+// samples recorded afterwards, each frame carrying its sample ID.
+func (s *streamSession) runSamples(id, metric, host string, source metricSource, interval time.Duration, backfill backfillRequest, stop chan struct{}) {
+	historyHost := host
+	if historyHost == "" {
+		historyHost = collector.Hostname()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	cursor := backfill.cursor(historyHost)
+	for {
+		for _, data := range monitoringHistorySince(historyHost, cursor) {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			frame := StreamFrame{Type: "data", ID: id, Metric: metric, Host: host, Timestamp: data.Timestamp, SampleID: data.ID, Value: source.project(data)}
+			if err := s.client.SendWait(frame); err != nil {
+				return
+			}
+			cursor = data.ID
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *streamSession) send(frame StreamFrame) error {
+	return s.client.Send(frame)
+}
+
+func (s *streamSession) close() {
+	s.mu.Lock()
+	for id, stop := range s.subscriptions {
+		close(stop)
+		delete(s.subscriptions, id)
+	}
+	s.mu.Unlock()
+
+	s.client.Close()
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialStream(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/monitoring/stream?token=" + createTestToken()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	t.Cleanup(func() {
+		if err := conn.Close(); err != nil {
+			t.Logf("Failed to close connection: %v", err)
+		}
+	})
+	return conn
+}
+
+// readFrame skips data frames of other subscriptions
+func readFrame(t *testing.T, conn *websocket.Conn, frameType, id string) StreamFrame {
+	for {
+		var frame StreamFrame
+		require.NoError(t, conn.ReadJSON(&frame))
+		if frame.Type == frameType && frame.ID == id {
+			return frame
+		}
+	}
+}
+
+func TestMonitoringStreamSubscriptions(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	agentKey := enrollTestAgent(t, r, "test-stream-a")
+	w := pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{{Timestamp: 1, CPU: 12.5, Memory: 40}}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	agentKey = enrollTestAgent(t, r, "test-stream-b")
+	w = pushAgentSamples(r, agentKey, models.AgentSamples{Samples: []models.MonitoringData{{Timestamp: 1, CPU: 80}}})
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	conn := dialStream(t, ts)
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "subscribe", Metric: "cpu", Host: "test-stream-a", IntervalMs: 250}))
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "subscribe", ID: "b-cpu", Metric: "cpu", Host: "test-stream-b", IntervalMs: 250}))
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "subscribe", ID: "a-mem", Metric: "memory", Host: "test-stream-a", IntervalMs: 250}))
+
+	assert.Equal(t, "test-stream-a", readFrame(t, conn, "subscribed", "cpu@test-stream-a").Host)
+
+	frame := readFrame(t, conn, "data", "cpu@test-stream-a")
+	assert.Equal(t, "cpu", frame.Metric)
+	assert.Equal(t, 12.5, frame.Value)
+	assert.Equal(t, 80.0, readFrame(t, conn, "data", "b-cpu").Value)
+	assert.Equal(t, 40.0, readFrame(t, conn, "data", "a-mem").Value)
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "unsubscribe", ID: "b-cpu"}))
+	readFrame(t, conn, "unsubscribed", "b-cpu")
+	// after the unsubscribe only the other subscriptions keep flowing
+	for i := 0; i < 6; i++ {
+		var frame StreamFrame
+		require.NoError(t, conn.ReadJSON(&frame))
+		if i > 0 {
+			assert.NotEqual(t, "b-cpu", frame.ID)
+		}
+	}
+}
+
+func TestMonitoringStreamErrors(t *testing.T) {
+	r := createMonitoringTestServer(newMockHostService())
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	conn := dialStream(t, ts)
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "subscribe", ID: "x", Metric: "gpu"}))
+	assert.Equal(t, "unknown metric", readFrame(t, conn, "error", "x").Error)
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "unsubscribe", ID: "y"}))
+	assert.Equal(t, "unknown subscription", readFrame(t, conn, "error", "y").Error)
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{Type: "ping", ID: "z"}))
+	readFrame(t, conn, "error", "z")
+
+	_, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/monitoring/stream", nil)
+	assert.Error(t, err)
+}
@@ -1,22 +1,26 @@
 package handlers
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
-	authutil "back/internal/authutil"
 	"back/internal/services"
 
-	"github.com/golang-jwt/jwt/v5"
-
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"golang.org/x/sys/unix"
 )
 
 type TerminalCommand struct {
@@ -24,41 +28,67 @@ type TerminalCommand struct {
 	Command       string `json:"command"`
 	Output        string `json:"output"`
 	Error         string `json:"error"`
-	Status        int    `json:"status"`
+	Status        int    `json:"status"`           // exit code, 128+N when killed by signal N
+	Signal        string `json:"signal,omitempty"` // name of the signal that killed the command
+	State         string `json:"state,omitempty"`  // one of the TerminalState values
 	Time          int64  `json:"time"`
 	Target        string `json:"target,omitempty"`        // "host" or "container"
 	ContainerName string `json:"containerName,omitempty"` // for container target
 	UseSudo       bool   `json:"useSudo,omitempty"`
+	TimeoutMS     int    `json:"timeoutMs,omitempty"` // overrides the server default, TERMINAL_TIMEOUT_MS
 }
 
+// How a command ended.
+const (
+	TerminalStateSuccess   = "success"
+	TerminalStateError     = "error"
+	TerminalStateCancelled = "cancelled"
+	TerminalStateTimeout   = "timeout"
+)
+
+// defaultTerminalTimeout bounds the commands when neither the command nor
+// TERMINAL_TIMEOUT_MS set a timeout.
+const defaultTerminalTimeout = 10 * time.Minute
+
+// terminalKillGrace is how long a cancelled command has to exit after
+// SIGTERM before its process group is killed.
+const terminalKillGrace = 5 * time.Second
+
 type TerminalMessage struct {
 	Type    string            `json:"type"`
 	Command *TerminalCommand  `json:"command,omitempty"`
 	History []TerminalCommand `json:"history,omitempty"`
+	Running []TerminalCommand `json:"running,omitempty"` // answer to "list"
+	Stream  string            `json:"stream,omitempty"`  // "stdout" or "stderr" for a partial frame
+	Seq     int64             `json:"seq,omitempty"`     // order of the partial frames of a command
 }
 
-var terminalHistory []TerminalCommand
+// terminalHistoryOnConnect is how many of the last commands of the user are
+// sent when the terminal connects.
+const terminalHistoryOnConnect = 100
 
-func RegisterTerminalRoutes(r *gin.Engine, userService services.UserService) {
+func RegisterTerminalRoutes(r *gin.Engine, userService services.UserService, historyService services.TerminalHistoryService, auditService services.TerminalAuditService) {
 	r.GET("/terminal", func(c *gin.Context) {
-		handleTerminalWebSocket(c)
+		handleTerminalWebSocket(c, historyService, auditService)
+	})
+	r.GET("/terminal/pty", func(c *gin.Context) {
+		handleTerminalPTY(c, auditService)
 	})
 }
 
-func handleTerminalWebSocket(c *gin.Context) {
-	// Extract token from query
-	tokenString := c.Query("token")
-	if tokenString == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
-		return
-	}
-	token, err := jwt.ParseWithClaims(tokenString, &authutil.Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return authutil.GetJWTSecret(), nil
-	})
-	if err != nil || !token.Valid {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+// terminalUser is who runs the commands of a terminal connection.
+type terminalUser struct {
+	ID    string
+	Email string
+	IP    string
+}
+
+func handleTerminalWebSocket(c *gin.Context, historyService services.TerminalHistoryService, auditService services.TerminalAuditService) {
+	claims, ok := queryTokenClaims(c)
+	if !ok {
 		return
 	}
+	user := terminalUser{ID: claims.UserID, Email: claims.Email, IP: c.ClientIP()}
 
 	var upgrader = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool { return true },
@@ -76,12 +106,15 @@ func handleTerminalWebSocket(c *gin.Context) {
 		}
 	}()
 
+	session := newTerminalSession(conn, user, historyService, auditService)
+	defer session.close()
+
 	// Send initial history
 	historyMsg := TerminalMessage{
 		Type:    "history",
-		History: terminalHistory,
+		History: userTerminalHistory(historyService, claims.UserID),
 	}
-	if err := conn.WriteJSON(historyMsg); err != nil {
+	if err := session.send(historyMsg); err != nil {
 		log.Println("Error sending history:", err)
 		return
 	}
@@ -92,151 +125,379 @@ func handleTerminalWebSocket(c *gin.Context) {
 			log.Println("Error reading message:", err)
 			break
 		}
+		if msg.Type == "list" {
+			if err := session.send(TerminalMessage{Type: "list", Running: session.list()}); err != nil {
+				log.Println("Error sending running commands:", err)
+			}
+			continue
+		}
+		if msg.Command == nil {
+			continue
+		}
 
-		if msg.Type == "execute" && msg.Command != nil {
-			executeCommand(conn, msg.Command)
+		switch msg.Type {
+		case "execute":
+			session.start(msg.Command)
+		case "cancel":
+			if !session.cancel(msg.Command.ID) {
+				session.sendError(msg.Command, "No running command with this ID")
+			}
 		}
 	}
 }
 
-func executeCommand(conn *websocket.Conn, cmd *TerminalCommand) {
-	var writeMutex sync.Mutex
+// maxTerminalCommands bounds the commands running at once in a session.
+const maxTerminalCommands = 16
+
+// terminalSession runs the commands of a connection concurrently, in the
+// background, so that the connection keeps reading messages. Their frames
+// are routed by command ID.
+type terminalSession struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	user    terminalUser
+	history services.TerminalHistoryService
+	audit   services.TerminalAuditService
+
+	ctx     context.Context
+	stop    context.CancelFunc
+	mu      sync.Mutex
+	running map[string]*runningCommand
+	wg      sync.WaitGroup
+}
+
+type runningCommand struct {
+	cmd    TerminalCommand // as received, Time being the start
+	cancel context.CancelFunc
+}
+
+func newTerminalSession(conn *websocket.Conn, user terminalUser, history services.TerminalHistoryService, audit services.TerminalAuditService) *terminalSession {
+	ctx, stop := context.WithCancel(context.Background())
+	return &terminalSession{
+		conn:    conn,
+		user:    user,
+		history: history,
+		audit:   audit,
+		ctx:     ctx,
+		stop:    stop,
+		running: map[string]*runningCommand{},
+	}
+}
 
-	var execCmd *exec.Cmd
+func (s *terminalSession) send(msg TerminalMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteJSON(msg)
+}
+
+// start runs cmd next to the other commands of the session.
+func (s *terminalSession) start(cmd *TerminalCommand) {
+	s.mu.Lock()
+	if _, ok := s.running[cmd.ID]; ok {
+		s.mu.Unlock()
+		s.sendError(cmd, "A command with this ID is already running")
+		return
+	}
+	if len(s.running) >= maxTerminalCommands {
+		s.mu.Unlock()
+		s.sendError(cmd, fmt.Sprintf("Too many running commands (%d)", maxTerminalCommands))
+		return
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout := commandTimeout(cmd); timeout > 0 {
+		ctx, cancel = context.WithTimeout(s.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(s.ctx)
+	}
+	started := *cmd
+	started.Time = time.Now().Unix()
+	s.running[cmd.ID] = &runningCommand{cmd: started, cancel: cancel}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		start := time.Now()
+		startSeq, err := auditStarted(s.audit, s.user, commandAuditEntry(cmd), start)
+		if err != nil {
+			// never run unaudited
+			cancel()
+			s.mu.Lock()
+			delete(s.running, cmd.ID)
+			s.mu.Unlock()
+			s.sendError(cmd, "Failed to audit the command, not run")
+			return
+		}
+		msg := s.executeCommand(ctx, cmd)
+		cancel()
+		s.auditCommand(cmd, start, startSeq)
+		if msg.Type == "result" {
+			s.record(cmd)
+		}
+		// no longer listed once its result is sent
+		s.mu.Lock()
+		delete(s.running, cmd.ID)
+		s.mu.Unlock()
+		if err := s.send(msg); err != nil {
+			log.Println("Error sending final result:", err)
+		}
+	}()
+}
+
+// list returns the running commands, oldest first.
+func (s *terminalSession) list() []TerminalCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commands := make([]TerminalCommand, 0, len(s.running))
+	for _, r := range s.running {
+		commands = append(commands, r.cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if commands[i].Time != commands[j].Time {
+			return commands[i].Time < commands[j].Time
+		}
+		return commands[i].ID < commands[j].ID
+	})
+	return commands
+}
+
+func (s *terminalSession) cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.running[id]
+	if ok {
+		r.cancel()
+	}
+	return ok
+}
+
+// close cancels the commands left and waits for them to end.
+func (s *terminalSession) close() {
+	s.stop()
+	s.wg.Wait()
+}
+
+// commandTimeout is the timeout of cmd, from the command itself or
+// TERMINAL_TIMEOUT_MS, 0 meaning none.
+func commandTimeout(cmd *TerminalCommand) time.Duration {
+	if cmd.TimeoutMS > 0 {
+		return time.Duration(cmd.TimeoutMS) * time.Millisecond
+	}
+	if v := os.Getenv("TERMINAL_TIMEOUT_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil && ms >= 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return defaultTerminalTimeout
+}
+
+// terminalExec builds the process running cmd on its target, and the
+// remote process to stop when cmd is cancelled or times out.
+func terminalExec(ctx context.Context, cmd *TerminalCommand) (*exec.Cmd, remoteProcess, error) {
+	commandStr := cmd.Command
+	if cmd.UseSudo {
+		commandStr = "sudo " + commandStr
+	}
 
 	// Always run host commands via Docker socket for host access
 	switch cmd.Target {
 	case "host", "":
-		// Use Docker to run a privileged container with host root mounted
-		commandStr := cmd.Command
-		if cmd.UseSudo {
-			commandStr = "sudo " + commandStr
-		}
-		// Use Alpine as the helper container
-		execCmd = exec.Command(
-			"docker", "run", "--rm", "--privileged",
+		// Use Docker to run a privileged container with host root mounted,
+		// with Alpine as the helper container. It is named so that it can
+		// be stopped, and --init forwards the signals to the shell.
+		process := newHostProcess()
+		return exec.CommandContext(ctx,
+			"docker", "run", "--rm", "--init", "--name", process.name, "--privileged",
 			"-v", "/:/host", "alpine",
 			"chroot", "/host", "sh", "-c", commandStr,
-		)
+		), process, nil
 	case "container":
 		if cmd.ContainerName == "" {
-			sendError(conn, cmd, "Container name required for container target")
-			return
-		}
-		containerCmd := cmd.Command
-		if cmd.UseSudo {
-			containerCmd = "sudo " + containerCmd
+			return nil, remoteProcess{}, errors.New("Container name required for container target")
 		}
-		execCmd = exec.Command("docker", "exec", cmd.ContainerName, "sh", "-c", containerCmd)
+		process := newContainerProcess(cmd.ContainerName)
+		return exec.CommandContext(ctx, "docker", "exec", cmd.ContainerName,
+			"sh", "-c", terminalExecWrapper, process.pidFile, commandStr), process, nil
 	default:
 		// Fallback: run in container (should not be used)
-		commandStr := cmd.Command
-		if cmd.UseSudo {
-			commandStr = "sudo " + commandStr
-		}
-		execCmd = exec.Command("sh", "-c", commandStr)
+		return exec.CommandContext(ctx, "sh", "-c", commandStr), remoteProcess{}, nil
 	}
+}
 
-	// Capture stdout and stderr
-	stdout, err := execCmd.StdoutPipe()
-	if err != nil {
-		sendError(conn, cmd, fmt.Sprintf("Failed to create stdout pipe: %v", err))
-		return
-	}
+// commandOutput sends the stdout and stderr of a command as partial frames
+// carrying each new chunk, numbered in the order they are read, and keeps
+// the whole output for the result.
+type commandOutput struct {
+	session *terminalSession
+	cmd     *TerminalCommand
+
+	mu          sync.Mutex
+	seq         int64
+	output      strings.Builder
+	errorOutput strings.Builder
+}
 
-	stderr, err := execCmd.StderrPipe()
-	if err != nil {
-		sendError(conn, cmd, fmt.Sprintf("Failed to create stderr pipe: %v", err))
-		return
-	}
+// streamWriter is the stdout or stderr of a command.
+type streamWriter struct {
+	out     *commandOutput
+	stream  string
+	pending []byte // incomplete UTF-8 sequence at the end of the last write
+}
 
-	if err := execCmd.Start(); err != nil {
-		sendError(conn, cmd, fmt.Sprintf("Failed to start command: %v", err))
-		return
-	}
+func (o *commandOutput) writer(stream string) *streamWriter {
+	return &streamWriter{out: o, stream: stream}
+}
 
-	var output strings.Builder
-	var errorOutput strings.Builder
+func (w *streamWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	n := completeUTF8(data)
+	w.pending = append([]byte(nil), data[n:]...)
+	w.out.emit(w.stream, data[:n])
+	return len(p), nil
+}
 
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			line := scanner.Text()
-			output.WriteString(line + "\n")
-
-			partialCmd := &TerminalCommand{
-				ID:      cmd.ID,
-				Command: cmd.Command,
-				Output:  output.String(),
-				Time:    time.Now().Unix(),
-			}
+// Flush sends what is left, valid UTF-8 or not.
+func (w *streamWriter) Flush() {
+	w.out.emit(w.stream, w.pending)
+	w.pending = nil
+}
 
-			partialMsg := TerminalMessage{
-				Type:    "partial",
-				Command: partialCmd,
-			}
+func (o *commandOutput) emit(stream string, chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	partialCmd := &TerminalCommand{
+		ID:      o.cmd.ID,
+		Command: o.cmd.Command,
+		Time:    time.Now().Unix(),
+	}
+	if stream == "stderr" {
+		o.errorOutput.Write(chunk)
+		partialCmd.Error = string(chunk)
+	} else {
+		o.output.Write(chunk)
+		partialCmd.Output = string(chunk)
+	}
+	msg := TerminalMessage{Type: "partial", Command: partialCmd, Stream: stream, Seq: o.seq}
+	if err := o.session.send(msg); err != nil {
+		log.Println("Error sending partial output:", err)
+	}
+}
 
-			writeMutex.Lock()
-			if err := conn.WriteJSON(partialMsg); err != nil {
-				log.Println("Error sending partial output:", err)
-				writeMutex.Unlock()
-				return
+// completeUTF8 returns the length of b without the rune cut at its end, if any.
+func completeUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
 			}
-			writeMutex.Unlock()
+			break
 		}
-	}()
+	}
+	return len(b)
+}
 
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			errorOutput.WriteString(line + "\n")
-		}
-	}()
+// executeCommand runs cmd, sending its output as it comes, and returns the
+// result message.
+func (s *terminalSession) executeCommand(ctx context.Context, cmd *TerminalCommand) TerminalMessage {
+	execCmd, process, err := terminalExec(ctx, cmd)
+	if err != nil {
+		return errorMessage(cmd, err.Error())
+	}
+	// Cancelling the command stops it where docker runs it, then the local
+	// docker client, which runs in its own process group so that its
+	// children stop too: SIGTERM first, SIGKILL after a grace period.
+	execCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	execCmd.Cancel = func() error {
+		process.stop("TERM")
+		return syscall.Kill(-execCmd.Process.Pid, syscall.SIGTERM)
+	}
+	execCmd.WaitDelay = terminalKillGrace
+
+	// Output goes through writers rather than pipes, so that Wait returns
+	// once all of it has been read.
+	out := &commandOutput{session: s, cmd: cmd}
+	stdout := out.writer("stdout")
+	stderr := out.writer("stderr")
+	execCmd.Stdout = stdout
+	execCmd.Stderr = stderr
+
+	if err := execCmd.Start(); err != nil {
+		return errorMessage(cmd, fmt.Sprintf("Failed to start command: %v", err))
+	}
 
 	err = execCmd.Wait()
+	if ctx.Err() != nil {
+		// children ignoring SIGTERM or left behind by the shell
+		_ = syscall.Kill(-execCmd.Process.Pid, syscall.SIGKILL)
+	}
+	stdout.Flush()
+	stderr.Flush()
+
+	cmd.Output = out.output.String()
+	cmd.Error = out.errorOutput.String()
+	cmd.Status, cmd.Signal = exitStatus(execCmd.ProcessState)
+	return finishCommand(ctx, cmd, err)
+}
 
-	cmd.Output = output.String()
-	cmd.Error = errorOutput.String()
+// exitStatus returns the exit code of a process, or 128 plus the signal
+// number and the signal name when it was killed, as shells do.
+func exitStatus(state *os.ProcessState) (int, string) {
+	if state == nil {
+		return -1, ""
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), unix.SignalName(ws.Signal())
+	}
+	return state.ExitCode(), ""
+}
+
+// finishCommand sets the state of cmd from how it ended, with its output
+// and status.
+func finishCommand(ctx context.Context, cmd *TerminalCommand, err error) TerminalMessage {
 	cmd.Time = time.Now().Unix()
 
-	if err != nil {
-		cmd.Status = 1
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		cmd.State = TerminalStateTimeout
+		if cmd.Error == "" {
+			cmd.Error = fmt.Sprintf("Command timed out after %s", commandTimeout(cmd))
+		}
+	case ctx.Err() != nil:
+		cmd.State = TerminalStateCancelled
 		if cmd.Error == "" {
+			cmd.Error = "Command cancelled"
+		}
+	case err != nil || cmd.Status != 0:
+		cmd.State = TerminalStateError
+		if cmd.Error == "" && err != nil {
 			cmd.Error = err.Error()
 		}
-	} else {
-		cmd.Status = 0
-	}
-
-	terminalHistory = append(terminalHistory, *cmd)
-	if len(terminalHistory) > 100 {
-		terminalHistory = terminalHistory[len(terminalHistory)-100:]
-	}
-
-	finalMsg := TerminalMessage{
-		Type:    "result",
-		Command: cmd,
+	default:
+		cmd.State = TerminalStateSuccess
 	}
 
-	writeMutex.Lock()
-	if err := conn.WriteJSON(finalMsg); err != nil {
-		log.Println("Error sending final result:", err)
-	}
-	writeMutex.Unlock()
+	return TerminalMessage{Type: "result", Command: cmd}
 }
 
-func sendError(conn *websocket.Conn, cmd *TerminalCommand, errorMsg string) {
+func errorMessage(cmd *TerminalCommand, errorMsg string) TerminalMessage {
 	cmd.Error = errorMsg
 	cmd.Status = 1
+	cmd.State = TerminalStateError
 	cmd.Time = time.Now().Unix()
 
-	msg := TerminalMessage{
+	return TerminalMessage{
 		Type:    "error",
 		Command: cmd,
 	}
+}
 
-	if err := conn.WriteJSON(msg); err != nil {
+func (s *terminalSession) sendError(cmd *TerminalCommand, errorMsg string) {
+	if err := s.send(errorMessage(cmd, errorMsg)); err != nil {
 		log.Println("Error sending error message:", err)
 	}
 }
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	authutil "back/internal/authutil"
+	models "back/internal/domain"
+	"back/internal/repositories"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterTerminalAuditRoutes registers the export and the verification of
+// the terminal audit log, restricted to the administrators.
+func RegisterTerminalAuditRoutes(r *gin.RouterGroup, auditService services.TerminalAuditService) {
+	audit := r.Group("/terminal/audit")
+	{
+		audit.GET("/export", func(c *gin.Context) { ExportTerminalAudit(c, auditService) })
+		audit.GET("/verify", func(c *gin.Context) { VerifyTerminalAudit(c, auditService) })
+	}
+}
+
+func requireAdmin(c *gin.Context) bool {
+	if !authutil.IsAdmin(c.GetString("user_email")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Administrators only"})
+		return false
+	}
+	return true
+}
+
+var terminalAuditColumns = []string{
+	"seq", "time", "user_id", "user_email", "source_ip", "mode", "command", "target", "container_name",
+	"use_sudo", "exit_code", "signal", "state", "duration_ms", "output_hash", "start_seq", "prev_hash", "hash",
+}
+
+// ExportTerminalAudit streams the audit log in sequence order, as NDJSON
+// (default) or CSV, with the hashes to verify it offline.
+//
+// Query parameters: format (ndjson or csv), after (sequence number), from and
+// to (unix seconds, inclusive).
+func ExportTerminalAudit(c *gin.Context, auditService services.TerminalAuditService) {
+	if !requireAdmin(c) {
+		return
+	}
+	format := c.DefaultQuery("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format", "details": fmt.Sprintf("unknown format %q", format)})
+		return
+	}
+	var filter repositories.TerminalAuditFilter
+	if v := c.Query("after"); v != "" {
+		after, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid after", "details": "must be a non-negative integer"})
+			return
+		}
+		filter.AfterSeq = after
+	}
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(name); v != "" {
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || sec < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name, "details": "must be a non-negative integer"})
+				return
+			}
+			*dst = time.Unix(sec, 0)
+		}
+	}
+	if !filter.To.IsZero() {
+		filter.To = filter.To.Add(time.Second - time.Millisecond)
+	}
+
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="terminal-audit.%s"`, format))
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	csvWriter := csv.NewWriter(c.Writer)
+	if format == "csv" {
+		if err := csvWriter.Write(terminalAuditColumns); err != nil {
+			log.Println("Export de l'audit interrompu:", err)
+			return
+		}
+	}
+	for {
+		entries, err := auditService.Entries(filter)
+		if err != nil {
+			log.Println("Export de l'audit interrompu:", err)
+			return
+		}
+		for _, entry := range entries {
+			if format == "csv" {
+				err = csvWriter.Write(auditRecord(entry))
+			} else {
+				err = encoder.Encode(entry)
+			}
+			if err != nil {
+				log.Println("Export de l'audit interrompu:", err)
+				return
+			}
+			filter.AfterSeq = entry.Seq
+		}
+		csvWriter.Flush()
+		c.Writer.Flush()
+		if len(entries) == 0 {
+			return
+		}
+	}
+}
+
+func auditRecord(entry models.TerminalAuditEntry) []string {
+	return []string{
+		strconv.FormatUint(entry.Seq, 10),
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		entry.UserID,
+		entry.UserEmail,
+		entry.SourceIP,
+		entry.Mode,
+		entry.Command,
+		entry.Target,
+		entry.ContainerName,
+		strconv.FormatBool(entry.UseSudo),
+		strconv.Itoa(entry.ExitCode),
+		entry.Signal,
+		entry.State,
+		strconv.FormatInt(entry.DurationMS, 10),
+		entry.OutputHash,
+		strconv.FormatUint(entry.StartSeq, 10),
+		entry.PrevHash,
+		entry.Hash,
+	}
+}
+
+// VerifyTerminalAudit checks the hash chain of the whole audit log, and that
+// it still holds the anchor given by anchor_seq, anchor_hash and
+// anchor_signature, or else the one of the anchor file. Without an anchor,
+// the removal of the last entries goes unnoticed.
+func VerifyTerminalAudit(c *gin.Context, auditService services.TerminalAuditService) {
+	if !requireAdmin(c) {
+		return
+	}
+	var anchor *services.AuditAnchor
+	if v := c.Query("anchor_seq"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || seq == 0 || c.Query("anchor_hash") == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid anchor", "details": "anchor_seq must be a positive integer, with anchor_hash"})
+			return
+		}
+		anchor = &services.AuditAnchor{Seq: seq, Hash: c.Query("anchor_hash"), Signature: c.Query("anchor_signature")}
+	}
+	result, err := auditService.Verify(anchor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify the audit log", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// TerminalStateStarted is the state of the entry appended to the audit log
+// before a command or a session starts.
+const TerminalStateStarted = "started"
+
+// ptyAuditLineMax bounds the input lines of a PTY session in the audit log;
+// longer ones are cut into several entries.
+const ptyAuditLineMax = 64 << 10
+
+// commandAuditEntry is the audit entry of a command of the session.
+func commandAuditEntry(cmd *TerminalCommand) models.TerminalAuditEntry {
+	target := cmd.Target
+	if target == "" {
+		target = "host"
+	}
+	return models.TerminalAuditEntry{
+		Mode:          "command",
+		Command:       cmd.Command,
+		Target:        target,
+		ContainerName: cmd.ContainerName,
+		UseSudo:       cmd.UseSudo,
+	}
+}
+
+// auditCommand appends the end of a command of the session, started by the
+// entry startSeq, to the audit log.
+func (s *terminalSession) auditCommand(cmd *TerminalCommand, start time.Time, startSeq uint64) {
+	output := sha256.New()
+	output.Write([]byte(cmd.Output))
+	output.Write([]byte{0})
+	output.Write([]byte(cmd.Error))
+	entry := commandAuditEntry(cmd)
+	entry.ExitCode = cmd.Status
+	entry.Signal = cmd.Signal
+	entry.State = cmd.State
+	auditTerminal(s.audit, s.user, &entry, start, startSeq, output)
+}
+
+// auditStarted appends entry, a command or a session about to start, to the
+// audit log and returns its sequence number. The command or the session must
+// not start when it fails: it would run unaudited.
+func auditStarted(auditService services.TerminalAuditService, user terminalUser, entry models.TerminalAuditEntry, start time.Time) (uint64, error) {
+	if auditService == nil {
+		return 0, nil
+	}
+	entry.Time = start
+	entry.State = TerminalStateStarted
+	if err := recordAudit(auditService, user, &entry); err != nil {
+		return 0, err
+	}
+	return entry.Seq, nil
+}
+
+// auditTerminal completes entry with the timing, the output hash and the
+// entry startSeq it ends, and appends it to the audit log.
+func auditTerminal(auditService services.TerminalAuditService, user terminalUser, entry *models.TerminalAuditEntry, start time.Time, startSeq uint64, output hash.Hash) {
+	entry.Time = start
+	entry.DurationMS = time.Since(start).Milliseconds()
+	entry.OutputHash = hex.EncodeToString(output.Sum(nil))
+	entry.StartSeq = startSeq
+	_ = recordAudit(auditService, user, entry)
+}
+
+// auditPTYInput appends a line submitted to the shell of session, started
+// by the entry startSeq, to the audit log. The line is the raw keystrokes,
+// control characters included.
+func auditPTYInput(auditService services.TerminalAuditService, user terminalUser, session models.TerminalAuditEntry, startSeq uint64, line string) {
+	_ = recordAudit(auditService, user, &models.TerminalAuditEntry{
+		Time:          time.Now(),
+		Mode:          "pty-input",
+		Command:       line,
+		Target:        session.Target,
+		ContainerName: session.ContainerName,
+		StartSeq:      startSeq,
+	})
+}
+
+// recordAudit completes entry with the user and appends it to the audit log.
+func recordAudit(auditService services.TerminalAuditService, user terminalUser, entry *models.TerminalAuditEntry) error {
+	if auditService == nil {
+		return nil
+	}
+	entry.UserID = user.ID
+	entry.UserEmail = user.Email
+	entry.SourceIP = user.IP
+	if err := auditService.Record(entry); err != nil {
+		log.Println("Erreur d'écriture dans l'audit du terminal:", err)
+		return err
+	}
+	return nil
+}
+
+// ptyInputLines splits the input of a PTY session into the lines submitted
+// with Enter.
+type ptyInputLines struct {
+	line []byte
+}
+
+// add returns the lines that data completes, empty ones left out.
+func (p *ptyInputLines) add(data []byte) []string {
+	var lines []string
+	for _, b := range data {
+		if b != '\r' && b != '\n' {
+			p.line = append(p.line, b)
+			if len(p.line) < ptyAuditLineMax {
+				continue
+			}
+		}
+		if len(p.line) > 0 {
+			lines = append(lines, string(p.line))
+			p.line = p.line[:0]
+		}
+	}
+	return lines
+}
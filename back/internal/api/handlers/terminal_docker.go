@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// terminalExecWrapper runs the command "$1" of a docker exec in the
+// background, in its own session when setsid is available, and writes its
+// PID to the file "$0" while it runs, so that stopRemote can reach it:
+// stopping the local docker client leaves the command running in the
+// container.
+const terminalExecWrapper = `if command -v setsid >/dev/null 2>&1; then setsid sh -c "$1" & else sh -c "$1" & fi
+echo $! > "$0"; wait $!; s=$?; rm -f "$0"; exit $s`
+
+// terminalPTYWrapper writes the PID of the shell of a PTY session to the
+// file "$0".
+const terminalPTYWrapper = `echo $$ > "$0"; exec sh -l`
+
+// terminalExecStop sends the signal "$2" to the process group whose leader
+// PID is in the file "$0" (or to the process alone), waits for it to exit
+// up to "$1" seconds, then sends SIGKILL.
+const terminalExecStop = `p=$(cat "$0" 2>/dev/null) || exit 0
+kill -s "$2" -- -"$p" 2>/dev/null || kill -s "$2" "$p" 2>/dev/null
+i=0; while kill -0 "$p" 2>/dev/null && [ $i -lt "$1" ]; do sleep 1; i=$((i+1)); done
+kill -0 "$p" 2>/dev/null && { kill -s KILL -- -"$p" 2>/dev/null || kill -s KILL "$p" 2>/dev/null; }
+rm -f "$0"`
+
+// remoteProcess is where docker runs a command or a shell: a container
+// started for it (name), or a process of an existing container (container,
+// with its PID in pidFile).
+type remoteProcess struct {
+	name      string
+	container string
+	pidFile   string
+}
+
+// newHostProcess names the container started for a command on the host.
+func newHostProcess() remoteProcess {
+	return remoteProcess{name: "monitoverse-cmd-" + uuid.NewString()}
+}
+
+// newContainerProcess is a command run in container through
+// terminalExecWrapper.
+func newContainerProcess(container string) remoteProcess {
+	return remoteProcess{container: container, pidFile: "/tmp/monitoverse-cmd-" + uuid.NewString() + ".pid"}
+}
+
+// stop terminates the process, with signal (TERM, or HUP for a shell)
+// first and SIGKILL after terminalKillGrace, and removes the container
+// started for it. Stopping a process already gone does nothing.
+func (p remoteProcess) stop(signal string) {
+	grace := fmt.Sprint(int(terminalKillGrace.Seconds()))
+	switch {
+	case p.name != "":
+		if signal != "TERM" {
+			runDocker("kill", "--signal", signal, p.name)
+		}
+		runDocker("stop", "--time", grace, p.name)
+		runDocker("rm", "--force", p.name)
+	case p.pidFile != "":
+		runDocker("exec", p.container, "sh", "-c", terminalExecStop, p.pidFile, grace, signal)
+	}
+}
+
+// runDocker runs a docker command stopping a process. The command being
+// over or cancelled by then, it has a timeout of its own; a container
+// already gone, or being removed by --rm, is not an error.
+func runDocker(args ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*terminalKillGrace)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "No such container") && !strings.Contains(string(out), "already in progress") {
+		log.Printf("Erreur docker %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	authutil "back/internal/authutil"
+	models "back/internal/domain"
+	"back/internal/repositories"
+	"back/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterTerminalHistoryRoutes registers the search in the terminal history.
+func RegisterTerminalHistoryRoutes(r *gin.RouterGroup, historyService services.TerminalHistoryService) {
+	r.GET("/terminal/history", func(c *gin.Context) { GetTerminalHistory(c, historyService) })
+}
+
+// GetTerminalHistory returns a page of the commands of the user, newest
+// first. Administrators (ADMIN_EMAILS) see the commands of every user.
+//
+// Query parameters: q (substring of the command or its output), page (from
+// 1), limit (50 by default) and, for administrators, user (a user ID).
+func GetTerminalHistory(c *gin.Context, historyService services.TerminalHistoryService) {
+	userID := c.GetString("user_id")
+	admin := authutil.IsAdmin(c.GetString("user_email"))
+	filter := repositories.TerminalHistoryFilter{UserID: userID, Search: c.Query("q")}
+	switch user := c.Query("user"); {
+	case user == "" && admin:
+		filter.UserID = "" // every user
+	case user == "" || user == userID:
+	case !admin:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can read the history of other users"})
+		return
+	default:
+		filter.UserID = user
+	}
+
+	page := 1
+	for name, dst := range map[string]*int{"page": &page, "limit": &filter.Limit} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name, "details": "must be a positive integer"})
+				return
+			}
+			*dst = n
+		}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = services.TerminalHistoryDefaultLimit
+	}
+	filter.Limit = min(filter.Limit, services.TerminalHistoryMaxLimit)
+	filter.Offset = (page - 1) * filter.Limit
+
+	records, total, err := historyService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the terminal history", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": records, "total": total, "page": page, "limit": filter.Limit})
+}
+
+// userTerminalHistory returns the last commands of a user, oldest first.
+func userTerminalHistory(historyService services.TerminalHistoryService, userID string) []TerminalCommand {
+	if historyService == nil {
+		return nil
+	}
+	records, _, err := historyService.List(repositories.TerminalHistoryFilter{UserID: userID, Limit: terminalHistoryOnConnect})
+	if err != nil {
+		log.Println("Erreur de lecture de l'historique du terminal:", err)
+		return nil
+	}
+	history := make([]TerminalCommand, len(records))
+	for i, record := range records {
+		history[len(records)-1-i] = TerminalCommand{
+			ID:            record.CommandID,
+			Command:       record.Command,
+			Output:        record.Output,
+			Error:         record.Error,
+			Status:        record.Status,
+			Signal:        record.Signal,
+			State:         record.State,
+			Time:          record.CreatedAt.Unix(),
+			Target:        record.Target,
+			ContainerName: record.ContainerName,
+			UseSudo:       record.UseSudo,
+		}
+	}
+	return history
+}
+
+// record stores a finished command in the history of the user.
+func (s *terminalSession) record(cmd *TerminalCommand) {
+	if s.history == nil {
+		return
+	}
+	err := s.history.Record(&models.TerminalCommandRecord{
+		UserID:        s.user.ID,
+		CommandID:     cmd.ID,
+		Command:       cmd.Command,
+		Output:        cmd.Output,
+		Error:         cmd.Error,
+		Status:        cmd.Status,
+		Signal:        cmd.Signal,
+		State:         cmd.State,
+		Target:        cmd.Target,
+		ContainerName: cmd.ContainerName,
+		UseSudo:       cmd.UseSudo,
+	})
+	if err != nil {
+		log.Println("Erreur d'enregistrement dans l'historique du terminal:", err)
+	}
+}
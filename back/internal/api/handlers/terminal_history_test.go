@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	authutil "back/internal/authutil"
+	models "back/internal/domain"
+	"back/internal/repositories"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTerminalHistoryService struct {
+	mu      sync.Mutex
+	records []models.TerminalCommandRecord
+}
+
+func newMockTerminalHistoryService() *mockTerminalHistoryService {
+	return &mockTerminalHistoryService{}
+}
+
+func (m *mockTerminalHistoryService) Record(record *models.TerminalCommandRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record.ID = fmt.Sprintf("record-%d", len(m.records)+1)
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	m.records = append(m.records, *record)
+	return nil
+}
+
+func (m *mockTerminalHistoryService) List(filter repositories.TerminalHistoryFilter) ([]models.TerminalCommandRecord, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matching []models.TerminalCommandRecord
+	for _, record := range m.records {
+		if filter.UserID != "" && record.UserID != filter.UserID {
+			continue
+		}
+		if filter.Search != "" && !strings.Contains(record.Command, filter.Search) && !strings.Contains(record.Output, filter.Search) {
+			continue
+		}
+		matching = append(matching, record)
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].CreatedAt.After(matching[j].CreatedAt) })
+	from := min(filter.Offset, len(matching))
+	to := min(from+filter.Limit, len(matching))
+	return matching[from:to], int64(len(matching)), nil
+}
+
+func createTerminalHistoryTestServer(history *mockTerminalHistoryService, userID, email string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("")
+	protected.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("user_email", email)
+	})
+	RegisterTerminalHistoryRoutes(protected, history)
+	return r
+}
+
+type terminalHistoryPage struct {
+	Items []models.TerminalCommandRecord `json:"items"`
+	Total int64                          `json:"total"`
+	Page  int                            `json:"page"`
+	Limit int                            `json:"limit"`
+}
+
+func getTerminalHistory(t *testing.T, r *gin.Engine, query string) (int, terminalHistoryPage) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/terminal/history"+query, nil))
+	var page terminalHistoryPage
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	}
+	return w.Code, page
+}
+
+func TestTerminalHistoryIsPerUser(t *testing.T) {
+	history := newMockTerminalHistoryService()
+	start := time.Now()
+	for i := range 5 {
+		user := "alice"
+		if i%2 == 1 {
+			user = "bob"
+		}
+		require.NoError(t, history.Record(&models.TerminalCommandRecord{
+			UserID:    user,
+			CommandID: fmt.Sprint(i),
+			Command:   fmt.Sprintf("echo %s-%d", user, i),
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		}))
+	}
+	t.Setenv("ADMIN_EMAILS", "root@example.com, admin@example.com")
+
+	alice := createTerminalHistoryTestServer(history, "alice", "alice@example.com")
+	code, page := getTerminalHistory(t, alice, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Items, 3)
+	assert.Equal(t, "echo alice-4", page.Items[0].Command) // newest first
+
+	code, page = getTerminalHistory(t, alice, "?limit=2&page=2")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, page.Page)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "echo alice-0", page.Items[0].Command)
+
+	code, page = getTerminalHistory(t, alice, "?q=alice-2")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "2", page.Items[0].CommandID)
+
+	code, _ = getTerminalHistory(t, alice, "?user=bob")
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = getTerminalHistory(t, alice, "?page=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	admin := createTerminalHistoryTestServer(history, "carol", "Admin@example.com")
+	code, page = getTerminalHistory(t, admin, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(5), page.Total)
+	code, page = getTerminalHistory(t, admin, "?user=bob")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(2), page.Total)
+}
+
+func TestTerminalRecordsCommandsOfTheUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	history := newMockTerminalHistoryService()
+	RegisterTerminalRoutes(r, &mockUserService{}, history, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	dial := func(userID string) (*websocket.Conn, TerminalMessage) {
+		claims := &authutil.Claims{UserID: userID, Email: userID + "@example.com"}
+		createTestToken() // sets JWT_SECRET
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(authutil.GetJWTSecret())
+		require.NoError(t, err)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/terminal?token="+token, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		var historyMsg TerminalMessage
+		require.NoError(t, conn.ReadJSON(&historyMsg))
+		return conn, historyMsg
+	}
+
+	conn, historyMsg := dial("alice")
+	assert.Empty(t, historyMsg.History)
+	for i := range 2 {
+		sendTerminal(t, conn, "execute", &TerminalCommand{ID: fmt.Sprint(i), Command: fmt.Sprintf("echo %d; exit %d", i, i), UseSudo: false})
+		_, err := readUntilResult(conn)
+		require.NoError(t, err)
+	}
+
+	records, _, err := history.List(repositories.TerminalHistoryFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "alice", records[0].UserID)
+	assert.Equal(t, "1\n", records[0].Output)
+	assert.Equal(t, 1, records[0].Status)
+	assert.Equal(t, TerminalStateError, records[0].State)
+
+	// the history sent on connect is the user's own, oldest first
+	_, historyMsg = dial("alice")
+	require.Len(t, historyMsg.History, 2)
+	assert.Equal(t, "0", historyMsg.History[0].ID)
+	assert.Equal(t, "1", historyMsg.History[1].ID)
+	_, historyMsg = dial("bob")
+	assert.Empty(t, historyMsg.History)
+}
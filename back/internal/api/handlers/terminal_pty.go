@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	models "back/internal/domain"
+	"back/internal/services"
+
+	"github.com/creack/pty"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Default size of a PTY session until the client sends a resize.
+const (
+	defaultPTYCols = 80
+	defaultPTYRows = 24
+)
+
+// PTYControl is a control message of a PTY session, sent as a text frame.
+// The client sends "resize"; the server sends "exit" when the shell ends.
+type PTYControl struct {
+	Type   string `json:"type"`
+	Cols   uint16 `json:"cols,omitempty"`
+	Rows   uint16 `json:"rows,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ptyShell builds the interactive shell of a session on the host or in a
+// container, the way executeCommand runs one-shot commands, and the remote
+// process to stop when the session ends.
+func ptyShell(target, container string) (*exec.Cmd, remoteProcess, error) {
+	var cmd *exec.Cmd
+	var process remoteProcess
+	switch target {
+	case "host", "":
+		process = newHostProcess()
+		cmd = exec.Command(
+			"docker", "run", "--rm", "-it", "--init", "--name", process.name, "--privileged",
+			"-v", "/:/host", "alpine",
+			"chroot", "/host", "sh", "-l",
+		)
+	case "container":
+		if container == "" {
+			return nil, process, errors.New("container name required for container target")
+		}
+		process = newContainerProcess(container)
+		cmd = exec.Command("docker", "exec", "-it", container, "sh", "-c", terminalPTYWrapper, process.pidFile)
+	default:
+		return nil, process, fmt.Errorf("unknown target %q", target)
+	}
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	return cmd, process, nil
+}
+
+func ptySize(c *gin.Context, name string, def uint16) (uint16, error) {
+	v := c.Query(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 16)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return uint16(n), nil
+}
+
+// handleTerminalPTY runs an interactive shell behind a pseudo-terminal, so
+// that full-screen programs (top, vim, less) work and the shell keeps its
+// state between commands. Binary frames carry the raw bytes of stdin and
+// stdout; text frames carry PTYControl messages.
+//
+// Query parameters: token, target (host or container), container, cols and rows.
+func handleTerminalPTY(c *gin.Context, auditService services.TerminalAuditService) {
+	claims, ok := queryTokenClaims(c)
+	if !ok {
+		return
+	}
+	user := terminalUser{ID: claims.UserID, Email: claims.Email, IP: c.ClientIP()}
+	cols, err := ptySize(c, "cols", defaultPTYCols)
+	var rows uint16
+	if err == nil {
+		rows, err = ptySize(c, "rows", defaultPTYRows)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size", "details": err.Error()})
+		return
+	}
+	cmd, process, err := ptyShell(c.Query("target"), c.Query("container"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target", "details": err.Error()})
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	start := time.Now()
+	output := sha256.New() // of the whole session, for the audit log
+	audit := &models.TerminalAuditEntry{
+		Mode:          "pty",
+		Command:       strings.Join(cmd.Args, " "),
+		Target:        c.DefaultQuery("target", "host"),
+		ContainerName: c.Query("container"),
+	}
+	session := *audit // for the input lines
+	startSeq, err := auditStarted(auditService, user, session, start)
+	if err != nil {
+		// never run unaudited
+		_ = conn.WriteJSON(PTYControl{Type: "exit", Status: -1, Error: "Failed to audit the session, not started"})
+		return
+	}
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: cols, Rows: rows})
+	if err != nil {
+		_ = conn.WriteJSON(PTYControl{Type: "exit", Status: -1, Error: err.Error()})
+		audit.ExitCode, audit.State = -1, TerminalStateError
+		auditTerminal(auditService, user, audit, start, startSeq, output)
+		return
+	}
+	defer func() { _ = ptmx.Close() }()
+
+	// The shell output goes to the client until the PTY is hung up, which
+	// happens when the shell exits.
+	var reading sync.WaitGroup
+	reading.Add(1)
+	go func() {
+		defer reading.Done()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := ptmx.Read(buf)
+			if n > 0 {
+				output.Write(buf[:n])
+				if werr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		var input ptyInputLines
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				// Client gone: hang up the session.
+				_ = ptmx.Close()
+				_ = cmd.Process.Signal(syscall.SIGHUP)
+				return
+			}
+			if kind == websocket.BinaryMessage {
+				// audited before the shell reads them
+				for _, line := range input.add(data) {
+					auditPTYInput(auditService, user, session, startSeq, line)
+				}
+				if _, err := ptmx.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+			var ctl PTYControl
+			if err := json.Unmarshal(data, &ctl); err != nil {
+				log.Println("Message de contrôle PTY invalide:", err)
+				continue
+			}
+			if ctl.Type == "resize" && ctl.Cols > 0 && ctl.Rows > 0 {
+				if err := pty.Setsize(ptmx, &pty.Winsize{Cols: ctl.Cols, Rows: ctl.Rows}); err != nil {
+					log.Println("Erreur de redimensionnement PTY:", err)
+				}
+			}
+		}
+	}()
+
+	reading.Wait()
+	err = cmd.Wait()
+	status := PTYControl{Type: "exit"}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		status.Status = exitErr.ExitCode()
+	case err != nil:
+		status.Status = -1
+		status.Error = err.Error()
+	}
+	audit.ExitCode, audit.Signal = exitStatus(cmd.ProcessState)
+	audit.State = TerminalStateSuccess
+	if err != nil {
+		audit.State = TerminalStateError
+	}
+	auditTerminal(auditService, user, audit, start, startSeq, output)
+	if werr := conn.WriteJSON(status); werr == nil {
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}
+	_ = conn.Close()
+	// The hang-up only reached the local docker client: the shell and its
+	// jobs may still run where docker started them.
+	process.stop("HUP")
+	<-exited
+}
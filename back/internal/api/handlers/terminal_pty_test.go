@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialPTY(t *testing.T, ts *httptest.Server, query string) *websocket.Conn {
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/terminal/pty?token=" + createTestToken() + query
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// readPTYUntil reads the output of the session until it contains want.
+func readPTYUntil(t *testing.T, conn *websocket.Conn, want string) string {
+	var output strings.Builder
+	for !strings.Contains(output.String(), want) {
+		kind, data, err := conn.ReadMessage()
+		require.NoError(t, err, "output so far: %q", output.String())
+		require.Equal(t, websocket.BinaryMessage, kind, "unexpected frame %s", data)
+		output.Write(data)
+	}
+	return output.String()
+}
+
+func sendPTY(t *testing.T, conn *websocket.Conn, input string) {
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte(input)))
+}
+
+func TestTerminalPTYSession(t *testing.T) {
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialPTY(t, ts, "&cols=100&rows=30")
+
+	// the shell keeps its state between commands
+	sendPTY(t, conn, "cd /tmp && export GREETING=bonjour\n")
+	sendPTY(t, conn, "echo \"cwd=$(pwd) greeting=$GREETING\"\n")
+	readPTYUntil(t, conn, "cwd=/tmp greeting=bonjour")
+
+	// it runs behind a terminal of the requested size
+	sendPTY(t, conn, "[ -t 0 ] && echo \"tty=yes size=$(stty size)\"\n")
+	readPTYUntil(t, conn, "tty=yes size=30 100")
+
+	require.NoError(t, conn.WriteJSON(PTYControl{Type: "resize", Cols: 120, Rows: 40}))
+	sendPTY(t, conn, "echo \"size=$(stty size)\"\n")
+	readPTYUntil(t, conn, "size=40 120")
+
+	sendPTY(t, conn, "exit 3\n")
+	for {
+		kind, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		if kind == websocket.TextMessage {
+			var ctl PTYControl
+			require.NoError(t, json.Unmarshal(data, &ctl))
+			assert.Equal(t, "exit", ctl.Type)
+			assert.Equal(t, 3, ctl.Status)
+			break
+		}
+	}
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+}
+
+func TestTerminalPTYRequests(t *testing.T) {
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	base := "ws" + strings.TrimPrefix(ts.URL, "http") + "/terminal/pty"
+
+	for name, query := range map[string]string{
+		"invalid size":      "&cols=0",
+		"missing container": "&target=container",
+		"unknown target":    "&target=moon",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, resp, err := websocket.DefaultDialer.Dial(base+"?token="+createTestToken()+query, nil)
+			require.Error(t, err)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(base, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestTerminalPTYDisconnectRemovesContainer(t *testing.T) {
+	containers := fakeDocker(t)
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialPTY(t, ts, "")
+
+	sendPTY(t, conn, "echo ready\n")
+	readPTYUntil(t, conn, "ready")
+	entries, _ := os.ReadDir(containers)
+	require.Len(t, entries, 1)
+
+	// the client goes away without exiting the shell
+	require.NoError(t, conn.Close())
+	assert.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(containers)
+		return len(entries) == 0
+	}, 5*time.Second, 20*time.Millisecond, "the container is removed")
+}
@@ -5,7 +5,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -69,7 +72,7 @@ func createTestServer() *gin.Engine {
 	r := gin.New()
 
 	userService := &mockUserService{}
-	RegisterTerminalRoutes(r, userService)
+	RegisterTerminalRoutes(r, userService, newMockTerminalHistoryService(), nil)
 
 	return r
 }
@@ -323,7 +326,7 @@ func TestTerminalCommandError(t *testing.T) {
 	assert.Equal(t, "result", resultMsg.Type)
 	assert.NotNil(t, resultMsg.Command)
 	assert.Equal(t, "test-error-1", resultMsg.Command.ID)
-	assert.Equal(t, 1, resultMsg.Command.Status) // Error
+	assert.Equal(t, 127, resultMsg.Command.Status) // command not found
 	assert.NotEmpty(t, resultMsg.Command.Error)
 }
 
@@ -629,10 +632,13 @@ func TestTerminalConcurrentCommands(t *testing.T) {
 		assert.Equal(t, 0, results[i].Command.Status)
 	}
 
-	// Verify all commands were executed
-	for i, result := range results {
-		assert.Equal(t, fmt.Sprintf("test-concurrent-%d", i+1), result.Command.ID)
-		assert.Contains(t, result.Command.Output, fmt.Sprintf("Command %d", i+1))
+	// Verify all commands were executed, in any order
+	outputs := map[string]string{}
+	for _, result := range results {
+		outputs[result.Command.ID] = result.Command.Output
+	}
+	for i := range commands {
+		assert.Contains(t, outputs[fmt.Sprintf("test-concurrent-%d", i+1)], fmt.Sprintf("Command %d", i+1))
 	}
 }
 
@@ -737,3 +743,295 @@ func TestTerminalLargeOutput(t *testing.T) {
 	assert.Contains(t, resultMsg.Command.Output, "Line 1")
 	assert.Contains(t, resultMsg.Command.Output, "Line 3")
 }
+
+func dialTerminal(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/terminal?token=" + createTestToken()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	t.Cleanup(func() { _ = conn.Close() })
+
+	var historyMsg TerminalMessage
+	require.NoError(t, conn.ReadJSON(&historyMsg))
+	return conn
+}
+
+func sendTerminal(t *testing.T, conn *websocket.Conn, msgType string, cmd *TerminalCommand) {
+	require.NoError(t, conn.WriteJSON(TerminalMessage{Type: msgType, Command: cmd}))
+}
+
+func TestTerminalCommandCancel(t *testing.T) {
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialTerminal(t, ts)
+
+	sendTerminal(t, conn, "execute", &TerminalCommand{ID: "cancel-1", Command: "echo started; sleep 30; echo done"})
+	var partial TerminalMessage
+	require.NoError(t, conn.ReadJSON(&partial))
+	require.Equal(t, "partial", partial.Type)
+	assert.Equal(t, "started\n", partial.Command.Output)
+
+	start := time.Now()
+	sendTerminal(t, conn, "cancel", &TerminalCommand{ID: "cancel-1"})
+	result, err := readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), terminalKillGrace)
+	assert.Equal(t, "cancel-1", result.Command.ID)
+	assert.Equal(t, TerminalStateCancelled, result.Command.State)
+	assert.Equal(t, 128+15, result.Command.Status)
+	assert.Equal(t, "SIGTERM", result.Command.Signal)
+	assert.NotContains(t, result.Command.Output, "done")
+
+	// the session goes on
+	sendTerminal(t, conn, "execute", &TerminalCommand{ID: "cancel-2", Command: "echo after"})
+	result, err = readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, TerminalStateSuccess, result.Command.State)
+	assert.Equal(t, "after\n", result.Command.Output)
+
+	sendTerminal(t, conn, "cancel", &TerminalCommand{ID: "cancel-2"})
+	var msg TerminalMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "error", msg.Type)
+	assert.Equal(t, "cancel-2", msg.Command.ID)
+}
+
+// fakeDocker puts first in PATH a docker running the containers as local
+// processes: `run --name` records the container in the returned directory
+// until it exits, `kill`, `stop` and `rm` kill and forget it, and `exec`
+// runs the command locally.
+func fakeDocker(t *testing.T) string {
+	bin, state := t.TempDir(), t.TempDir()
+	script := `#!/bin/sh
+state=` + state + `
+case "$1" in
+run)
+  name=
+  while [ $# -gt 0 ] && [ "$1" != chroot ]; do
+    [ "$1" = --name ] && name=$2
+    shift
+  done
+  shift 2
+  echo $$ > "$state/$name"
+  "$@"
+  s=$?
+  rm -f "$state/$name"
+  exit $s ;;
+kill|stop|rm)
+  for name; do :; done
+  [ -f "$state/$name" ] || { echo "Error: No such container: $name" >&2; exit 1; }
+  kill -KILL -- -"$(cat "$state/$name")"
+  rm -f "$state/$name" ;;
+exec)
+  shift
+  while [ "${1#-}" != "$1" ]; do shift; done
+  shift
+  exec "$@" ;;
+*)
+  exit 1 ;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return state
+}
+
+func TestTerminalCancelStopsContainer(t *testing.T) {
+	containers := fakeDocker(t)
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialTerminal(t, ts)
+
+	sendTerminal(t, conn, "execute", &TerminalCommand{ID: "host-1", Command: "sleep 30"})
+	require.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(containers)
+		return len(entries) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	entries, _ := os.ReadDir(containers)
+	assert.True(t, strings.HasPrefix(entries[0].Name(), "monitoverse-cmd-"))
+
+	sendTerminal(t, conn, "cancel", &TerminalCommand{ID: "host-1"})
+	result, err := readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, TerminalStateCancelled, result.Command.State)
+	entries, _ = os.ReadDir(containers)
+	assert.Empty(t, entries, "the container is removed")
+}
+
+func TestTerminalCancelStopsContainerExec(t *testing.T) {
+	fakeDocker(t)
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialTerminal(t, ts)
+
+	// the command runs in a session of its own, out of reach of the
+	// signals sent to the local docker client
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	sendTerminal(t, conn, "execute", &TerminalCommand{
+		ID: "exec-1", Target: "container", ContainerName: "app",
+		Command: "sleep 30 & echo $! > " + pidFile + "; wait",
+	})
+	var pid int
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil && pid > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	sendTerminal(t, conn, "cancel", &TerminalCommand{ID: "exec-1"})
+	result, err := readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, TerminalStateCancelled, result.Command.State)
+	assert.Eventually(t, func() bool {
+		return syscall.Kill(pid, 0) == syscall.ESRCH
+	}, 5*time.Second, 20*time.Millisecond, "the command is killed in the container")
+}
+
+func TestTerminalCommandsRunConcurrently(t *testing.T) {
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialTerminal(t, ts)
+
+	sendTerminal(t, conn, "execute", &TerminalCommand{ID: "slow", Command: "sleep 30", Target: "host"})
+	sendTerminal(t, conn, "execute", &TerminalCommand{ID: "fast", Command: "echo fast"})
+	result, err := readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "fast", result.Command.ID)
+	assert.Equal(t, "fast\n", result.Command.Output)
+
+	sendTerminal(t, conn, "execute", &TerminalCommand{ID: "slow", Command: "echo twice"})
+	result, err = readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "error", result.Type)
+	assert.Equal(t, "A command with this ID is already running", result.Command.Error)
+
+	require.NoError(t, conn.WriteJSON(TerminalMessage{Type: "list"}))
+	var list TerminalMessage
+	require.NoError(t, conn.ReadJSON(&list))
+	assert.Equal(t, "list", list.Type)
+	require.Len(t, list.Running, 1)
+	assert.Equal(t, "slow", list.Running[0].ID)
+	assert.Equal(t, "sleep 30", list.Running[0].Command)
+	assert.Equal(t, "host", list.Running[0].Target)
+	assert.NotZero(t, list.Running[0].Time)
+
+	sendTerminal(t, conn, "cancel", &TerminalCommand{ID: "slow"})
+	result, err = readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, TerminalStateCancelled, result.Command.State)
+
+	require.NoError(t, conn.WriteJSON(TerminalMessage{Type: "list"}))
+	var empty TerminalMessage
+	require.NoError(t, conn.ReadJSON(&empty))
+	assert.Equal(t, "list", empty.Type)
+	assert.Empty(t, empty.Running)
+}
+
+func TestTerminalCommandsLimit(t *testing.T) {
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialTerminal(t, ts)
+
+	for i := range maxTerminalCommands + 1 {
+		sendTerminal(t, conn, "execute", &TerminalCommand{ID: fmt.Sprintf("limit-%d", i), Command: "sleep 30"})
+	}
+	result, err := readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "error", result.Type)
+	assert.Equal(t, fmt.Sprintf("limit-%d", maxTerminalCommands), result.Command.ID)
+}
+
+func TestTerminalCommandTimeouts(t *testing.T) {
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+
+	t.Run("per command", func(t *testing.T) {
+		conn := dialTerminal(t, ts)
+		sendTerminal(t, conn, "execute", &TerminalCommand{ID: "timeout-1", Command: "sleep 30", TimeoutMS: 200})
+		result, err := readUntilResult(conn)
+		require.NoError(t, err)
+		assert.Equal(t, TerminalStateTimeout, result.Command.State)
+		assert.Equal(t, "Command timed out after 200ms", result.Command.Error)
+	})
+
+	t.Run("server default", func(t *testing.T) {
+		t.Setenv("TERMINAL_TIMEOUT_MS", "200")
+		conn := dialTerminal(t, ts)
+		sendTerminal(t, conn, "execute", &TerminalCommand{ID: "timeout-2", Command: "sleep 30"})
+		result, err := readUntilResult(conn)
+		require.NoError(t, err)
+		assert.Equal(t, TerminalStateTimeout, result.Command.State)
+	})
+
+	t.Run("children ignoring SIGTERM", func(t *testing.T) {
+		conn := dialTerminal(t, ts)
+		sendTerminal(t, conn, "execute", &TerminalCommand{ID: "timeout-3", Command: "trap '' TERM; sleep 30", TimeoutMS: 200})
+		result, err := readUntilResult(conn)
+		require.NoError(t, err)
+		assert.Equal(t, TerminalStateTimeout, result.Command.State)
+	})
+}
+
+func TestTerminalCommandStreams(t *testing.T) {
+	ts := httptest.NewServer(createTestServer())
+	defer ts.Close()
+	conn := dialTerminal(t, ts)
+
+	sendTerminal(t, conn, "execute", &TerminalCommand{
+		ID:      "streams",
+		Command: "echo one; sleep 0.1; echo two >&2; sleep 0.1; printf three; sleep 0.1; exit 3",
+	})
+	var frames []TerminalMessage
+	for {
+		var msg TerminalMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg.Type == "result" {
+			assert.Equal(t, 3, msg.Command.Status)
+			assert.Empty(t, msg.Command.Signal)
+			assert.Equal(t, TerminalStateError, msg.Command.State)
+			assert.Equal(t, "one\nthree", msg.Command.Output)
+			assert.Equal(t, "two\n", msg.Command.Error)
+			break
+		}
+		frames = append(frames, msg)
+	}
+
+	// each partial frame carries its chunk only, in order
+	require.Len(t, frames, 3)
+	for i, want := range []struct{ stream, output, error string }{
+		{"stdout", "one\n", ""},
+		{"stderr", "", "two\n"},
+		{"stdout", "three", ""},
+	} {
+		assert.Equal(t, "partial", frames[i].Type)
+		assert.Equal(t, int64(i+1), frames[i].Seq)
+		assert.Equal(t, want.stream, frames[i].Stream)
+		assert.Equal(t, want.output, frames[i].Command.Output)
+		assert.Equal(t, want.error, frames[i].Command.Error)
+	}
+
+	sendTerminal(t, conn, "execute", &TerminalCommand{ID: "killed", Command: "kill -9 $$"})
+	result, err := readUntilResult(conn)
+	require.NoError(t, err)
+	assert.Equal(t, 128+9, result.Command.Status)
+	assert.Equal(t, "SIGKILL", result.Command.Signal)
+	assert.Equal(t, TerminalStateError, result.Command.State)
+}
+
+func TestCompleteUTF8(t *testing.T) {
+	word := []byte("déjà") // d, é on 2 bytes, j, à on 2 bytes
+	for _, tt := range []struct {
+		data []byte
+		want int
+	}{
+		{word, len(word)},
+		{word[:2], 1}, // cut inside é
+		{word[:3], 3},
+		{word[:5], 4},     // cut inside à
+		{[]byte{0xff}, 1}, // invalid, sent as is
+		{[]byte("€")[:2], 0},
+		{nil, 0},
+	} {
+		assert.Equal(t, tt.want, completeUTF8(tt.data), "%q", tt.data)
+	}
+}
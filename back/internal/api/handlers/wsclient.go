@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Keepalive settings of the monitoring WebSockets. A client that answers no
+// ping for wsPongWait is considered dead and disconnected.
+var (
+	wsPingPeriod = 30 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsWriteWait  = 10 * time.Second
+)
+
+// wsQueueSize is the number of frames buffered for a client that reads
+// slower than the server produces.
+const wsQueueSize = 64
+
+// slowPolicy tells what to do when the send queue of a client is full.
+type slowPolicy string
+
+const (
+	slowDropOldest slowPolicy = "drop_oldest"
+	slowDisconnect slowPolicy = "disconnect"
+)
+
+var (
+	errWSClosed     = errors.New("websocket closed")
+	errWSSlowClient = errors.New("websocket client too slow")
+)
+
+// WebSocketStats counts the monitoring WebSocket clients and their frames.
+type WebSocketStats struct {
+	Active          int64 `json:"active"`
+	SentFrames      int64 `json:"sent_frames"`
+	SentBytes       int64 `json:"sent_bytes"`
+	DroppedFrames   int64 `json:"dropped_frames"`
+	SlowDisconnects int64 `json:"slow_disconnects"`
+	IdleDisconnects int64 `json:"idle_disconnects"`
+}
+
+var wsStats struct {
+	active, sent, sentBytes, dropped, slowDisconnects, idleDisconnects atomic.Int64
+}
+
+func webSocketStats() WebSocketStats {
+	return WebSocketStats{
+		Active:          wsStats.active.Load(),
+		SentFrames:      wsStats.sent.Load(),
+		SentBytes:       wsStats.sentBytes.Load(),
+		DroppedFrames:   wsStats.dropped.Load(),
+		SlowDisconnects: wsStats.slowDisconnects.Load(),
+		IdleDisconnects: wsStats.idleDisconnects.Load(),
+	}
+}
+
+// RegisterWebSocketStatsRoutes exposes the counters of the monitoring WebSockets.
+func RegisterWebSocketStatsRoutes(r *gin.RouterGroup) {
+	r.GET("/monitoring/websockets", func(c *gin.Context) {
+		c.JSON(http.StatusOK, webSocketStats())
+	})
+}
+
+// wsClient owns the writes to a WebSocket connection. Frames go through a
+// bounded queue drained by a single writer goroutine which encodes them and
+// sends the pings, so a stalled client never blocks the producers.
+type wsClient struct {
+	conn   *websocket.Conn
+	queue  chan any
+	policy slowPolicy
+	codec  *frameCodec
+
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Int64
+}
+
+// parseSlowPolicy reads the `slow_policy` query parameter, dropping the
+// oldest frames by default.
+func parseSlowPolicy(c *gin.Context) (slowPolicy, error) {
+	switch policy := slowPolicy(c.DefaultQuery("slow_policy", string(slowDropOldest))); policy {
+	case slowDropOldest, slowDisconnect:
+		return policy, nil
+	default:
+		return "", errors.New("slow_policy must be drop_oldest or disconnect")
+	}
+}
+
+func newWSClient(conn *websocket.Conn, policy slowPolicy) *wsClient {
+	client := &wsClient{
+		conn:   conn,
+		queue:  make(chan any, wsQueueSize),
+		policy: policy,
+		codec:  newFrameCodec(conn.Subprotocol()),
+		done:   make(chan struct{}),
+	}
+	wsStats.active.Add(1)
+
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go client.writeLoop()
+	return client
+}
+
+// Done is closed once the connection is closed.
+func (c *wsClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Send queues v, encoded as negotiated with the client when written. When
+// the queue is full the oldest frame is dropped, or the client disconnected,
+// depending on its policy.
+func (c *wsClient) Send(v any) error {
+	return c.enqueue(v)
+}
+
+// SendWait is Send for frames that should not be dropped, like replayed
+// history: it first waits up to wsWriteWait for room in the queue.
+func (c *wsClient) SendWait(v any) error {
+	timer := time.NewTimer(wsWriteWait)
+	defer timer.Stop()
+	select {
+	case c.queue <- v:
+		return nil
+	case <-c.done:
+		return errWSClosed
+	case <-timer.C:
+	}
+	return c.enqueue(v)
+}
+
+func (c *wsClient) enqueue(v any) error {
+	for {
+		select {
+		case <-c.done:
+			return errWSClosed
+		case c.queue <- v:
+			return nil
+		default:
+		}
+
+		wsStats.dropped.Add(1)
+		c.dropped.Add(1)
+		if c.policy == slowDisconnect {
+			wsStats.slowDisconnects.Add(1)
+			log.Println("Client trop lent, déconnexion:", c.conn.RemoteAddr())
+			c.Close()
+			return errWSSlowClient
+		}
+		select {
+		case <-c.queue:
+		default:
+		}
+	}
+}
+
+// ReadMessage reads the next client message. Any read error, including the
+// read deadline expiring because pongs stopped coming, closes the client.
+func (c *wsClient) ReadMessage() ([]byte, error) {
+	_, msg, err := c.conn.ReadMessage()
+	if err != nil {
+		var netErr interface{ Timeout() bool }
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			wsStats.idleDisconnects.Add(1)
+		}
+		c.Close()
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ReadJSON reads the next client message into v.
+func (c *wsClient) ReadJSON(v any) error {
+	msg, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(msg, v)
+}
+
+// Discard reads and ignores client messages until the connection closes,
+// which is needed to process pongs and detect disconnects.
+func (c *wsClient) Discard() {
+	for {
+		if _, err := c.ReadMessage(); err != nil {
+			log.Println("Client déconnecté:", err)
+			return
+		}
+	}
+}
+
+func (c *wsClient) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		wsStats.active.Add(-1)
+		if dropped := c.dropped.Load(); dropped > 0 {
+			log.Printf("WebSocket %s: %d frames dropped", c.conn.RemoteAddr(), dropped)
+		}
+		if err := c.conn.Close(); err != nil {
+			log.Println("Error closing WebSocket connection:", err)
+		}
+	})
+}
+
+func (c *wsClient) writeLoop() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case v := <-c.queue:
+			messageType, msg, err := c.codec.encode(v)
+			if err != nil {
+				log.Println("Erreur encodage message:", err)
+				continue
+			}
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(messageType, msg); err != nil {
+				log.Println("Erreur envoi message:", err)
+				c.Close()
+				return
+			}
+			wsStats.sent.Add(1)
+			wsStats.sentBytes.Add(int64(len(msg)))
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
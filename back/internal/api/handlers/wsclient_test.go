@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsPair returns the server side of a WebSocket connection and its client
+func wsPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	serverConn := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		serverConn <- conn
+	}))
+	t.Cleanup(ts.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return <-serverConn, client
+}
+
+// queuedClient is a wsClient whose writer is not running, so that its queue fills up
+func queuedClient(t *testing.T, policy slowPolicy) *wsClient {
+	conn, _ := wsPair(t)
+	wsStats.active.Add(1)
+	return &wsClient{conn: conn, queue: make(chan any, 2), policy: policy, codec: newFrameCodec(""), done: make(chan struct{})}
+}
+
+func TestWSClientDropsOldestFrames(t *testing.T) {
+	client := queuedClient(t, slowDropOldest)
+	dropped := wsStats.dropped.Load()
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, client.Send(i))
+	}
+	assert.Equal(t, 3, <-client.queue)
+	assert.Equal(t, 4, <-client.queue)
+	assert.Equal(t, int64(2), client.dropped.Load())
+	assert.Equal(t, dropped+2, wsStats.dropped.Load())
+	client.Close()
+}
+
+func TestWSClientDisconnectsSlowConsumer(t *testing.T) {
+	client := queuedClient(t, slowDisconnect)
+	disconnects := wsStats.slowDisconnects.Load()
+
+	require.NoError(t, client.Send(1))
+	require.NoError(t, client.Send(2))
+	assert.ErrorIs(t, client.Send(3), errWSSlowClient)
+	assert.ErrorIs(t, client.Send(4), errWSClosed)
+	assert.Equal(t, disconnects+1, wsStats.slowDisconnects.Load())
+	select {
+	case <-client.Done():
+	default:
+		t.Fatal("client should be closed")
+	}
+}
+
+func TestWSClientPingsAndDropsIdleClients(t *testing.T) {
+	defer func(ping, pong time.Duration) { wsPingPeriod, wsPongWait = ping, pong }(wsPingPeriod, wsPongWait)
+	wsPingPeriod, wsPongWait = 50*time.Millisecond, 300*time.Millisecond
+
+	serverConn, conn := wsPair(t)
+	client := newWSClient(serverConn, slowDropOldest)
+	go client.Discard()
+	idle := wsStats.idleDisconnects.Load()
+
+	// a live client answers the pings while reading and stays connected
+	pings := 0
+	conn.SetPingHandler(func(data string) error {
+		pings++
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	require.NoError(t, client.Send("hello"))
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(600*time.Millisecond)))
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, `"hello"`, string(msg))
+	_, _, err = conn.ReadMessage()
+	require.Error(t, err) // read deadline, pings kept coming meanwhile
+	assert.Greater(t, pings, 2)
+	select {
+	case <-client.Done():
+		t.Fatal("client answering pings should stay connected")
+	default:
+	}
+
+	// a client that stops reading stops answering pings and gets dropped
+	select {
+	case <-client.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle client was not disconnected")
+	}
+	assert.Equal(t, idle+1, wsStats.idleDisconnects.Load())
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(router *gin.Engine, userService services.UserService) {
+func SetupRoutes(router *gin.Engine, userService services.UserService, hostService services.HostService, terminalHistoryService services.TerminalHistoryService, terminalAuditService services.TerminalAuditService) {
 
 	protected := router.Group("/")
 	protected.Use(JWTAuthMiddleware(authutil.GetJWTSecret()))
@@ -16,8 +16,23 @@ func SetupRoutes(router *gin.Engine, userService services.UserService) {
 	// Protected routes
 	handlers.RegisterTOTPRoutes(router, userService)
 	handlers.RegisterMonitoringRoutes(router, userService)
-	handlers.RegisterTerminalRoutes(router, userService)
+	handlers.RegisterTerminalRoutes(router, userService, terminalHistoryService, terminalAuditService)
+	handlers.RegisterLogRoutes(router)
+	handlers.RegisterAlertRoutes(protected)
+	handlers.RegisterHostRoutes(protected, hostService)
+	handlers.RegisterMonitoringSSERoutes(protected)
+	handlers.RegisterWebSocketStatsRoutes(protected)
+	handlers.RegisterExportRoutes(protected)
+	handlers.RegisterSinkRoutes(protected)
+	handlers.RegisterSeriesRoutes(protected)
+	handlers.RegisterCheckRoutes(protected)
+	handlers.RegisterLogMetricRoutes(protected)
+	handlers.RegisterTerminalHistoryRoutes(protected, terminalHistoryService)
+	handlers.RegisterTerminalAuditRoutes(protected, terminalAuditService)
 
 	// Public routes
 	handlers.RegisterAuthRoutes(router, userService)
+
+	// Agent routes, authenticated with an enrollment token or an agent key
+	handlers.RegisterAgentRoutes(router, hostService)
 }
@@ -2,6 +2,7 @@ package authutil
 
 import (
 	"os"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -19,3 +20,17 @@ func GetJWTSecret() []byte {
 	}
 	return []byte(secret)
 }
+
+// IsAdmin tells whether email is one of the administrators listed in
+// ADMIN_EMAILS, separated by commas.
+func IsAdmin(email string) bool {
+	if email == "" {
+		return false
+	}
+	for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if strings.EqualFold(strings.TrimSpace(admin), email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,438 @@
+// Package checks runs synthetic checks against HTTP(S) endpoints, TCP
+// ports, DNS names and TLS certificates on a schedule, and keeps their results to compute
+// uptimes.
+package checks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"back/internal/series"
+)
+
+var (
+	ErrCheckExists   = errors.New("check already exists")
+	ErrCheckNotFound = errors.New("check not found")
+)
+
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+	TypeDNS  = "dns"
+	TypeTLS  = "tls"
+)
+
+// minInterval keeps a check from hammering its target.
+const minInterval = time.Second
+
+// Config is the JSON representation of a check, used by the API.
+type Config struct {
+	Name       string `json:"name" binding:"required"`
+	Type       string `json:"type" binding:"required"`
+	Target     string `json:"target" binding:"required"` // URL, host:port, DNS name or file:// path of a PEM file
+	IntervalMS int    `json:"interval_ms,omitempty"`     // 60s by default
+	TimeoutMS  int    `json:"timeout_ms,omitempty"`      // 10s by default
+
+	HTTP *HTTPConfig `json:"http,omitempty"`
+	DNS  *DNSConfig  `json:"dns,omitempty"`
+	TLS  *TLSConfig  `json:"tls,omitempty"`
+}
+
+type HTTPConfig struct {
+	Method         string            `json:"method,omitempty"` // GET by default
+	Headers        map[string]string `json:"headers,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	ExpectedStatus []int             `json:"expected_status,omitempty"` // any 2xx by default
+	BodyRegex      string            `json:"body_regex,omitempty"`
+	TLSExpiryDays  int               `json:"tls_expiry_days,omitempty"` // fail when the certificate expires sooner
+	TLSSkipVerify  bool              `json:"tls_skip_verify,omitempty"`
+}
+
+type DNSConfig struct {
+	RecordType string   `json:"record_type,omitempty"` // A (default), AAAA, CNAME, MX, NS or TXT
+	Server     string   `json:"server,omitempty"`      // host:port, the system resolver by default
+	Expected   []string `json:"expected,omitempty"`    // one of the answers must be among these
+}
+
+func (c Config) interval() time.Duration {
+	if c.IntervalMS <= 0 {
+		return time.Minute
+	}
+	return max(time.Duration(c.IntervalMS)*time.Millisecond, minInterval)
+}
+
+func (c Config) timeout() time.Duration {
+	if c.TimeoutMS <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.TimeoutMS) * time.Millisecond
+}
+
+func (c Config) httpConfig() HTTPConfig {
+	var opts HTTPConfig
+	if c.HTTP != nil {
+		opts = *c.HTTP
+	}
+	if opts.Method == "" {
+		opts.Method = "GET"
+	}
+	return opts
+}
+
+func (c Config) dnsConfig() DNSConfig {
+	var opts DNSConfig
+	if c.DNS != nil {
+		opts = *c.DNS
+	}
+	if opts.RecordType == "" {
+		opts.RecordType = "A"
+	}
+	return opts
+}
+
+func (c Config) Validate() error {
+	if c.Name == "" || c.Target == "" {
+		return fmt.Errorf("check name and target are required")
+	}
+	switch c.Type {
+	case TypeHTTP:
+		u, err := url.Parse(c.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q", c.Target)
+		}
+		if opts := c.httpConfig(); opts.BodyRegex != "" {
+			if _, err := regexp.Compile(opts.BodyRegex); err != nil {
+				return fmt.Errorf("invalid body_regex: %w", err)
+			}
+		}
+	case TypeTCP:
+		if _, _, err := net.SplitHostPort(c.Target); err != nil {
+			return fmt.Errorf("invalid address %q: %w", c.Target, err)
+		}
+	case TypeDNS:
+		switch recordType := c.dnsConfig().RecordType; recordType {
+		case "A", "AAAA", "CNAME", "MX", "NS", "TXT":
+		default:
+			return fmt.Errorf("unsupported record type %q", recordType)
+		}
+	case TypeTLS:
+		return validateTLS(c)
+	default:
+		return fmt.Errorf("unknown check type %q", c.Type)
+	}
+	return nil
+}
+
+// Timings break the duration of a run down, in milliseconds.
+type Timings struct {
+	DNS       float64 `json:"dns,omitempty"`
+	Connect   float64 `json:"connect,omitempty"`
+	TLS       float64 `json:"tls,omitempty"`
+	FirstByte float64 `json:"first_byte,omitempty"` // from the request sent to the first response byte
+	Total     float64 `json:"total"`
+}
+
+type Result struct {
+	ID         int64    `json:"id"`
+	Check      string   `json:"check"`
+	Timestamp  int64    `json:"timestamp"`
+	Success    bool     `json:"success"`
+	Error      string   `json:"error,omitempty"`
+	Timings    Timings  `json:"timings"`
+	StatusCode int      `json:"status_code,omitempty"`
+	TLSExpiry  int64    `json:"tls_expiry,omitempty"` // unix time the first certificate of the chain to expire does
+	Answers    []string `json:"answers,omitempty"`
+
+	Certificates []Certificate `json:"certificates,omitempty"`
+}
+
+// Samples turns a result into series, labeled with the check name and
+// type: check.up (1 or 0), check.duration_ms, check.<phase>_ms and
+// check.tls_expiry_days.
+func (r Result) Samples(cfg Config) []series.Sample {
+	host := targetHost(cfg)
+	labels := map[string]string{"check": cfg.Name, "type": cfg.Type}
+	sample := func(metric string, value float64) series.Sample {
+		return series.Sample{Metric: metric, Host: host, Labels: labels, Timestamp: r.Timestamp, Value: value}
+	}
+	up := 0.0
+	if r.Success {
+		up = 1
+	}
+	samples := []series.Sample{sample("check.up", up), sample("check.duration_ms", r.Timings.Total)}
+	for _, phase := range []struct {
+		metric string
+		value  float64
+	}{
+		{"check.dns_ms", r.Timings.DNS},
+		{"check.connect_ms", r.Timings.Connect},
+		{"check.tls_ms", r.Timings.TLS},
+		{"check.first_byte_ms", r.Timings.FirstByte},
+	} {
+		if phase.value > 0 {
+			samples = append(samples, sample(phase.metric, phase.value))
+		}
+	}
+	if r.TLSExpiry > 0 {
+		samples = append(samples, sample("check.tls_expiry_days", time.Until(time.Unix(r.TLSExpiry, 0)).Hours()/24))
+	}
+	return samples
+}
+
+// UptimeWindows are the periods Status reports the uptime over.
+var UptimeWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// Status is a check with its latest result and uptime percentages, for the
+// windows with results.
+type Status struct {
+	Config
+	Last   *Result            `json:"last,omitempty"`
+	Uptime map[string]float64 `json:"uptime"`
+}
+
+type check struct {
+	cfg     Config
+	cancel  context.CancelFunc
+	done    chan struct{} // closed once schedule returns
+	results []Result
+}
+
+// Store persists the checks and their results, SaveResult setting the ID
+// of the result and keeping the last keep results of its check.
+type Store interface {
+	SaveCheck(cfg Config) error
+	DeleteCheck(name string) error
+	LoadChecks() ([]Config, error)
+	SaveResult(res *Result, keep int) error
+	// LoadResults returns the last limit results of a check, oldest first.
+	LoadResults(name string, limit int) ([]Result, error)
+}
+
+// Manager schedules the checks and keeps their last results, in memory and
+// in its store when it has one.
+type Manager struct {
+	limit    int // results kept per check
+	store    Store
+	onResult func(Config, Result)
+
+	mu     sync.Mutex
+	checks map[string]*check
+	nextID int64
+}
+
+// NewManager keeps limit results per check, in store too when not nil, and
+// calls onResult, when not nil, after each run.
+func NewManager(limit int, store Store, onResult func(Config, Result)) *Manager {
+	return &Manager{limit: limit, store: store, onResult: onResult, checks: map[string]*check{}, nextID: 1}
+}
+
+// Restore starts the checks of the store with their stored results.
+func (m *Manager) Restore() error {
+	if m.store == nil {
+		return nil
+	}
+	configs, err := m.store.LoadChecks()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, cfg := range configs {
+		if _, ok := m.checks[cfg.Name]; ok {
+			continue
+		}
+		results, err := m.store.LoadResults(cfg.Name, m.limit)
+		if err != nil {
+			return err
+		}
+		for _, res := range results {
+			m.nextID = max(m.nextID, res.ID+1)
+		}
+		m.start(&check{cfg: cfg, results: results})
+	}
+	return nil
+}
+
+// Add validates cfg, stores it and starts running it, a first time right
+// away.
+func (m *Manager) Add(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.checks[cfg.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrCheckExists, cfg.Name)
+	}
+	if m.store != nil {
+		if err := m.store.SaveCheck(cfg); err != nil {
+			return err
+		}
+	}
+	m.start(&check{cfg: cfg})
+	return nil
+}
+
+func (m *Manager) start(c *check) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	m.checks[c.cfg.Name] = c
+	go m.schedule(ctx, c)
+}
+
+// Remove stops a check and deletes it with its results. The run in
+// progress, if any, is over before the deletion, so that none of its
+// results outlives the check. A check that cannot be deleted from the
+// store starts again.
+func (m *Manager) Remove(name string) error {
+	for {
+		m.mu.Lock()
+		c, ok := m.checks[name]
+		if !ok {
+			m.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrCheckNotFound, name)
+		}
+		done := c.done
+		m.mu.Unlock()
+		c.cancel()
+		<-done
+
+		m.mu.Lock()
+		if m.checks[name] != c || c.done != done {
+			// removed, or started again by a failed removal, meanwhile
+			m.mu.Unlock()
+			continue
+		}
+		if m.store != nil {
+			if err := m.store.DeleteCheck(name); err != nil {
+				m.start(c)
+				m.mu.Unlock()
+				return err
+			}
+		}
+		delete(m.checks, name)
+		m.mu.Unlock()
+		return nil
+	}
+}
+
+func (m *Manager) schedule(ctx context.Context, c *check) {
+	defer close(c.done)
+	ticker := time.NewTicker(c.cfg.interval())
+	defer ticker.Stop()
+	for {
+		res := Run(ctx, c.cfg)
+		if ctx.Err() != nil {
+			return
+		}
+		m.record(c, res)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// record keeps a result, a failure to store it being logged only: the
+// result still counts for the uptimes until a restart.
+func (m *Manager) record(c *check, res Result) {
+	if m.store != nil {
+		if err := m.store.SaveResult(&res, m.limit); err != nil {
+			log.Printf("check %s: failed to store the result: %v", c.cfg.Name, err)
+			res.ID = 0
+		}
+	}
+	m.mu.Lock()
+	if res.ID == 0 {
+		res.ID = m.nextID
+	}
+	m.nextID = max(m.nextID, res.ID+1)
+	c.results = append(c.results, res)
+	if len(c.results) > m.limit {
+		c.results = c.results[len(c.results)-m.limit:]
+	}
+	m.mu.Unlock()
+
+	if m.onResult != nil {
+		m.onResult(c.cfg, res)
+	}
+}
+
+// List returns the status of every check, sorted by name.
+func (m *Manager) List() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]Status, 0, len(m.checks))
+	for _, c := range m.checks {
+		statuses = append(statuses, c.status(time.Now()))
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return strings.Compare(a.Name, b.Name) })
+	return statuses
+}
+
+func (m *Manager) Status(name string) (Status, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.checks[name]
+	if !ok {
+		return Status{}, false
+	}
+	return c.status(time.Now()), true
+}
+
+// Results returns the stored results of a check with an ID above sinceID.
+func (m *Manager) Results(name string, sinceID int64) ([]Result, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.checks[name]
+	if !ok {
+		return nil, false
+	}
+	results := []Result{}
+	for _, res := range c.results {
+		if res.ID > sinceID {
+			results = append(results, res)
+		}
+	}
+	return results, true
+}
+
+func (c *check) status(now time.Time) Status {
+	s := Status{Config: c.cfg, Uptime: map[string]float64{}}
+	if len(c.results) > 0 {
+		last := c.results[len(c.results)-1]
+		s.Last = &last
+	}
+	for name, window := range UptimeWindows {
+		since := now.Add(-window).Unix()
+		total, up := 0, 0
+		for _, res := range c.results {
+			if res.Timestamp < since {
+				continue
+			}
+			total++
+			if res.Success {
+				up++
+			}
+		}
+		if total > 0 {
+			s.Uptime[name] = 100 * float64(up) / float64(total)
+		}
+	}
+	return s
+}
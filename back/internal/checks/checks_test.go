@@ -0,0 +1,244 @@
+package checks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []Config{
+		{Name: "a", Type: TypeHTTP, Target: "https://example.com/health"},
+		{Name: "b", Type: TypeTCP, Target: "db:5432"},
+		{Name: "c", Type: TypeDNS, Target: "example.com", DNS: &DNSConfig{RecordType: "MX"}},
+	}
+	for _, cfg := range valid {
+		assert.NoError(t, cfg.Validate(), cfg.Name)
+	}
+	invalid := []Config{
+		{Name: "a", Type: TypeHTTP, Target: "ftp://example.com"},
+		{Name: "a", Type: TypeHTTP, Target: "http://example.com", HTTP: &HTTPConfig{BodyRegex: "("}},
+		{Name: "b", Type: TypeTCP, Target: "db"},
+		{Name: "c", Type: TypeDNS, Target: "example.com", DNS: &DNSConfig{RecordType: "SRV"}},
+		{Name: "d", Type: "icmp", Target: "example.com"},
+		{Type: TypeTCP, Target: "db:5432"},
+	}
+	for _, cfg := range invalid {
+		assert.Error(t, cfg.Validate(), cfg.Name)
+	}
+}
+
+func TestManager(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	results := make(chan Result, 10)
+	m := NewManager(3, nil, func(cfg Config, res Result) { results <- res })
+	cfg := Config{Name: "web", Type: TypeHTTP, Target: server.URL, IntervalMS: 1000}
+	require.NoError(t, m.Add(cfg))
+	assert.ErrorIs(t, m.Add(cfg), ErrCheckExists)
+
+	// the first run happens right away
+	select {
+	case res := <-results:
+		assert.False(t, res.Success)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result")
+	}
+	healthy.Store(true)
+	select {
+	case res := <-results:
+		assert.True(t, res.Success)
+	case <-time.After(3 * time.Second):
+		t.Fatal("no second result")
+	}
+
+	status, ok := m.Status("web")
+	require.True(t, ok)
+	assert.True(t, status.Last.Success)
+	assert.Equal(t, map[string]float64{"1h": 50, "24h": 50, "7d": 50}, status.Uptime)
+
+	stored, ok := m.Results("web", 0)
+	require.True(t, ok)
+	require.Len(t, stored, 2)
+	later, _ := m.Results("web", stored[0].ID)
+	assert.Len(t, later, 1)
+
+	assert.NoError(t, m.Remove("web"))
+	assert.ErrorIs(t, m.Remove("web"), ErrCheckNotFound)
+	assert.Empty(t, m.List())
+}
+
+// memoryStore is a Store keeping everything in maps.
+type memoryStore struct {
+	mu      sync.Mutex
+	configs map[string]Config
+	results map[string][]Result
+	lastID  int64
+	// saving, when set, is called before a result is saved
+	saving func()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{configs: map[string]Config{}, results: map[string][]Result{}}
+}
+
+func (s *memoryStore) SaveCheck(cfg Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configs[cfg.Name] = cfg
+	return nil
+}
+
+func (s *memoryStore) DeleteCheck(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.configs, name)
+	delete(s.results, name)
+	return nil
+}
+
+func (s *memoryStore) LoadChecks() ([]Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var configs []Config
+	for _, cfg := range s.configs {
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+func (s *memoryStore) SaveResult(res *Result, keep int) error {
+	if s.saving != nil {
+		s.saving()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID += 10 // IDs of the store, not of the manager
+	res.ID = s.lastID
+	results := append(s.results[res.Check], *res)
+	s.results[res.Check] = results[max(len(results)-keep, 0):]
+	return nil
+}
+
+func (s *memoryStore) LoadResults(name string, limit int) ([]Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := s.results[name]
+	return slices.Clone(results[max(len(results)-limit, 0):]), nil
+}
+
+func TestManagerRestoresFromStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	store := newMemoryStore()
+	results := make(chan Result, 10)
+	m := NewManager(2, store, func(cfg Config, res Result) { results <- res })
+	cfg := Config{Name: "web", Type: TypeHTTP, Target: server.URL, IntervalMS: 3600000}
+	require.NoError(t, m.Add(cfg))
+	select {
+	case res := <-results:
+		assert.Equal(t, int64(10), res.ID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result")
+	}
+
+	// a new manager, as after a restart, runs the stored check with its results
+	restarted := NewManager(2, store, func(cfg Config, res Result) { results <- res })
+	require.NoError(t, restarted.Restore())
+	status, ok := restarted.Status("web")
+	require.True(t, ok)
+	assert.Equal(t, cfg, status.Config)
+	select {
+	case res := <-results:
+		assert.Equal(t, int64(20), res.ID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result after the restart")
+	}
+	stored, _ := restarted.Results("web", 0)
+	require.Len(t, stored, 2)
+	assert.Equal(t, int64(10), stored[0].ID)
+	assert.Equal(t, map[string]float64{"1h": 100, "24h": 100, "7d": 100}, mustStatus(t, restarted, "web").Uptime)
+
+	require.NoError(t, restarted.Remove("web"))
+	configs, _ := store.LoadChecks()
+	assert.Empty(t, configs)
+	assert.Empty(t, store.results)
+}
+
+func TestManagerRemoveWaitsForTheRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	store := newMemoryStore()
+	saving, release := make(chan struct{}), make(chan struct{})
+	store.saving = func() {
+		close(saving)
+		<-release
+	}
+	var recorded []Result
+	m := NewManager(2, store, func(cfg Config, res Result) { recorded = append(recorded, res) })
+	require.NoError(t, m.Add(Config{Name: "web", Type: TypeHTTP, Target: server.URL, IntervalMS: 3600000}))
+	<-saving
+
+	removed := make(chan error)
+	go func() { removed <- m.Remove("web") }()
+	select {
+	case <-removed:
+		t.Fatal("removed while a result was being saved")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	require.NoError(t, <-removed)
+
+	// the result of the run is gone with the check
+	assert.Empty(t, store.results)
+	assert.Len(t, recorded, 1)
+	_, ok := m.Status("web")
+	assert.False(t, ok)
+}
+
+func mustStatus(t *testing.T, m *Manager, name string) Status {
+	status, ok := m.Status(name)
+	require.True(t, ok)
+	return status
+}
+
+func TestUptimeWindows(t *testing.T) {
+	now := time.Now()
+	c := &check{results: []Result{
+		{Timestamp: now.Add(-48 * time.Hour).Unix(), Success: false},
+		{Timestamp: now.Add(-2 * time.Hour).Unix(), Success: false},
+		{Timestamp: now.Add(-time.Minute).Unix(), Success: true},
+		{Timestamp: now.Unix(), Success: true},
+	}}
+	status := c.status(now)
+	assert.Equal(t, 100.0, status.Uptime["1h"])
+	assert.InDelta(t, 66.67, status.Uptime["24h"], 0.01)
+	assert.Equal(t, 50.0, status.Uptime["7d"])
+}
+
+func TestResultSamples(t *testing.T) {
+	cfg := Config{Name: "web", Type: TypeHTTP, Target: "https://example.com:8443/health"}
+	res := Result{Timestamp: 100, Success: true, Timings: Timings{Connect: 2, Total: 12}}
+	values := map[string]float64{}
+	for _, s := range res.Samples(cfg) {
+		assert.Equal(t, "example.com", s.Host)
+		assert.Equal(t, map[string]string{"check": "web", "type": TypeHTTP}, s.Labels)
+		values[s.Metric] = s.Value
+	}
+	assert.Equal(t, map[string]float64{"check.up": 1, "check.duration_ms": 12, "check.connect_ms": 2}, values)
+}
@@ -0,0 +1,217 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxBodySize bounds what is read of an HTTP response to match body_regex.
+const maxBodySize = 1 << 20
+
+// Run executes the check once.
+func Run(ctx context.Context, cfg Config) Result {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+	start := time.Now()
+	res := Result{Check: cfg.Name, Timestamp: start.Unix()}
+	var err error
+	switch cfg.Type {
+	case TypeHTTP:
+		err = runHTTP(ctx, cfg, &res)
+	case TypeTCP:
+		err = runTCP(ctx, cfg, &res)
+	case TypeDNS:
+		err = runDNS(ctx, cfg, &res)
+	case TypeTLS:
+		err = runTLS(ctx, cfg, &res)
+	default:
+		err = fmt.Errorf("unknown check type %q", cfg.Type)
+	}
+	res.Timings.Total = ms(time.Since(start))
+	res.Success = err == nil
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func runHTTP(ctx context.Context, cfg Config, res *Result) error {
+	opts := cfg.httpConfig()
+	var body io.Reader
+	if opts.Body != "" {
+		body = strings.NewReader(opts.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, opts.Method, cfg.Target, body)
+	if err != nil {
+		return err
+	}
+	for key, value := range opts.Headers {
+		req.Header.Set(key, value)
+	}
+
+	var dnsStart, connectStart, tlsStart, sent time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { res.Timings.DNS = ms(time.Since(dnsStart)) },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { res.Timings.Connect = ms(time.Since(connectStart)) },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { res.Timings.TLS = ms(time.Since(tlsStart)) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { sent = time.Now() },
+		GotFirstResponseByte: func() { res.Timings.FirstByte = ms(time.Since(sent)) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	// a fresh transport per run, so that every run measures a new connection
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: opts.TLSSkipVerify},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	res.StatusCode = resp.StatusCode
+
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		res.TLSExpiry = cert.NotAfter.Unix()
+		if opts.TLSExpiryDays > 0 && time.Until(cert.NotAfter) < time.Duration(opts.TLSExpiryDays)*24*time.Hour {
+			return fmt.Errorf("certificate expires on %s", cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+
+	if len(opts.ExpectedStatus) > 0 {
+		if !slices.Contains(opts.ExpectedStatus, resp.StatusCode) {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if opts.BodyRegex != "" {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return err
+		}
+		re, err := regexp.Compile(opts.BodyRegex)
+		if err != nil {
+			return err
+		}
+		if !re.Match(data) {
+			return fmt.Errorf("body does not match %q", opts.BodyRegex)
+		}
+	}
+	return nil
+}
+
+func runTCP(ctx context.Context, cfg Config, res *Result) error {
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.Target)
+	if err != nil {
+		return err
+	}
+	res.Timings.Connect = ms(time.Since(start))
+	return conn.Close()
+}
+
+func runDNS(ctx context.Context, cfg Config, res *Result) error {
+	opts := cfg.dnsConfig()
+	resolver := net.DefaultResolver
+	if opts.Server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, opts.Server)
+			},
+		}
+	}
+
+	start := time.Now()
+	var answers []string
+	var err error
+	switch opts.RecordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if opts.RecordType == "AAAA" {
+			network = "ip6"
+		}
+		var ips []net.IP
+		if ips, err = resolver.LookupIP(ctx, network, cfg.Target); err == nil {
+			for _, ip := range ips {
+				answers = append(answers, ip.String())
+			}
+		}
+	case "CNAME":
+		var cname string
+		if cname, err = resolver.LookupCNAME(ctx, cfg.Target); err == nil {
+			answers = []string{cname}
+		}
+	case "MX":
+		var mxs []*net.MX
+		if mxs, err = resolver.LookupMX(ctx, cfg.Target); err == nil {
+			for _, mx := range mxs {
+				answers = append(answers, mx.Host)
+			}
+		}
+	case "NS":
+		var nss []*net.NS
+		if nss, err = resolver.LookupNS(ctx, cfg.Target); err == nil {
+			for _, ns := range nss {
+				answers = append(answers, ns.Host)
+			}
+		}
+	case "TXT":
+		answers, err = resolver.LookupTXT(ctx, cfg.Target)
+	}
+	res.Timings.DNS = ms(time.Since(start))
+	if err != nil {
+		return err
+	}
+	res.Answers = answers
+	if len(answers) == 0 {
+		return fmt.Errorf("no %s record for %s", opts.RecordType, cfg.Target)
+	}
+	if len(opts.Expected) > 0 && !slices.ContainsFunc(answers, func(a string) bool { return slices.Contains(opts.Expected, a) }) {
+		return fmt.Errorf("answers %v do not include %v", answers, opts.Expected)
+	}
+	return nil
+}
+
+// targetHost returns the host a check targets, used as the host of its
+// series. It is empty for a certificate file, on the local host.
+func targetHost(cfg Config) string {
+	if strings.HasPrefix(cfg.Target, filePrefix) {
+		return ""
+	}
+	switch cfg.Type {
+	case TypeHTTP:
+		if u, err := url.Parse(cfg.Target); err == nil {
+			return u.Hostname()
+		}
+	case TypeTCP, TypeTLS:
+		if host, _, err := net.SplitHostPort(cfg.Target); err == nil {
+			return host
+		}
+	}
+	return cfg.Target
+}
@@ -0,0 +1,94 @@
+package checks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Probe") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status": "healthy"}`))
+	}))
+	defer server.Close()
+
+	cfg := Config{Name: "api", Type: TypeHTTP, Target: server.URL, HTTP: &HTTPConfig{
+		Method:         http.MethodPost,
+		Headers:        map[string]string{"X-Probe": "1"},
+		ExpectedStatus: []int{http.StatusCreated},
+		BodyRegex:      `"status":\s*"healthy"`,
+	}}
+	res := Run(context.Background(), cfg)
+	assert.True(t, res.Success, res.Error)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Positive(t, res.Timings.Connect)
+	assert.Positive(t, res.Timings.FirstByte)
+	assert.GreaterOrEqual(t, res.Timings.Total, res.Timings.FirstByte)
+
+	cfg.HTTP.BodyRegex = "degraded"
+	res = Run(context.Background(), cfg)
+	assert.False(t, res.Success)
+	assert.Contains(t, res.Error, "body does not match")
+
+	cfg.HTTP.Method = http.MethodGet
+	res = Run(context.Background(), cfg)
+	assert.False(t, res.Success)
+	assert.Equal(t, "unexpected status 400", res.Error)
+}
+
+func TestRunHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	cert := server.Certificate()
+
+	cfg := Config{Name: "tls", Type: TypeHTTP, Target: server.URL}
+	res := Run(context.Background(), cfg)
+	assert.False(t, res.Success, "self-signed certificate must be rejected")
+
+	cfg.HTTP = &HTTPConfig{TLSSkipVerify: true}
+	res = Run(context.Background(), cfg)
+	assert.True(t, res.Success, res.Error)
+	assert.Equal(t, cert.NotAfter.Unix(), res.TLSExpiry)
+	assert.Positive(t, res.Timings.TLS)
+
+	// the httptest certificate expires in 2084
+	cfg.HTTP.TLSExpiryDays = 365 * 100
+	res = Run(context.Background(), cfg)
+	assert.False(t, res.Success)
+	assert.Contains(t, res.Error, "certificate expires")
+}
+
+func TestRunTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+
+	res := Run(context.Background(), Config{Name: "tcp", Type: TypeTCP, Target: addr})
+	assert.True(t, res.Success, res.Error)
+
+	require.NoError(t, ln.Close())
+	res = Run(context.Background(), Config{Name: "tcp", Type: TypeTCP, Target: addr})
+	assert.False(t, res.Success)
+	assert.NotEmpty(t, res.Error)
+}
+
+func TestRunDNS(t *testing.T) {
+	cfg := Config{Name: "dns", Type: TypeDNS, Target: "localhost", DNS: &DNSConfig{Expected: []string{"127.0.0.1"}}}
+	res := Run(context.Background(), cfg)
+	assert.True(t, res.Success, res.Error)
+	assert.Contains(t, res.Answers, "127.0.0.1")
+
+	cfg.DNS.Expected = []string{"10.0.0.1"}
+	res = Run(context.Background(), cfg)
+	assert.False(t, res.Success)
+}
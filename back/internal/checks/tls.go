@@ -0,0 +1,228 @@
+package checks
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// filePrefix marks the target of a tls check reading a PEM file instead of
+// connecting to a server.
+const filePrefix = "file://"
+
+// certDirEnv names the directory holding the files the tls checks may read,
+// PEM targets and CA files alike. Any user can create a check: without this
+// directory, checks read no file at all.
+const certDirEnv = "CHECKS_CERT_DIR"
+
+// DefaultLeadTimes are the days before expiry a tls check alerts at.
+var DefaultLeadTimes = []int{30, 7, 1}
+
+type TLSConfig struct {
+	ServerName   string `json:"server_name,omitempty"`    // SNI and name verified, the target host by default
+	CAFile       string `json:"ca_file,omitempty"`        // PEM roots, the system ones by default
+	LeadTimeDays []int  `json:"lead_time_days,omitempty"` // DefaultLeadTimes when empty
+}
+
+func (c Config) tlsConfig() TLSConfig {
+	var opts TLSConfig
+	if c.TLS != nil {
+		opts = *c.TLS
+	}
+	if len(opts.LeadTimeDays) == 0 {
+		opts.LeadTimeDays = DefaultLeadTimes
+	}
+	return opts
+}
+
+// LeadTimes returns the days before expiry a tls check alerts at, none for
+// the other checks.
+func (c Config) LeadTimes() []int {
+	if c.Type != TypeTLS {
+		return nil
+	}
+	return c.tlsConfig().LeadTimeDays
+}
+
+func validateTLS(c Config) error {
+	if path, ok := strings.CutPrefix(c.Target, filePrefix); ok {
+		if path == "" {
+			return fmt.Errorf("invalid certificate path %q", c.Target)
+		}
+		if _, _, err := certFile(path); err != nil {
+			return err
+		}
+	} else if _, _, err := net.SplitHostPort(c.Target); err != nil {
+		return fmt.Errorf("invalid address %q: %w", c.Target, err)
+	}
+	if opts := c.tlsConfig(); opts.CAFile != "" {
+		if _, _, err := certFile(opts.CAFile); err != nil {
+			return fmt.Errorf("invalid ca_file: %w", err)
+		}
+	}
+	for _, days := range c.tlsConfig().LeadTimeDays {
+		if days <= 0 {
+			return fmt.Errorf("invalid lead time %d", days)
+		}
+	}
+	return nil
+}
+
+// certFile returns the certificate directory and the name in it of path,
+// absolute or relative to the directory, or an error when path is outside.
+func certFile(path string) (dir, name string, err error) {
+	dir = os.Getenv(certDirEnv)
+	if dir == "" {
+		return "", "", fmt.Errorf("%s is not set: checks cannot read files", certDirEnv)
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", "", err
+	}
+	name = path
+	if filepath.IsAbs(path) {
+		if name, err = filepath.Rel(dir, path); err != nil {
+			return "", "", fmt.Errorf("%s is not in %s", path, certDirEnv)
+		}
+	}
+	if !filepath.IsLocal(name) {
+		return "", "", fmt.Errorf("%s is not in %s", path, certDirEnv)
+	}
+	return dir, name, nil
+}
+
+// readCertFile reads a file of the certificate directory. Checked again at
+// run time, the stored checks may predate the directory; symlinks do not
+// lead out of it either.
+func readCertFile(path string) ([]byte, error) {
+	dir, name, err := certFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Certificate describes one certificate of a chain.
+type Certificate struct {
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	Serial    string   `json:"serial"`
+	DNSNames  []string `json:"dns_names,omitempty"`
+	NotBefore int64    `json:"not_before"`
+	NotAfter  int64    `json:"not_after"`
+	DaysLeft  float64  `json:"days_left"`
+	SHA256    string   `json:"sha256"`
+}
+
+// runTLS reads the certificate chain of a server or a PEM file, records it
+// and verifies it. An invalid chain, expired ones included, fails the check.
+func runTLS(ctx context.Context, cfg Config, res *Result) error {
+	opts := cfg.tlsConfig()
+	var chain []*x509.Certificate
+	serverName := opts.ServerName
+	if path, ok := strings.CutPrefix(cfg.Target, filePrefix); ok {
+		data, err := readCertFile(path)
+		if err != nil {
+			return err
+		}
+		if chain, err = parsePEMCertificates(data); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	} else {
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(cfg.Target)
+		}
+		start := time.Now()
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}}
+		conn, err := dialer.DialContext(ctx, "tcp", cfg.Target)
+		if err != nil {
+			return err
+		}
+		res.Timings.TLS = ms(time.Since(start))
+		chain = conn.(*tls.Conn).ConnectionState().PeerCertificates
+		_ = conn.Close()
+		if len(chain) == 0 {
+			return errors.New("no certificate presented")
+		}
+	}
+
+	now := time.Now()
+	for _, cert := range chain {
+		fingerprint := sha256.Sum256(cert.Raw)
+		res.Certificates = append(res.Certificates, Certificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			Serial:    cert.SerialNumber.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore.Unix(),
+			NotAfter:  cert.NotAfter.Unix(),
+			DaysLeft:  cert.NotAfter.Sub(now).Hours() / 24,
+			SHA256:    hex.EncodeToString(fingerprint[:]),
+		})
+		if res.TLSExpiry == 0 || cert.NotAfter.Unix() < res.TLSExpiry {
+			res.TLSExpiry = cert.NotAfter.Unix()
+		}
+	}
+
+	verify := x509.VerifyOptions{DNSName: serverName, Intermediates: x509.NewCertPool(), CurrentTime: now}
+	for _, cert := range chain[1:] {
+		verify.Intermediates.AddCert(cert)
+	}
+	if opts.CAFile != "" {
+		data, err := readCertFile(opts.CAFile)
+		if err != nil {
+			return err
+		}
+		verify.Roots = x509.NewCertPool()
+		if !verify.Roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s: no certificate found", opts.CAFile)
+		}
+	}
+	if _, err := chain[0].Verify(verify); err != nil {
+		return fmt.Errorf("invalid certificate: %w", err)
+	}
+	return nil
+}
+
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return chain, nil
+}
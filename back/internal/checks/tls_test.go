@@ -0,0 +1,207 @@
+package checks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPKI struct {
+	caFile   string
+	leafFile string // leaf then CA
+	leaf     tls.Certificate
+	notAfter time.Time
+}
+
+// newTestPKI issues a localhost certificate valid for the given duration,
+// signed by a throwaway CA, in the certificate directory.
+func newTestPKI(t *testing.T, validity time.Duration) testPKI {
+	dir := t.TempDir()
+	t.Setenv(certDirEnv, dir)
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	notAfter := time.Now().Add(validity).Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	pki := testPKI{
+		caFile:   filepath.Join(dir, "ca.pem"),
+		leafFile: filepath.Join(dir, "chain.pem"),
+		leaf:     tls.Certificate{Certificate: [][]byte{leafDER, caDER}, PrivateKey: key},
+		notAfter: notAfter,
+	}
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+	require.NoError(t, os.WriteFile(pki.caFile, caPEM, 0o644))
+	require.NoError(t, os.WriteFile(pki.leafFile, append(leafPEM, caPEM...), 0o644))
+	return pki
+}
+
+func serveTLS(t *testing.T, cert tls.Certificate) string {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = conn.(*tls.Conn).Handshake()
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRunTLSServer(t *testing.T) {
+	pki := newTestPKI(t, 10*24*time.Hour)
+	addr := serveTLS(t, pki.leaf)
+
+	cfg := Config{Name: "tls", Type: TypeTLS, Target: addr, TLS: &TLSConfig{ServerName: "localhost", CAFile: pki.caFile}}
+	require.NoError(t, cfg.Validate())
+	res := Run(context.Background(), cfg)
+	require.True(t, res.Success, res.Error)
+	require.Len(t, res.Certificates, 2)
+	assert.Equal(t, "CN=localhost", res.Certificates[0].Subject)
+	assert.Equal(t, "CN=Test CA", res.Certificates[0].Issuer)
+	assert.Equal(t, []string{"localhost"}, res.Certificates[0].DNSNames)
+	assert.InDelta(t, 10, res.Certificates[0].DaysLeft, 0.01)
+	assert.Equal(t, pki.notAfter.Unix(), res.TLSExpiry)
+	assert.Positive(t, res.Timings.TLS)
+
+	// unknown issuer with the system roots
+	cfg.TLS.CAFile = ""
+	res = Run(context.Background(), cfg)
+	assert.False(t, res.Success)
+	assert.Contains(t, res.Error, "invalid certificate")
+	assert.Len(t, res.Certificates, 2)
+
+	// wrong name
+	cfg.TLS = &TLSConfig{ServerName: "example.com", CAFile: pki.caFile}
+	res = Run(context.Background(), cfg)
+	assert.False(t, res.Success)
+	assert.Contains(t, res.Error, "example.com")
+}
+
+func TestRunTLSFile(t *testing.T) {
+	pki := newTestPKI(t, 48*time.Hour)
+	cfg := Config{Name: "file", Type: TypeTLS, Target: "file://" + pki.leafFile, TLS: &TLSConfig{CAFile: pki.caFile}}
+	require.NoError(t, cfg.Validate())
+	res := Run(context.Background(), cfg)
+	require.True(t, res.Success, res.Error)
+	assert.Len(t, res.Certificates, 2)
+	assert.Equal(t, pki.notAfter.Unix(), res.TLSExpiry)
+
+	samples := res.Samples(cfg)
+	last := samples[len(samples)-1]
+	assert.Equal(t, "check.tls_expiry_days", last.Metric)
+	assert.InDelta(t, 2, last.Value, 0.01)
+	assert.Empty(t, last.Host)
+
+	res = Run(context.Background(), Config{Name: "missing", Type: TypeTLS, Target: "file://" + pki.leafFile + ".missing"})
+	assert.False(t, res.Success)
+}
+
+func TestRunTLSExpired(t *testing.T) {
+	pki := newTestPKI(t, -time.Hour)
+	res := Run(context.Background(), Config{Name: "old", Type: TypeTLS, Target: "file://" + pki.leafFile, TLS: &TLSConfig{CAFile: pki.caFile}})
+	assert.False(t, res.Success)
+	assert.Contains(t, res.Error, "expired")
+	assert.Negative(t, res.Certificates[0].DaysLeft)
+}
+
+func TestTLSCertFilesConfined(t *testing.T) {
+	pki := newTestPKI(t, 48*time.Hour)
+	dir := filepath.Dir(pki.leafFile)
+	outside := filepath.Join(t.TempDir(), "secret.pem")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0o600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link.pem")))
+
+	valid := []Config{
+		{Name: "file", Type: TypeTLS, Target: "file://" + pki.leafFile, TLS: &TLSConfig{CAFile: pki.caFile}},
+		{Name: "relative", Type: TypeTLS, Target: "file://chain.pem", TLS: &TLSConfig{CAFile: "ca.pem"}},
+	}
+	for _, cfg := range valid {
+		assert.NoError(t, cfg.Validate(), cfg.Name)
+		res := Run(context.Background(), cfg)
+		assert.True(t, res.Success, res.Error)
+	}
+	invalid := []Config{
+		{Name: "outside", Type: TypeTLS, Target: "file://" + outside},
+		{Name: "parent", Type: TypeTLS, Target: "file://../secret.pem"},
+		{Name: "ca", Type: TypeTLS, Target: serveTLS(t, pki.leaf), TLS: &TLSConfig{ServerName: "localhost", CAFile: outside}},
+	}
+	for _, cfg := range invalid {
+		assert.Error(t, cfg.Validate(), cfg.Name)
+		res := Run(context.Background(), cfg)
+		assert.False(t, res.Success, cfg.Name)
+		assert.Contains(t, res.Error, "not in "+certDirEnv, cfg.Name)
+	}
+
+	// symlinks do not lead out of the directory
+	res := Run(context.Background(), Config{Name: "link", Type: TypeTLS, Target: "file://link.pem"})
+	assert.False(t, res.Success)
+	assert.NotContains(t, res.Error, "no certificate found")
+
+	// no directory, no file read
+	t.Setenv(certDirEnv, "")
+	assert.Error(t, valid[0].Validate())
+	res = Run(context.Background(), valid[0])
+	assert.False(t, res.Success)
+	assert.Contains(t, res.Error, certDirEnv)
+}
+
+func TestTLSLeadTimes(t *testing.T) {
+	cfg := Config{Name: "tls", Type: TypeTLS, Target: "example.com:443"}
+	assert.Equal(t, DefaultLeadTimes, cfg.LeadTimes())
+	cfg.TLS = &TLSConfig{LeadTimeDays: []int{14}}
+	assert.Equal(t, []int{14}, cfg.LeadTimes())
+	assert.Nil(t, Config{Name: "web", Type: TypeHTTP, Target: "https://example.com"}.LeadTimes())
+
+	cfg.TLS.LeadTimeDays = []int{0}
+	assert.Error(t, cfg.Validate())
+	assert.Error(t, Config{Name: "tls", Type: TypeTLS, Target: "example.com"}.Validate())
+}
@@ -0,0 +1,257 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	models "back/internal/domain"
+
+	"golang.org/x/sys/unix"
+)
+
+// Hostname is the name local samples are tagged with. It can be overridden
+// with MONITOVERSE_HOST, e.g. when running in a container.
+func Hostname() string {
+	if host := os.Getenv("MONITOVERSE_HOST"); host != "" {
+		return host
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+// HostInfo describes the local machine for the host inventory.
+func HostInfo() models.HostInfo {
+	info := models.HostInfo{
+		Hostname: Hostname(),
+		OS:       runtime.GOOS,
+		CPUCount: runtime.NumCPU(),
+	}
+	if name := osPrettyName(); name != "" {
+		info.OS = name
+	}
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err == nil {
+		info.Kernel = unix.ByteSliceToString(uname.Release[:])
+	}
+	if total, err := memTotalBytes(); err == nil {
+		info.TotalMemory = total
+	}
+	return info
+}
+
+// osPrettyName reads the distribution name from /etc/os-release.
+func osPrettyName() string {
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+func memTotalBytes() (uint64, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "MemTotal:") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				break
+			}
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("could not find MemTotal in /proc/meminfo")
+}
+
+// Collect takes a snapshot of every metric of the local machine.
+func Collect() (models.MonitoringData, error) {
+	cpuUsage, err := CPUUsage()
+	if err != nil {
+		return models.MonitoringData{}, err
+	}
+	memoryUsage, _ := MemoryUsage()
+	diskUsage, _ := DiskUsage()
+	now := time.Now()
+	return models.MonitoringData{
+		Host:        Hostname(),
+		Timestamp:   now.Unix(),
+		TimestampMS: now.UnixMilli(),
+		CPU:         cpuUsage,
+		Memory:      memoryUsage,
+		DiskRoot:    diskUsage["/"],
+		DiskHome:    diskUsage["/home"],
+	}, nil
+}
+
+func DiskUsage() (map[string]float64, error) {
+	usageMap := make(map[string]float64)
+
+	rootUsage, err := usageFor("/")
+	if err != nil {
+		return nil, fmt.Errorf("disk usage error for '/': %v", err)
+	}
+	usageMap["/"] = rootUsage
+
+	homeUsage, err := usageFor("/home")
+	if err != nil {
+		return nil, fmt.Errorf("disk usage error for '/home': %v", err)
+	}
+	usageMap["/home"] = homeUsage
+
+	return usageMap, nil
+}
+
+func usageFor(path string) (float64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	total := stat.Blocks * uint64(stat.Bsize)
+	free := stat.Bfree * uint64(stat.Bsize)
+	used := total - free
+
+	if total == 0 {
+		return 0, fmt.Errorf("total blocks are zero on path: %s", path)
+	}
+
+	usagePercent := float64(used) / float64(total) * 100.0
+	return usagePercent, nil
+}
+
+type cpuTimes struct {
+	user    uint64
+	nice    uint64
+	system  uint64
+	idle    uint64
+	iowait  uint64
+	irq     uint64
+	softirq uint64
+	steal   uint64
+	total   uint64
+}
+
+func CPUUsage() (float64, error) {
+	c1, err := readCPUSnapshot()
+	if err != nil {
+		return 0.0, err
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	c2, err := readCPUSnapshot()
+	if err != nil {
+		return 0.0, err
+	}
+
+	idleDelta := float64((c2.idle + c2.iowait) - (c1.idle + c1.iowait))
+	totalDelta := float64(c2.total - c1.total)
+
+	if totalDelta == 0 {
+		return 0.0, nil
+	}
+
+	usage := (1.0 - idleDelta/totalDelta) * 100.0
+	return usage, nil
+}
+
+// readCPUSnapshot parses the first "cpu " line in /proc/stat to extract CPU counters
+func readCPUSnapshot() (*cpuTimes, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "cpu ") {
+			fields := strings.Fields(line)
+			if len(fields) < 8 {
+				break
+			}
+
+			user, _ := strconv.ParseUint(fields[1], 10, 64)
+			nice, _ := strconv.ParseUint(fields[2], 10, 64)
+			system, _ := strconv.ParseUint(fields[3], 10, 64)
+			idle, _ := strconv.ParseUint(fields[4], 10, 64)
+			iowait, _ := strconv.ParseUint(fields[5], 10, 64)
+			irq, _ := strconv.ParseUint(fields[6], 10, 64)
+			softirq, _ := strconv.ParseUint(fields[7], 10, 64)
+
+			var steal uint64
+			if len(fields) > 8 {
+				steal, _ = strconv.ParseUint(fields[8], 10, 64)
+			}
+
+			total := user + nice + system + idle + iowait + irq + softirq + steal
+			return &cpuTimes{
+				user:    user,
+				nice:    nice,
+				system:  system,
+				idle:    idle,
+				iowait:  iowait,
+				irq:     irq,
+				softirq: softirq,
+				steal:   steal,
+				total:   total,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find 'cpu ' line in /proc/stat")
+}
+
+func MemoryUsage() (float64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil {
+			log.Printf("warning: échec de la fermeture du fichier : %v", cerr)
+		}
+	}()
+
+	var totalMem, availableMem uint64
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "MemTotal:") {
+			fields := strings.Fields(line)
+			totalMem, _ = strconv.ParseUint(fields[1], 10, 64)
+		} else if strings.HasPrefix(line, "MemAvailable:") {
+			fields := strings.Fields(line)
+			availableMem, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	if totalMem == 0 {
+		return 0, fmt.Errorf("could not find MemTotal in /proc/meminfo")
+	}
+
+	used := totalMem - availableMem
+	usage := (float64(used) / float64(totalMem)) * 100.0
+
+	return usage, nil
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// AlertRule is an alert rule created through the API, Config holding the
+// JSON of its definition
+type AlertRule struct {
+	Name      string    `gorm:"primaryKey;size:255" json:"name"`
+	Config    string    `gorm:"type:text;not null" json:"config"`
+	CreatedAt time.Time `json:"created_at"`
+}
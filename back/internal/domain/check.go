@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Check is a synthetic check, Config holding the JSON of its definition as
+// received by the API
+type Check struct {
+	Name      string    `gorm:"primaryKey;size:255" json:"name"`
+	Config    string    `gorm:"type:text;not null" json:"config"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CheckResult is a run of a check, Result holding the JSON of its outcome
+type CheckResult struct {
+	ID        int64  `gorm:"primaryKey;index:idx_check_results_check,priority:2" json:"id"`
+	CheckName string `gorm:"size:255;not null;index:idx_check_results_check,priority:1" json:"check_name"`
+	Timestamp int64  `gorm:"not null" json:"timestamp"`
+	Success   bool   `json:"success"`
+	Result    string `gorm:"type:text;not null" json:"result"`
+}
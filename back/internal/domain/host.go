@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Host is a machine reporting metrics, either the server itself or a remote agent
+type Host struct {
+	ID           string            `gorm:"primaryKey" json:"id"`
+	Hostname     string            `gorm:"size:255;not null;unique" json:"hostname"`
+	Labels       map[string]string `gorm:"serializer:json" json:"labels"`
+	OS           string            `json:"os"`
+	Kernel       string            `json:"kernel"`
+	CPUCount     int               `json:"cpu_count"`
+	TotalMemory  uint64            `json:"total_memory"` // bytes
+	LastSeen     time.Time         `json:"last_seen"`
+	AgentVersion string            `json:"agent_version"`
+	AgentKeyHash string            `gorm:"size:64;index" json:"-"`
+	Online       bool              `gorm:"-" json:"online"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+func (host *Host) BeforeCreate(tx *gorm.DB) (err error) {
+	host.ID = uuid.NewString()
+	return
+}
+
+// HostInfo describes a host when it enrolls
+type HostInfo struct {
+	Hostname     string            `json:"hostname" binding:"required"`
+	Labels       map[string]string `json:"labels"`
+	OS           string            `json:"os"`
+	Kernel       string            `json:"kernel"`
+	CPUCount     int               `json:"cpu_count"`
+	TotalMemory  uint64            `json:"total_memory"`
+	AgentVersion string            `json:"agent_version"`
+}
+
+// EnrollmentToken lets new agents register themselves until it expires or is revoked
+type EnrollmentToken struct {
+	ID          string     `gorm:"primaryKey" json:"id"`
+	TokenHash   string     `gorm:"size:64;not null;unique" json:"-"`
+	Description string     `json:"description"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (token *EnrollmentToken) BeforeCreate(tx *gorm.DB) (err error) {
+	token.ID = uuid.NewString()
+	return
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LogMetricRule counts the lines of a log source matching Regex into the
+// series Metric
+type LogMetricRule struct {
+	Metric     string    `gorm:"primaryKey;size:255" json:"metric"`
+	Source     string    `gorm:"size:255;not null" json:"source"`
+	Regex      string    `gorm:"type:text;not null" json:"regex"`
+	IntervalMS int       `json:"interval_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// MonitoringData holds a snapshot of all metrics of a host at a point in time
+type MonitoringData struct {
+	ID          int64   `json:"id"`
+	Host        string  `json:"host"`
+	Timestamp   int64   `json:"timestamp"`
+	TimestampMS int64   `json:"timestamp_ms,omitempty"` // same instant in milliseconds, identifies the sample of its host
+	CPU         float64 `json:"cpu"`
+	Memory      float64 `json:"memory"`
+	DiskRoot    float64 `json:"disk_root"`
+	DiskHome    float64 `json:"disk_home"`
+}
+
+// AgentSamples is the payload a remote agent pushes to the server
+type AgentSamples struct {
+	Host         string           `json:"host"`
+	AgentVersion string           `json:"agent_version,omitempty"`
+	Samples      []MonitoringData `json:"samples"`
+}
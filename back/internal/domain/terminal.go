@@ -0,0 +1,74 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TerminalCommandRecord is a command run from the terminal, kept in the
+// history of the user who ran it
+type TerminalCommandRecord struct {
+	ID            string    `gorm:"primaryKey" json:"id"`
+	UserID        string    `gorm:"size:36;not null;index:idx_terminal_history_user,priority:1" json:"user_id"`
+	CommandID     string    `gorm:"size:255" json:"command_id"` // ID given by the client
+	Command       string    `gorm:"type:text;not null" json:"command"`
+	Output        string    `gorm:"type:text" json:"output"`
+	Error         string    `gorm:"type:text" json:"error"`
+	Status        int       `json:"status"`
+	Signal        string    `gorm:"size:16" json:"signal,omitempty"`
+	State         string    `gorm:"size:16" json:"state"`
+	Target        string    `gorm:"size:16" json:"target"`
+	ContainerName string    `gorm:"size:255" json:"container_name,omitempty"`
+	UseSudo       bool      `json:"use_sudo"`
+	CreatedAt     time.Time `gorm:"index:idx_terminal_history_user,priority:2" json:"created_at"`
+}
+
+func (record *TerminalCommandRecord) BeforeCreate(tx *gorm.DB) (err error) {
+	record.ID = uuid.NewString()
+	return
+}
+
+// TerminalAuditEntry records a command run from the terminal, an
+// interactive session or a line submitted in one. A command or a session has
+// a "started" entry before it runs and another one when it ends, whose
+// StartSeq is the sequence number of the first. Entries are only appended,
+// each one sealed to the previous one by its Hash, so that changing or
+// removing one breaks the chain.
+type TerminalAuditEntry struct {
+	Seq           uint64    `gorm:"primaryKey;autoIncrement:false" json:"seq"`
+	Time          time.Time `gorm:"not null;index" json:"time"` // start, to the millisecond
+	UserID        string    `gorm:"size:36;not null" json:"user_id"`
+	UserEmail     string    `gorm:"size:255" json:"user_email"`
+	SourceIP      string    `gorm:"size:45" json:"source_ip"`
+	Mode          string    `gorm:"size:16" json:"mode"` // "command", "pty" or "pty-input"
+	Command       string    `gorm:"type:text;not null" json:"command"`
+	Target        string    `gorm:"size:16" json:"target"`
+	ContainerName string    `gorm:"size:255" json:"container_name"`
+	UseSudo       bool      `json:"use_sudo"`
+	ExitCode      int       `json:"exit_code"`
+	Signal        string    `gorm:"size:16" json:"signal"`
+	State         string    `gorm:"size:16" json:"state"`
+	DurationMS    int64     `json:"duration_ms"`
+	OutputHash    string    `gorm:"size:64" json:"output_hash"` // SHA-256 of the raw output
+	StartSeq      uint64    `json:"start_seq,omitempty"`        // entry of the command or session started
+	PrevHash      string    `gorm:"size:64;uniqueIndex" json:"prev_hash"`
+	Hash          string    `gorm:"size:64;not null" json:"hash"`
+}
+
+// ComputeHash returns the SHA-256 of PrevHash, a newline and the JSON array
+// of the other fields in declaration order, Time in unix milliseconds.
+func (entry *TerminalAuditEntry) ComputeHash() string {
+	fields, _ := json.Marshal([]any{
+		entry.Seq, entry.Time.UnixMilli(), entry.UserID, entry.UserEmail, entry.SourceIP,
+		entry.Mode, entry.Command, entry.Target, entry.ContainerName, entry.UseSudo,
+		entry.ExitCode, entry.Signal, entry.State, entry.DurationMS, entry.OutputHash,
+		entry.StartSeq,
+	})
+	sum := sha256.Sum256(append([]byte(entry.PrevHash+"\n"), fields...))
+	return hex.EncodeToString(sum[:])
+}
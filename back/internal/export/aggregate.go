@@ -0,0 +1,116 @@
+package export
+
+import (
+	"fmt"
+	"math"
+)
+
+// Aggregations of the rows of a step.
+const (
+	AggAvg  = "avg"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggLast = "last"
+)
+
+// ValidAggregation tells whether agg is one of the aggregations above.
+func ValidAggregation(agg string) bool {
+	switch agg {
+	case AggAvg, AggMin, AggMax, AggLast:
+		return true
+	}
+	return false
+}
+
+type bucketKey struct {
+	host, metric string
+}
+
+type bucket struct {
+	start int64
+	count int
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+}
+
+// aggregatingWriter reduces the rows of each host and metric to one row
+// per step, timestamped at the start of the step. Rows must come in time
+// order for a given host and metric.
+type aggregatingWriter struct {
+	next    Writer
+	step    int64
+	agg     string
+	pending map[bucketKey]*bucket
+	order   []bucketKey
+}
+
+// NewAggregatingWriter wraps next to aggregate rows over step seconds.
+func NewAggregatingWriter(next Writer, step int64, agg string) (Writer, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid aggregation step %d", step)
+	}
+	if !ValidAggregation(agg) {
+		return nil, fmt.Errorf("unknown aggregation %q", agg)
+	}
+	return &aggregatingWriter{next: next, step: step, agg: agg, pending: map[bucketKey]*bucket{}}, nil
+}
+
+func (a *aggregatingWriter) WriteRow(row Row) error {
+	key := bucketKey{row.Host, row.Metric}
+	start := row.Timestamp - mod(row.Timestamp, a.step)
+	b, ok := a.pending[key]
+	if ok && b.start != start {
+		if err := a.emit(key, b); err != nil {
+			return err
+		}
+		ok = false
+	}
+	if !ok {
+		b = &bucket{start: start, min: math.Inf(1), max: math.Inf(-1)}
+		if _, known := a.pending[key]; !known {
+			a.order = append(a.order, key)
+		}
+		a.pending[key] = b
+	}
+	b.count++
+	b.sum += row.Value
+	b.min = math.Min(b.min, row.Value)
+	b.max = math.Max(b.max, row.Value)
+	b.last = row.Value
+	return nil
+}
+
+func (a *aggregatingWriter) emit(key bucketKey, b *bucket) error {
+	row := Row{Timestamp: b.start, Host: key.host, Metric: key.metric}
+	switch a.agg {
+	case AggAvg:
+		row.Value = b.sum / float64(b.count)
+	case AggMin:
+		row.Value = b.min
+	case AggMax:
+		row.Value = b.max
+	case AggLast:
+		row.Value = b.last
+	}
+	return a.next.WriteRow(row)
+}
+
+func (a *aggregatingWriter) Close() error {
+	for _, key := range a.order {
+		if b := a.pending[key]; b != nil {
+			if err := a.emit(key, b); err != nil {
+				return err
+			}
+		}
+	}
+	a.pending = map[bucketKey]*bucket{}
+	a.order = nil
+	return a.next.Close()
+}
+
+// mod is the floor modulo, so that negative timestamps fall in the right step.
+func mod(a, b int64) int64 {
+	return ((a % b) + b) % b
+}
@@ -0,0 +1,106 @@
+// Package export writes metric samples as CSV, JSON Lines or Parquet, one
+// row per value, without buffering the whole export.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case CSV, NDJSON, Parquet:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnknownFormat, s)
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+// Row is the value of one metric of a host at a unix timestamp in seconds.
+type Row struct {
+	Timestamp int64   `json:"timestamp"`
+	Host      string  `json:"host"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+}
+
+// Writer writes rows to an export. Close flushes what is pending and ends
+// the file; it does not close the underlying io.Writer.
+type Writer interface {
+	WriteRow(row Row) error
+	Close() error
+}
+
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w)
+	case NDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case Parquet:
+		return NewParquetWriter(w, DefaultRowGroupSize), nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	return c, c.w.Write([]string{"time", "host", "metric", "value"})
+}
+
+func (c *csvWriter) WriteRow(row Row) error {
+	return c.w.Write([]string{
+		time.Unix(row.Timestamp, 0).UTC().Format(time.RFC3339),
+		row.Host,
+		row.Metric,
+		strconv.FormatFloat(row.Value, 'f', -1, 64),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) WriteRow(row Row) error {
+	return n.enc.Encode(row)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRows = []Row{
+	{Timestamp: 60, Host: "web-1", Metric: "cpu", Value: 10},
+	{Timestamp: 60, Host: "web-1", Metric: "memory", Value: 40},
+	{Timestamp: 90, Host: "web-1", Metric: "cpu", Value: 20},
+	{Timestamp: 90, Host: "web-1", Metric: "memory", Value: 50},
+	{Timestamp: 120, Host: "web-1", Metric: "cpu", Value: 35.5},
+	{Timestamp: 120, Host: "web-1", Metric: "memory", Value: 60},
+}
+
+func writeAll(t *testing.T, w Writer, rows []Row) {
+	for _, row := range rows {
+		require.NoError(t, w.WriteRow(row))
+	}
+	require.NoError(t, w.Close())
+}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(CSV, &buf)
+	require.NoError(t, err)
+	writeAll(t, w, testRows[:2])
+	assert.Equal(t, "time,host,metric,value\n"+
+		"1970-01-01T00:01:00Z,web-1,cpu,10\n"+
+		"1970-01-01T00:01:00Z,web-1,memory,40\n", buf.String())
+}
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(NDJSON, &buf)
+	require.NoError(t, err)
+	writeAll(t, w, testRows[4:5])
+	assert.JSONEq(t, `{"timestamp":120,"host":"web-1","metric":"cpu","value":35.5}`, buf.String())
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("parquet")
+	require.NoError(t, err)
+	assert.Equal(t, Parquet, f)
+	_, err = ParseFormat("xlsx")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+// collector keeps the rows written to it
+type collector struct {
+	rows   []Row
+	closed bool
+}
+
+func (c *collector) WriteRow(row Row) error { c.rows = append(c.rows, row); return nil }
+func (c *collector) Close() error           { c.closed = true; return nil }
+
+func TestAggregation(t *testing.T) {
+	tests := []struct {
+		agg  string
+		want []float64 // cpu and memory of the [60,120) step, then of [120,180)
+	}{
+		{AggAvg, []float64{15, 45, 35.5, 60}},
+		{AggMin, []float64{10, 40, 35.5, 60}},
+		{AggMax, []float64{20, 50, 35.5, 60}},
+		{AggLast, []float64{20, 50, 35.5, 60}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agg, func(t *testing.T) {
+			c := &collector{}
+			w, err := NewAggregatingWriter(c, 60, tt.agg)
+			require.NoError(t, err)
+			writeAll(t, w, testRows)
+
+			require.Len(t, c.rows, 4)
+			var values []float64
+			for _, row := range c.rows {
+				values = append(values, row.Value)
+			}
+			assert.Equal(t, tt.want, values)
+			assert.Equal(t, Row{Timestamp: 60, Host: "web-1", Metric: "cpu", Value: tt.want[0]}, c.rows[0])
+			assert.Equal(t, int64(120), c.rows[2].Timestamp)
+			assert.True(t, c.closed)
+		})
+	}
+
+	_, err := NewAggregatingWriter(&collector{}, 0, AggAvg)
+	assert.Error(t, err)
+	_, err = NewAggregatingWriter(&collector{}, 60, "median")
+	assert.Error(t, err)
+}
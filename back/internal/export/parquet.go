@@ -0,0 +1,295 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// DefaultRowGroupSize is the number of rows buffered before a row group is
+// written, which bounds the memory used by a Parquet export.
+const DefaultRowGroupSize = 10000
+
+const parquetMagic = "PAR1"
+
+// Parquet enums, see parquet.thrift.
+const (
+	parquetTypeInt64     int32 = 2
+	parquetTypeDouble    int32 = 5
+	parquetTypeByteArray int32 = 6
+
+	parquetRequired int32 = 0
+
+	parquetConvertedUTF8            int32 = 0
+	parquetConvertedTimestampMillis int32 = 9
+
+	parquetEncodingPlain int32 = 0
+	parquetEncodingRLE   int32 = 3
+
+	parquetCodecUncompressed int32 = 0
+	parquetPageData          int32 = 0
+)
+
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32
+	encode    func(buf *bytes.Buffer, row Row)
+}
+
+// parquetColumns is the schema of the export: the same columns as the CSV
+// export, all required, PLAIN encoded and uncompressed.
+var parquetColumns = []parquetColumn{
+	{"time", parquetTypeInt64, parquetConvertedTimestampMillis, func(buf *bytes.Buffer, row Row) {
+		_ = binary.Write(buf, binary.LittleEndian, row.Timestamp*1000)
+	}},
+	{"host", parquetTypeByteArray, parquetConvertedUTF8, func(buf *bytes.Buffer, row Row) {
+		writeByteArray(buf, row.Host)
+	}},
+	{"metric", parquetTypeByteArray, parquetConvertedUTF8, func(buf *bytes.Buffer, row Row) {
+		writeByteArray(buf, row.Metric)
+	}},
+	{"value", parquetTypeDouble, -1, func(buf *bytes.Buffer, row Row) {
+		_ = binary.Write(buf, binary.LittleEndian, math.Float64bits(row.Value))
+	}},
+}
+
+func writeByteArray(buf *bytes.Buffer, s string) {
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+// ParquetWriter writes rows as a Parquet file, one row group every
+// rowGroupSize rows. The footer is written by Close.
+type ParquetWriter struct {
+	w            io.Writer
+	offset       int64
+	rowGroupSize int
+	rows         []Row
+	rowGroups    []thriftStruct
+	numRows      int64
+}
+
+func NewParquetWriter(w io.Writer, rowGroupSize int) *ParquetWriter {
+	return &ParquetWriter{w: w, rowGroupSize: max(rowGroupSize, 1)}
+}
+
+func (p *ParquetWriter) WriteRow(row Row) error {
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= p.rowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+// start writes the leading magic number, on the first row group or on Close
+// for an empty export.
+func (p *ParquetWriter) start() error {
+	if p.offset > 0 {
+		return nil
+	}
+	return p.write([]byte(parquetMagic))
+}
+
+func (p *ParquetWriter) write(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+// flush writes the buffered rows as a row group with one data page per column.
+func (p *ParquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	if err := p.start(); err != nil {
+		return err
+	}
+	var chunks thriftList
+	chunks.elem = thriftTypeStruct
+	var groupSize int64
+	for _, col := range parquetColumns {
+		var page bytes.Buffer
+		for _, row := range p.rows {
+			col.encode(&page, row)
+		}
+		header := thriftStruct{
+			{1, parquetPageData},
+			{2, int32(page.Len())},
+			{3, int32(page.Len())},
+			{5, thriftStruct{
+				{1, int32(len(p.rows))},
+				{2, parquetEncodingPlain},
+				{3, parquetEncodingRLE},
+				{4, parquetEncodingRLE},
+			}},
+		}.encode()
+
+		pageOffset := p.offset
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(page.Bytes()); err != nil {
+			return err
+		}
+		size := int64(len(header) + page.Len())
+		groupSize += size
+		chunks.values = append(chunks.values, thriftStruct{
+			{2, pageOffset},
+			{3, thriftStruct{
+				{1, col.typ},
+				{2, thriftList{thriftTypeI32, []any{parquetEncodingPlain, parquetEncodingRLE}}},
+				{3, thriftList{thriftTypeBinary, []any{col.name}}},
+				{4, parquetCodecUncompressed},
+				{5, int64(len(p.rows))},
+				{6, size},
+				{7, size},
+				{9, pageOffset},
+			}},
+		})
+	}
+	p.rowGroups = append(p.rowGroups, thriftStruct{
+		{1, chunks},
+		{2, groupSize},
+		{3, int64(len(p.rows))},
+	})
+	p.numRows += int64(len(p.rows))
+	p.rows = p.rows[:0]
+	return nil
+}
+
+func (p *ParquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if err := p.start(); err != nil {
+		return err
+	}
+
+	schema := thriftList{elem: thriftTypeStruct}
+	schema.values = append(schema.values, thriftStruct{
+		{4, "schema"},
+		{5, int32(len(parquetColumns))},
+	})
+	for _, col := range parquetColumns {
+		element := thriftStruct{{1, col.typ}, {3, parquetRequired}, {4, col.name}}
+		if col.converted >= 0 {
+			element = append(element, thriftField{6, col.converted})
+		}
+		schema.values = append(schema.values, element)
+	}
+	rowGroups := thriftList{elem: thriftTypeStruct}
+	for _, group := range p.rowGroups {
+		rowGroups.values = append(rowGroups.values, group)
+	}
+	footer := thriftStruct{
+		{1, int32(1)},
+		{2, schema},
+		{3, p.numRows},
+		{4, rowGroups},
+		{6, "monitoverse"},
+	}.encode()
+
+	if err := p.write(footer); err != nil {
+		return err
+	}
+	var tail [8]byte
+	binary.LittleEndian.PutUint32(tail[:4], uint32(len(footer)))
+	copy(tail[4:], parquetMagic)
+	return p.write(tail[:])
+}
+
+// Thrift compact protocol, just what the Parquet metadata needs: structs
+// of i32, i64, strings, structs and lists.
+
+const (
+	thriftTypeI32    byte = 5
+	thriftTypeI64    byte = 6
+	thriftTypeBinary byte = 8
+	thriftTypeList   byte = 9
+	thriftTypeStruct byte = 12
+)
+
+type thriftField struct {
+	id    int16
+	value any // int32, int64, string, thriftStruct or thriftList
+}
+
+// thriftStruct lists its fields in increasing id order.
+type thriftStruct []thriftField
+
+type thriftList struct {
+	elem   byte
+	values []any
+}
+
+func (s thriftStruct) encode() []byte {
+	var buf bytes.Buffer
+	s.writeTo(&buf)
+	return buf.Bytes()
+}
+
+func (s thriftStruct) writeTo(buf *bytes.Buffer) {
+	var last int16
+	for _, field := range s {
+		typ := thriftTypeOf(field.value)
+		if delta := field.id - last; delta > 0 && delta <= 15 {
+			buf.WriteByte(byte(delta)<<4 | typ)
+		} else {
+			buf.WriteByte(typ)
+			writeVarint(buf, zigzag(int64(field.id)))
+		}
+		writeThriftValue(buf, field.value)
+		last = field.id
+	}
+	buf.WriteByte(0) // stop
+}
+
+func thriftTypeOf(v any) byte {
+	switch v.(type) {
+	case int32:
+		return thriftTypeI32
+	case int64:
+		return thriftTypeI64
+	case string:
+		return thriftTypeBinary
+	case thriftList:
+		return thriftTypeList
+	default:
+		return thriftTypeStruct
+	}
+}
+
+func writeThriftValue(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case int32:
+		writeVarint(buf, zigzag(int64(v)))
+	case int64:
+		writeVarint(buf, zigzag(v))
+	case string:
+		writeVarint(buf, uint64(len(v)))
+		buf.WriteString(v)
+	case thriftStruct:
+		v.writeTo(buf)
+	case thriftList:
+		if len(v.values) < 15 {
+			buf.WriteByte(byte(len(v.values))<<4 | v.elem)
+		} else {
+			buf.WriteByte(0xf0 | v.elem)
+			writeVarint(buf, uint64(len(v.values)))
+		}
+		for _, value := range v.values {
+			writeThriftValue(buf, value)
+		}
+	}
+}
+
+func zigzag(n int64) uint64 {
+	return uint64(n<<1) ^ uint64(n>>63)
+}
+
+func writeVarint(buf *bytes.Buffer, n uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], n)])
+}
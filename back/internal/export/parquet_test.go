@@ -0,0 +1,174 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thriftReader decodes the compact protocol into maps of field id to value,
+// enough to check the metadata written by ParquetWriter.
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) varint() int64 {
+	n, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		panic(err)
+	}
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+func (t *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftTypeI32, thriftTypeI64:
+		return t.varint()
+	case thriftTypeBinary:
+		n, _ := binary.ReadUvarint(t.r)
+		b := make([]byte, n)
+		_, _ = t.r.Read(b)
+		return string(b)
+	case thriftTypeList:
+		header, _ := t.r.ReadByte()
+		size := int(header >> 4)
+		if size == 15 {
+			n, _ := binary.ReadUvarint(t.r)
+			size = int(n)
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = t.value(header & 0x0f)
+		}
+		return list
+	case thriftTypeStruct:
+		return t.structValue()
+	}
+	panic("unexpected thrift type")
+}
+
+func (t *thriftReader) structValue() map[int16]any {
+	fields := map[int16]any{}
+	var last int16
+	for {
+		header, _ := t.r.ReadByte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(t.varint())
+		}
+		fields[id] = t.value(header & 0x0f)
+		last = id
+	}
+}
+
+func TestParquetLayout(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewParquetWriter(&buf, 4)
+	writeAll(t, w, testRows)
+	data := buf.Bytes()
+
+	require.Equal(t, "PAR1", string(data[:4]))
+	require.Equal(t, "PAR1", string(data[len(data)-4:]))
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-footerLen : len(data)-8]
+	meta := (&thriftReader{bytes.NewReader(footer)}).structValue()
+
+	assert.Equal(t, int64(len(testRows)), meta[3])
+	schema := meta[2].([]any)
+	require.Len(t, schema, 5)
+	assert.Equal(t, int64(4), schema[0].(map[int16]any)[5])
+	assert.Equal(t, "value", schema[4].(map[int16]any)[4])
+
+	// 6 rows in groups of 4
+	groups := meta[4].([]any)
+	require.Len(t, groups, 2)
+	assert.Equal(t, int64(4), groups[0].(map[int16]any)[3])
+	assert.Equal(t, int64(2), groups[1].(map[int16]any)[3])
+
+	// read back the value column of the second row group
+	chunk := groups[1].(map[int16]any)[1].([]any)[3].(map[int16]any)[3].(map[int16]any)
+	assert.Equal(t, []any{"value"}, chunk[3])
+	page := bytes.NewReader(data[chunk[9].(int64):])
+	header := (&thriftReader{page}).structValue()
+	assert.Equal(t, int64(2), header[5].(map[int16]any)[1])
+	var values [2]uint64
+	require.NoError(t, binary.Read(page, binary.LittleEndian, &values))
+	assert.Equal(t, 35.5, math.Float64frombits(values[0]))
+	assert.Equal(t, 60.0, math.Float64frombits(values[1]))
+
+	// the host column is length-prefixed strings
+	chunk = groups[0].(map[int16]any)[1].([]any)[1].(map[int16]any)[3].(map[int16]any)
+	page = bytes.NewReader(data[chunk[9].(int64):])
+	(&thriftReader{page}).structValue()
+	var n uint32
+	require.NoError(t, binary.Read(page, binary.LittleEndian, &n))
+	host := make([]byte, n)
+	_, _ = page.Read(host)
+	assert.Equal(t, "web-1", string(host))
+}
+
+func TestParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewParquetWriter(&buf, 10).Close())
+	data := buf.Bytes()
+	assert.Equal(t, "PAR1", string(data[:4]))
+	assert.Equal(t, "PAR1", string(data[len(data)-4:]))
+	meta := (&thriftReader{bytes.NewReader(data[4 : len(data)-8])}).structValue()
+	assert.Equal(t, int64(0), meta[3])
+}
+
+// TestParquetReferenceReaders reads an export back with pyarrow and the
+// DuckDB CLI, which are not vendored: each reader that is not installed is
+// skipped.
+func TestParquetReferenceReaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.parquet")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	writeAll(t, NewParquetWriter(f, 4), testRows)
+	require.NoError(t, f.Close())
+
+	var want strings.Builder
+	for _, row := range testRows {
+		fmt.Fprintf(&want, "%d,%s,%s,%g\n", row.Timestamp*1000, row.Host, row.Metric, row.Value)
+	}
+
+	readers := map[string]struct{ probe, read []string }{
+		"pyarrow": {
+			probe: []string{"python3", "-c", "import pyarrow"},
+			read: []string{"python3", "-c", `import sys, pyarrow.parquet as pq
+t = pq.read_table(sys.argv[1])
+assert [str(f.type) for f in t.schema] == ["timestamp[ms]", "string", "string", "double"], t.schema
+cols = [t.column("time").cast("int64")] + [t.column(name) for name in ("host", "metric", "value")]
+for time, host, metric, value in zip(*[c.to_pylist() for c in cols]):
+    print("%d,%s,%s,%g" % (time, host, metric, value))`, path},
+		},
+		"duckdb": {
+			probe: []string{"duckdb", "-version"},
+			read: []string{"duckdb", "-noheader", "-csv", "-c",
+				fmt.Sprintf("SELECT epoch_ms(time), host, metric, printf('%%g', value) FROM read_parquet('%s')", path)},
+		},
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			if exec.Command(reader.probe[0], reader.probe[1:]...).Run() != nil {
+				t.Skipf("%s is not installed", name)
+			}
+			args := reader.read
+			out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+			require.NoError(t, err, "%s", out)
+			assert.Equal(t, want.String(), string(out))
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// Package logs tails log files, following rotations, keeps their last lines
+// in memory and broadcasts the new ones to subscribers.
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownSource = errors.New("unknown log source")
+
+// Source is a named set of files, given as a path or a glob pattern.
+type Source struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// ParseSources reads "name=pattern" entries separated by commas, e.g.
+// "nginx=/var/log/nginx/*.log,app=/srv/app/app.log".
+func ParseSources(s string) ([]Source, error) {
+	var sources []Source
+	names := map[string]bool{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, pattern, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || pattern == "" {
+			return nil, fmt.Errorf("invalid log source %q, expected name=pattern", entry)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate log source %q", name)
+		}
+		names[name] = true
+		sources = append(sources, Source{Name: name, Pattern: pattern})
+	}
+	return sources, nil
+}
+
+// SourcesFromEnv reads LOG_SOURCES, see ParseSources.
+func SourcesFromEnv() ([]Source, error) {
+	return ParseSources(os.Getenv("LOG_SOURCES"))
+}
+
+type Line struct {
+	ID     int64  `json:"id"`
+	Source string `json:"source"`
+	File   string `json:"file"`
+	Time   int64  `json:"time"` // unix milliseconds the line was read
+	Text   string `json:"text"`
+}
+
+// Filter selects lines containing a substring and matching a regular
+// expression, both optional.
+type Filter struct {
+	Contains string
+	Regex    *regexp.Regexp
+}
+
+func (f Filter) Match(text string) bool {
+	if f.Contains != "" && !strings.Contains(text, f.Contains) {
+		return false
+	}
+	return f.Regex == nil || f.Regex.MatchString(text)
+}
+
+// SourceInfo describes a source and the files it currently tails.
+type SourceInfo struct {
+	Source
+	Files []string `json:"files"`
+}
+
+// Subscription receives the new lines of a source. Lines are dropped when
+// the subscriber does not keep up.
+type Subscription struct {
+	C <-chan Line
+
+	c      chan Line
+	source *source
+	once   sync.Once
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.source.hub.mu.Lock()
+		delete(s.source.subscribers, s)
+		s.source.hub.mu.Unlock()
+	})
+}
+
+type source struct {
+	hub         *Hub
+	cfg         Source
+	files       map[string]*tailedFile
+	lines       []Line
+	subscribers map[*Subscription]struct{}
+	counters    map[*counter]struct{}
+}
+
+// Hub tails every source.
+type Hub struct {
+	limit int // lines kept per source
+	poll  time.Duration
+
+	mu      sync.Mutex
+	sources map[string]*source
+	nextID  int64
+}
+
+// NewHub keeps limit lines per source and looks for new data every poll.
+func NewHub(sources []Source, limit int, poll time.Duration) *Hub {
+	h := &Hub{limit: limit, poll: poll, sources: map[string]*source{}, nextID: 1}
+	for _, cfg := range sources {
+		h.sources[cfg.Name] = &source{hub: h, cfg: cfg, files: map[string]*tailedFile{},
+			subscribers: map[*Subscription]struct{}{}, counters: map[*counter]struct{}{}}
+	}
+	return h
+}
+
+// Run tails the files until ctx is done. The files present at start are
+// read from their last lines, the ones appearing later from the beginning.
+func (h *Hub) Run(ctx context.Context) {
+	h.scan(true)
+	ticker := time.NewTicker(h.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.scan(false)
+		case <-ctx.Done():
+			h.mu.Lock()
+			for _, src := range h.sources {
+				for _, f := range src.files {
+					f.close()
+				}
+			}
+			h.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (h *Hub) scan(initial bool) {
+	h.mu.Lock()
+	sources := make([]*source, 0, len(h.sources))
+	for _, src := range h.sources {
+		sources = append(sources, src)
+	}
+	h.mu.Unlock()
+	for _, src := range sources {
+		src.scan(initial)
+	}
+}
+
+func (h *Hub) Sources() []SourceInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	infos := make([]SourceInfo, 0, len(h.sources))
+	for _, src := range h.sources {
+		info := SourceInfo{Source: src.cfg, Files: []string{}}
+		for path := range src.files {
+			info.Files = append(info.Files, path)
+		}
+		sort.Strings(info.Files)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Last returns up to n of the last lines of a source matching f, oldest first.
+func (h *Hub) Last(name string, n int, f Filter) ([]Line, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	src, ok := h.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+	lines := []Line{}
+	for i := len(src.lines) - 1; i >= 0 && len(lines) < n; i-- {
+		if f.Match(src.lines[i].Text) {
+			lines = append(lines, src.lines[i])
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines, nil
+}
+
+// Subscribe returns a subscription to the new lines of a source, buffering
+// up to buffer lines.
+func (h *Hub) Subscribe(name string, buffer int) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	src, ok := h.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+	c := make(chan Line, buffer)
+	sub := &Subscription{C: c, c: c, source: src}
+	src.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// publish records the lines read from a file, counts them and hands them
+// to the subscribers.
+func (s *source) publish(path string, texts []string) {
+	if len(texts) == 0 {
+		return
+	}
+	h := s.hub
+	now := time.Now().UnixMilli()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, text := range texts {
+		line := Line{ID: h.nextID, Source: s.cfg.Name, File: path, Time: now, Text: text}
+		h.nextID++
+		s.lines = append(s.lines, line)
+		for c := range s.counters {
+			if c.re.MatchString(text) {
+				c.count.Add(1)
+			}
+		}
+		for sub := range s.subscribers {
+			select {
+			case sub.c <- line:
+			default:
+			}
+		}
+	}
+	if len(s.lines) > h.limit {
+		s.lines = s.lines[len(s.lines)-h.limit:]
+	}
+}
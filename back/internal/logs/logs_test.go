@@ -0,0 +1,216 @@
+package logs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func texts(lines []Line) []string {
+	result := []string{}
+	for _, l := range lines {
+		result = append(result, l.Text)
+	}
+	return result
+}
+
+func last(t *testing.T, h *Hub, name string) []string {
+	lines, err := h.Last(name, 100, Filter{})
+	require.NoError(t, err)
+	return texts(lines)
+}
+
+func TestParseSources(t *testing.T) {
+	sources, err := ParseSources("nginx=/var/log/nginx/*.log, app=/srv/app.log")
+	require.NoError(t, err)
+	assert.Equal(t, []Source{{"nginx", "/var/log/nginx/*.log"}, {"app", "/srv/app.log"}}, sources)
+
+	for _, s := range []string{"nopattern", "=/var/log/x", "a=/x,a=/y"} {
+		_, err := ParseSources(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestTailAppendsAndPartialLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "one\ntwo\n")
+
+	h := NewHub([]Source{{Name: "app", Pattern: path}}, 100, time.Hour)
+	h.scan(true)
+	assert.Equal(t, []string{"one", "two"}, last(t, h, "app"))
+
+	appendFile(t, path, "three\nfou")
+	h.scan(false)
+	assert.Equal(t, []string{"one", "two", "three"}, last(t, h, "app"))
+	appendFile(t, path, "r\r\n")
+	h.scan(false)
+	assert.Equal(t, []string{"one", "two", "three", "four"}, last(t, h, "app"))
+
+	lines, err := h.Last("app", 2, Filter{Regex: regexp.MustCompile("^t")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two", "three"}, texts(lines))
+	_, err = h.Last("nope", 1, Filter{})
+	assert.ErrorIs(t, err, ErrUnknownSource)
+}
+
+func TestTailRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "before\n")
+	h := NewHub([]Source{{Name: "app", Pattern: path}}, 100, time.Hour)
+	h.scan(true)
+
+	// written to the old file just before the rotation, without a newline
+	appendFile(t, path, "last old")
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path, "first new\n")
+	h.scan(false)
+	assert.Equal(t, []string{"before", "last old", "first new"}, last(t, h, "app"))
+
+	// copytruncate
+	require.NoError(t, os.Truncate(path, 0))
+	appendFile(t, path, "after\n")
+	h.scan(false)
+	assert.Equal(t, []string{"before", "last old", "first new", "after"}, last(t, h, "app"))
+}
+
+func TestTailGlob(t *testing.T) {
+	dir := t.TempDir()
+	appendFile(t, filepath.Join(dir, "a.log"), "a1\n")
+	h := NewHub([]Source{{Name: "all", Pattern: filepath.Join(dir, "*.log")}}, 3, time.Hour)
+	h.scan(true)
+
+	sub, err := h.Subscribe("all", 10)
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// files appearing later are read from their beginning
+	appendFile(t, filepath.Join(dir, "b.log"), "b1\nb2\nb3\n")
+	h.scan(false)
+	assert.Equal(t, []string{"b1", "b2", "b3"}, last(t, h, "all"))
+	for _, want := range []string{"b1", "b2", "b3"} {
+		line := <-sub.C
+		assert.Equal(t, want, line.Text)
+		assert.Equal(t, filepath.Join(dir, "b.log"), line.File)
+	}
+
+	infos := h.Sources()
+	require.Len(t, infos, 1)
+	assert.Len(t, infos[0].Files, 2)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.log")))
+	h.scan(false)
+	assert.Len(t, h.Sources()[0].Files, 1)
+}
+
+func TestTailLargeFileStartsAtTheEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.log")
+	var data []byte
+	for i := 0; i < 20000; i++ {
+		data = append(data, "0123456789\n"...)
+	}
+	data = append(data, "the end\n"...)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	h := NewHub([]Source{{Name: "big", Pattern: path}}, 10, time.Hour)
+	h.scan(true)
+	lines := last(t, h, "big")
+	assert.Len(t, lines, 10)
+	assert.Equal(t, "the end", lines[9])
+}
+
+func TestTailReadsInChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.log")
+	var data []byte
+	for len(data) < 2*readChunk {
+		data = append(data, "0123456789\n"...)
+	}
+	data = append(data, "the end\n"...)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	f, lines, err := open(path, false)
+	require.NoError(t, err)
+	defer f.close()
+	assert.Equal(t, int64(readChunk), f.offset)
+	total := len(lines)
+	for {
+		lines, more := f.read()
+		assert.LessOrEqual(t, len(lines), readChunk/11+1)
+		total += len(lines)
+		if !more {
+			break
+		}
+	}
+	assert.Equal(t, int64(len(data)), f.offset)
+	assert.Equal(t, len(data)/11+1, total)
+
+	// a file appearing later is read to its end, a chunk at a time
+	h := NewHub([]Source{{Name: "big", Pattern: filepath.Join(filepath.Dir(path), "*.log")}}, 10, time.Hour)
+	h.scan(false)
+	assert.Equal(t, "the end", last(t, h, "big")[9])
+}
+
+func TestSubscriptionDropsWhenSlow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "")
+	h := NewHub([]Source{{Name: "app", Pattern: path}}, 100, time.Hour)
+	h.scan(true)
+	sub, err := h.Subscribe("app", 1)
+	require.NoError(t, err)
+	appendFile(t, path, "1\n2\n3\n")
+	h.scan(false)
+	assert.Equal(t, "1", (<-sub.C).Text)
+	assert.Empty(t, sub.C)
+
+	sub.Close()
+	appendFile(t, path, "4\n")
+	h.scan(false)
+	assert.Empty(t, sub.C)
+}
+
+func TestCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "ERROR before start\n")
+	h := NewHub([]Source{{Name: "app", Pattern: path}}, 100, time.Hour)
+	h.scan(true)
+
+	rule := MetricRule{Metric: "log.app.errors", Source: "app", Regex: `\bERROR\b`, IntervalMS: 1000}
+	require.NoError(t, rule.Validate())
+	counts := make(chan int, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, h.Count(ctx, rule, func(count int, at time.Time) { counts <- count }))
+
+	// more lines than any subscription buffer: none is missed
+	var burst strings.Builder
+	for i := 0; i < 10000; i++ {
+		burst.WriteString("ERROR burst\n")
+	}
+	appendFile(t, path, "INFO ok\nERROR one\nERRORS not a word\nERROR two\n"+burst.String())
+	h.scan(false)
+	assert.Equal(t, 10002, <-counts)
+	// nothing new: an explicit zero
+	assert.Equal(t, 0, <-counts)
+
+	assert.ErrorIs(t, h.Count(ctx, MetricRule{Source: "nope", Regex: "x"}, nil), ErrUnknownSource)
+	assert.Error(t, MetricRule{Metric: "log.m", Source: "app", Regex: "("}.Validate())
+	// the prefix keeps a rule from feeding the built-in metrics
+	assert.Error(t, MetricRule{Metric: "cpu", Source: "app", Regex: "x"}.Validate())
+	assert.Error(t, MetricRule{Metric: "log.", Source: "app", Regex: "x"}.Validate())
+}
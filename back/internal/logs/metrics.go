@@ -0,0 +1,88 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MetricPrefix starts the name of every log-based metric, so that a rule
+// cannot feed the series or alert rules of another metric.
+const MetricPrefix = "log."
+
+// MetricRule counts the lines of a source matching a regular expression
+// over an interval, turning them into the series Metric.
+type MetricRule struct {
+	Metric     string `json:"metric" binding:"required"`
+	Source     string `json:"source" binding:"required"`
+	Regex      string `json:"regex" binding:"required"`
+	IntervalMS int    `json:"interval_ms,omitempty"` // 60s by default
+}
+
+func (r MetricRule) Interval() time.Duration {
+	if r.IntervalMS <= 0 {
+		return time.Minute
+	}
+	return max(time.Duration(r.IntervalMS)*time.Millisecond, time.Second)
+}
+
+func (r MetricRule) Validate() error {
+	if r.Metric == "" || r.Source == "" || r.Regex == "" {
+		return fmt.Errorf("metric, source and regex are required")
+	}
+	if !strings.HasPrefix(r.Metric, MetricPrefix) || len(r.Metric) == len(MetricPrefix) {
+		return fmt.Errorf("metric must start with %q, e.g. %q", MetricPrefix, MetricPrefix+r.Source+".errors")
+	}
+	if _, err := regexp.Compile(r.Regex); err != nil {
+		return fmt.Errorf("invalid regex: %w", err)
+	}
+	return nil
+}
+
+// counter counts the lines of a source matching re. Unlike subscriptions,
+// counters are updated as the lines are published and never miss one.
+type counter struct {
+	re    *regexp.Regexp
+	count atomic.Int64
+}
+
+// Count counts the new lines of the rule's source matching its regex and
+// calls emit with the count at the end of every interval, zero included,
+// until ctx is done.
+func (h *Hub) Count(ctx context.Context, rule MetricRule, emit func(count int, at time.Time)) error {
+	re, err := regexp.Compile(rule.Regex)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	src, ok := h.sources[rule.Source]
+	if !ok {
+		h.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownSource, rule.Source)
+	}
+	c := &counter{re: re}
+	src.counters[c] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		defer func() {
+			h.mu.Lock()
+			delete(src.counters, c)
+			h.mu.Unlock()
+		}()
+		ticker := time.NewTicker(rule.Interval())
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				emit(int(c.count.Swap(0)), now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
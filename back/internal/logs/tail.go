@@ -0,0 +1,160 @@
+package logs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// maxLineSize cuts longer lines, a binary file having no newlines.
+	maxLineSize = 64 << 10
+	// initialTail is how much of the end of a file is read at start.
+	initialTail = 64 << 10
+	// readChunk bounds a read, a new or truncated file being read from its
+	// beginning whatever its size.
+	readChunk = 1 << 20
+)
+
+type tailedFile struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// open starts tailing path, from its last lines when fromEnd is set. The
+// lines returned are the first ones read; the rest of the file is left to
+// the next reads.
+func open(path string, fromEnd bool) (*tailedFile, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	f := &tailedFile{path: path, file: file, info: info}
+	if fromEnd && info.Size() > initialTail {
+		// skip to the first full line of the tail
+		f.offset = info.Size() - initialTail
+		lines, _ := f.read()
+		if len(lines) > 0 {
+			lines = lines[1:]
+		}
+		return f, lines, nil
+	}
+	lines, _ := f.read()
+	return f, lines, nil
+}
+
+// read returns the complete lines of at most readChunk bytes appended since
+// the last read, and whether there may be more to read.
+func (f *tailedFile) read() ([]string, bool) {
+	if _, err := f.file.Seek(f.offset, io.SeekStart); err != nil {
+		return nil, false
+	}
+	data, err := io.ReadAll(io.LimitReader(f.file, readChunk))
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+	f.offset += int64(len(data))
+	more := len(data) == readChunk
+	data = append(f.partial, data...)
+
+	var lines []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, string(bytes.TrimSuffix(data[:i], []byte("\r"))))
+		data = data[i+1:]
+	}
+	for len(data) > maxLineSize {
+		lines = append(lines, string(data[:maxLineSize]))
+		data = data[maxLineSize:]
+	}
+	f.partial = append([]byte(nil), data...)
+	return lines, more
+}
+
+func (f *tailedFile) close() {
+	_ = f.file.Close()
+}
+
+// drain publishes the lines appended to f a chunk at a time, and with
+// final, the last line of a file that is not written to anymore even
+// without its newline.
+func (s *source) drain(f *tailedFile, final bool) {
+	for {
+		lines, more := f.read()
+		s.publish(f.path, lines)
+		if !more {
+			break
+		}
+	}
+	if final && len(f.partial) > 0 {
+		s.publish(f.path, []string{string(f.partial)})
+		f.partial = nil
+	}
+}
+
+// scan reads the new lines of the files of the source. A path now pointing
+// to another file was rotated: the old file is read to its end and the new
+// one from its beginning. A file smaller than what was read was truncated
+// and is read again from its beginning.
+func (s *source) scan(initial bool) {
+	paths, _ := filepath.Glob(s.cfg.Pattern)
+	matched := map[string]bool{}
+	for _, path := range paths {
+		matched[path] = true
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		s.hub.mu.Lock()
+		f := s.files[path]
+		s.hub.mu.Unlock()
+
+		if f != nil && !os.SameFile(f.info, info) {
+			s.drain(f, true)
+			f.close()
+			f = nil
+		}
+		if f == nil {
+			var lines []string
+			if f, lines, err = open(path, initial); err != nil {
+				continue
+			}
+			s.hub.mu.Lock()
+			s.files[path] = f
+			s.hub.mu.Unlock()
+			s.publish(path, lines)
+		}
+		if info.Size() < f.offset {
+			f.offset, f.partial = 0, nil
+		}
+		f.info = info
+		s.drain(f, false)
+	}
+
+	s.hub.mu.Lock()
+	var gone []*tailedFile
+	for path, f := range s.files {
+		if !matched[path] {
+			gone = append(gone, f)
+			delete(s.files, path)
+		}
+	}
+	s.hub.mu.Unlock()
+	for _, f := range gone {
+		s.drain(f, true)
+		f.close()
+	}
+}
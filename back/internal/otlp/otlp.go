@@ -0,0 +1,240 @@
+// Package otlp exports the samples to an OpenTelemetry collector over
+// OTLP/HTTP, using the protobuf or the JSON encoding of the metrics data
+// model.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	models "back/internal/domain"
+	"back/internal/sink"
+)
+
+const scopeName = "monitoverse"
+
+// OTLP/HTTP encodings, as named by OTEL_EXPORTER_OTLP_PROTOCOL. gRPC is not
+// supported.
+const (
+	ProtocolProtobuf = "http/protobuf"
+	ProtocolJSON     = "http/json"
+)
+
+type Config struct {
+	Endpoint string            // full URL of the metrics endpoint, e.g. http://collector:4318/v1/metrics
+	Protocol string            // ProtocolProtobuf (default) or ProtocolJSON
+	Headers  map[string]string // sent with every request, e.g. an API key
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// ConfigFromEnv reads the standard OpenTelemetry exporter variables:
+// OTEL_EXPORTER_OTLP_METRICS_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_HEADERS, OTEL_EXPORTER_OTLP_METRICS_PROTOCOL or
+// OTEL_EXPORTER_OTLP_PROTOCOL and OTEL_METRIC_EXPORT_INTERVAL (ms). ok is
+// false when no endpoint is set. An unsupported protocol is reported and
+// replaced by http/protobuf, the default of the specification.
+func ConfigFromEnv() (cfg Config, ok bool) {
+	cfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	if cfg.Endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			cfg.Endpoint = strings.TrimSuffix(base, "/") + "/v1/metrics"
+		}
+	}
+	if cfg.Endpoint == "" {
+		return cfg, false
+	}
+	cfg.Protocol = os.Getenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL")
+	if cfg.Protocol == "" {
+		cfg.Protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch cfg.Protocol {
+	case ProtocolProtobuf, ProtocolJSON:
+	case "":
+		cfg.Protocol = ProtocolProtobuf
+	default:
+		log.Printf("OTLP protocol %q is not supported, using %s", cfg.Protocol, ProtocolProtobuf)
+		cfg.Protocol = ProtocolProtobuf
+	}
+
+	cfg.Headers = map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, found := strings.Cut(pair, "="); found {
+			cfg.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	cfg.Interval = 60 * time.Second
+	if ms, err := strconv.Atoi(os.Getenv("OTEL_METRIC_EXPORT_INTERVAL")); err == nil && ms > 0 {
+		cfg.Interval = time.Duration(ms) * time.Millisecond
+	}
+	cfg.Timeout = 10 * time.Second
+	return cfg, true
+}
+
+// Exporter is a sink.Sender posting ExportMetricsServiceRequests.
+type Exporter struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewExporter(cfg Config) *Exporter {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = ProtocolProtobuf
+	}
+	return &Exporter{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (e *Exporter) Name() string {
+	return "otlp"
+}
+
+func (e *Exporter) Send(ctx context.Context, batch []models.MonitoringData) error {
+	export := NewExportRequest(batch)
+	contentType := "application/x-protobuf"
+	var body []byte
+	var err error
+	if e.cfg.Protocol == ProtocolJSON {
+		contentType = "application/json"
+		body, err = json.Marshal(export)
+	} else {
+		body, err = export.MarshalProto()
+	}
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("OTLP export failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return sink.Permanent(err)
+	}
+	return err
+}
+
+// OTLP JSON data model, see opentelemetry/proto/metrics/v1/metrics.proto.
+
+type ExportRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+type AnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type ScopeMetrics struct {
+	Scope   Scope    `json:"scope"`
+	Metrics []Metric `json:"metrics"`
+}
+
+type Scope struct {
+	Name string `json:"name"`
+}
+
+type Metric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit"`
+	Gauge       Gauge  `json:"gauge"`
+}
+
+type Gauge struct {
+	DataPoints []NumberDataPoint `json:"dataPoints"`
+}
+
+type NumberDataPoint struct {
+	Attributes   []KeyValue `json:"attributes,omitempty"`
+	TimeUnixNano string     `json:"timeUnixNano"` // uint64 as a string in the JSON encoding
+	AsDouble     float64    `json:"asDouble"`
+}
+
+func attribute(key, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: value}}
+}
+
+// NewExportRequest groups the samples by host, each host being a resource
+// with its host.name attribute. The usages are reported as utilization
+// ratios, following the system.* semantic conventions.
+func NewExportRequest(batch []models.MonitoringData) ExportRequest {
+	byHost := map[string][]models.MonitoringData{}
+	for _, data := range batch {
+		byHost[data.Host] = append(byHost[data.Host], data)
+	}
+	hosts := make([]string, 0, len(byHost))
+	for host := range byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	req := ExportRequest{ResourceMetrics: []ResourceMetrics{}}
+	for _, host := range hosts {
+		cpu := Metric{Name: "system.cpu.utilization", Description: "CPU usage of the host", Unit: "1"}
+		memory := Metric{Name: "system.memory.utilization", Description: "Memory usage of the host", Unit: "1"}
+		disk := Metric{Name: "system.filesystem.utilization", Description: "Usage of the filesystems", Unit: "1"}
+		for _, data := range byHost[host] {
+			ms := data.TimestampMS
+			if ms == 0 {
+				ms = data.Timestamp * 1000
+			}
+			ts := strconv.FormatInt(ms*int64(time.Millisecond), 10)
+			cpu.Gauge.DataPoints = append(cpu.Gauge.DataPoints, NumberDataPoint{TimeUnixNano: ts, AsDouble: data.CPU / 100})
+			memory.Gauge.DataPoints = append(memory.Gauge.DataPoints, NumberDataPoint{TimeUnixNano: ts, AsDouble: data.Memory / 100})
+			disk.Gauge.DataPoints = append(disk.Gauge.DataPoints,
+				NumberDataPoint{Attributes: []KeyValue{attribute("system.filesystem.mountpoint", "/")}, TimeUnixNano: ts, AsDouble: data.DiskRoot / 100},
+				NumberDataPoint{Attributes: []KeyValue{attribute("system.filesystem.mountpoint", "/home")}, TimeUnixNano: ts, AsDouble: data.DiskHome / 100},
+			)
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, ResourceMetrics{
+			Resource: Resource{Attributes: []KeyValue{
+				attribute("host.name", host),
+				attribute("service.name", "monitoverse"),
+			}},
+			ScopeMetrics: []ScopeMetrics{{
+				Scope:   Scope{Name: scopeName},
+				Metrics: []Metric{cpu, memory, disk},
+			}},
+		})
+	}
+	return req
+}
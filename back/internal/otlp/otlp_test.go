@@ -0,0 +1,209 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+	"back/internal/sink"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// receiver stands in for an OpenTelemetry collector
+type receiver struct {
+	mu       sync.Mutex
+	requests []ExportRequest
+	types    []string
+	headers  []http.Header
+	status   int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	contentType := req.Header.Get("Content-Type")
+	if req.URL.Path != "/v1/metrics" || (contentType != "application/json" && contentType != "application/x-protobuf") {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+		return
+	}
+	var body ExportRequest
+	var err error
+	if contentType == "application/json" {
+		err = json.NewDecoder(req.Body).Decode(&body)
+	} else {
+		body, err = decodeProto(req.Body)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.requests = append(r.requests, body)
+	r.types = append(r.types, contentType)
+	r.headers = append(r.headers, req.Header)
+	w.Header().Set("Content-Type", contentType)
+}
+
+// decodeProto reads a protobuf export request back into the JSON model.
+func decodeProto(body io.Reader) (ExportRequest, error) {
+	var req ExportRequest
+	buf, err := io.ReadAll(body)
+	if err != nil {
+		return req, err
+	}
+	var data metricspb.MetricsData
+	if err := proto.Unmarshal(buf, &data); err != nil {
+		return req, err
+	}
+	attributes := func(kvs []*commonpb.KeyValue) []KeyValue {
+		var result []KeyValue
+		for _, kv := range kvs {
+			result = append(result, attribute(kv.GetKey(), kv.GetValue().GetStringValue()))
+		}
+		return result
+	}
+	for _, rm := range data.GetResourceMetrics() {
+		resource := ResourceMetrics{Resource: Resource{Attributes: attributes(rm.GetResource().GetAttributes())}}
+		for _, sm := range rm.GetScopeMetrics() {
+			scope := ScopeMetrics{Scope: Scope{Name: sm.GetScope().GetName()}}
+			for _, m := range sm.GetMetrics() {
+				metric := Metric{Name: m.GetName(), Description: m.GetDescription(), Unit: m.GetUnit()}
+				for _, dp := range m.GetGauge().GetDataPoints() {
+					metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, NumberDataPoint{
+						Attributes:   attributes(dp.GetAttributes()),
+						TimeUnixNano: strconv.FormatUint(dp.GetTimeUnixNano(), 10),
+						AsDouble:     dp.GetAsDouble(),
+					})
+				}
+				scope.Metrics = append(scope.Metrics, metric)
+			}
+			resource.ScopeMetrics = append(resource.ScopeMetrics, scope)
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, resource)
+	}
+	return req, nil
+}
+
+func resourceHost(rm ResourceMetrics) string {
+	for _, attr := range rm.Resource.Attributes {
+		if attr.Key == "host.name" {
+			return attr.Value.StringValue
+		}
+	}
+	return ""
+}
+
+func TestExporterSendsGaugesPerHost(t *testing.T) {
+	recv := &receiver{}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	exporter := NewExporter(Config{Endpoint: ts.URL + "/v1/metrics", Headers: map[string]string{"X-Api-Key": "secret"}})
+	err := exporter.Send(context.Background(), []models.MonitoringData{
+		{Host: "web-2", Timestamp: 100, CPU: 50, Memory: 25, DiskRoot: 10, DiskHome: 20},
+		{Host: "web-1", Timestamp: 100, CPU: 12.5},
+		{Host: "web-1", Timestamp: 101, TimestampMS: 101250, CPU: 80},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, recv.requests, 1)
+	assert.Equal(t, "application/x-protobuf", recv.types[0])
+	assert.Equal(t, "secret", recv.headers[0].Get("X-Api-Key"))
+	resources := recv.requests[0].ResourceMetrics
+	require.Len(t, resources, 2)
+	assert.Equal(t, "web-1", resourceHost(resources[0]))
+	assert.Equal(t, "web-2", resourceHost(resources[1]))
+
+	metrics := resources[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 3)
+	cpu := metrics[0]
+	assert.Equal(t, "system.cpu.utilization", cpu.Name)
+	require.Len(t, cpu.Gauge.DataPoints, 2)
+	assert.Equal(t, 0.125, cpu.Gauge.DataPoints[0].AsDouble)
+	assert.Equal(t, "101250000000", cpu.Gauge.DataPoints[1].TimeUnixNano)
+
+	disk := resources[1].ScopeMetrics[0].Metrics[2]
+	require.Len(t, disk.Gauge.DataPoints, 2)
+	assert.Equal(t, "/home", disk.Gauge.DataPoints[1].Attributes[0].Value.StringValue)
+	assert.Equal(t, 0.2, disk.Gauge.DataPoints[1].AsDouble)
+}
+
+func TestExporterJSONMatchesProtobuf(t *testing.T) {
+	recv := &receiver{}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	batch := []models.MonitoringData{
+		{Host: "web-1", Timestamp: 100, CPU: 12.5, DiskRoot: 40},
+		{Host: "web-2", Timestamp: 101, Memory: 60},
+	}
+	require.NoError(t, NewExporter(Config{Endpoint: ts.URL + "/v1/metrics", Protocol: ProtocolJSON}).Send(context.Background(), batch))
+	require.NoError(t, NewExporter(Config{Endpoint: ts.URL + "/v1/metrics", Protocol: ProtocolProtobuf}).Send(context.Background(), batch))
+
+	require.Len(t, recv.requests, 2)
+	assert.Equal(t, []string{"application/json", "application/x-protobuf"}, recv.types)
+	assert.Equal(t, recv.requests[0], recv.requests[1])
+}
+
+func TestExporterRetriesThroughBatcher(t *testing.T) {
+	recv := &receiver{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+
+	batcher := sink.NewBatcher(NewExporter(Config{Endpoint: ts.URL + "/v1/metrics"}), sink.Config{})
+	batcher.Record(models.MonitoringData{Host: "web-1", Timestamp: 1})
+	assert.ErrorContains(t, batcher.Flush(context.Background()), "503")
+	assert.Equal(t, 1, batcher.Stats().Pending)
+
+	recv.status = 0
+	require.NoError(t, batcher.Flush(context.Background()))
+	assert.Len(t, recv.requests, 1)
+	assert.Zero(t, batcher.Stats().Pending)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	_, ok := ConfigFromEnv()
+	assert.False(t, ok)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret, tenant=ops")
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "5000")
+	cfg, ok := ConfigFromEnv()
+	assert.True(t, ok)
+	assert.Equal(t, ProtocolProtobuf, cfg.Protocol)
+	assert.Equal(t, "http://collector:4318/v1/metrics", cfg.Endpoint)
+	assert.Equal(t, map[string]string{"api-key": "secret", "tenant": "ops"}, cfg.Headers)
+	assert.Equal(t, 5*time.Second, cfg.Interval)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	cfg, _ = ConfigFromEnv()
+	assert.Equal(t, ProtocolJSON, cfg.Protocol)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "http/protobuf")
+	cfg, _ = ConfigFromEnv()
+	assert.Equal(t, ProtocolProtobuf, cfg.Protocol)
+
+	// gRPC is not supported: the exporter falls back to http/protobuf
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	cfg, ok = ConfigFromEnv()
+	assert.True(t, ok)
+	assert.Equal(t, ProtocolProtobuf, cfg.Protocol)
+}
@@ -0,0 +1,59 @@
+package otlp
+
+import (
+	"strconv"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// MarshalProto encodes the request in the protobuf encoding of OTLP/HTTP.
+// It is written as a MetricsData, whose wire format is the one of
+// ExportMetricsServiceRequest; the package of the latter pulls in gRPC.
+func (r ExportRequest) MarshalProto() ([]byte, error) {
+	data := &metricspb.MetricsData{}
+	for _, rm := range r.ResourceMetrics {
+		resource := &metricspb.ResourceMetrics{
+			Resource: &resourcepb.Resource{Attributes: protoAttributes(rm.Resource.Attributes)},
+		}
+		for _, sm := range rm.ScopeMetrics {
+			scope := &metricspb.ScopeMetrics{Scope: &commonpb.InstrumentationScope{Name: sm.Scope.Name}}
+			for _, m := range sm.Metrics {
+				gauge := &metricspb.Gauge{}
+				for _, dp := range m.Gauge.DataPoints {
+					ts, err := strconv.ParseUint(dp.TimeUnixNano, 10, 64)
+					if err != nil {
+						return nil, err
+					}
+					gauge.DataPoints = append(gauge.DataPoints, &metricspb.NumberDataPoint{
+						Attributes:   protoAttributes(dp.Attributes),
+						TimeUnixNano: ts,
+						Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: dp.AsDouble},
+					})
+				}
+				scope.Metrics = append(scope.Metrics, &metricspb.Metric{
+					Name:        m.Name,
+					Description: m.Description,
+					Unit:        m.Unit,
+					Data:        &metricspb.Metric_Gauge{Gauge: gauge},
+				})
+			}
+			resource.ScopeMetrics = append(resource.ScopeMetrics, scope)
+		}
+		data.ResourceMetrics = append(data.ResourceMetrics, resource)
+	}
+	return proto.Marshal(data)
+}
+
+func protoAttributes(attributes []KeyValue) []*commonpb.KeyValue {
+	var result []*commonpb.KeyValue
+	for _, attr := range attributes {
+		result = append(result, &commonpb.KeyValue{
+			Key:   attr.Key,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: attr.Value.StringValue}},
+		})
+	}
+	return result
+}
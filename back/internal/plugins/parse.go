@@ -0,0 +1,233 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"back/internal/series"
+)
+
+// Output formats of a plugin.
+const (
+	FormatNagios     = "nagios"
+	FormatPrometheus = "prometheus"
+	FormatJSON       = "json"
+)
+
+// Nagios plugin exit codes, recorded as <name>.status.
+const (
+	StatusOK       = 0
+	StatusWarning  = 1
+	StatusCritical = 2
+	StatusUnknown  = 3
+)
+
+// parseNagios reads the performance data of a Nagios plugin output: every
+// "'label'=value[unit];warn;crit;min;max" after a "|", on the first line
+// and the following ones. Each becomes <name>.<label>.
+func parseNagios(name string, output []byte) ([]series.Sample, error) {
+	var samples []series.Sample
+	for _, line := range strings.Split(string(output), "\n") {
+		_, perf, ok := strings.Cut(line, "|")
+		if !ok {
+			continue
+		}
+		for _, item := range splitPerfData(perf) {
+			label, rest, ok := strings.Cut(item, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid performance data %q", item)
+			}
+			raw, _, _ := strings.Cut(rest, ";")
+			if raw == "U" {
+				continue // value undetermined
+			}
+			raw = strings.TrimRightFunc(raw, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid performance data %q", item)
+			}
+			samples = append(samples, series.Sample{Metric: name + "." + metricName(strings.Trim(label, "'")), Value: value})
+		}
+	}
+	return samples, nil
+}
+
+// splitPerfData splits on spaces outside of quoted labels.
+func splitPerfData(perf string) []string {
+	var items []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range perf {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				items = append(items, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		items = append(items, current.String())
+	}
+	return items
+}
+
+// parsePrometheus reads the Prometheus text exposition format, keeping the
+// metric names and labels as they are.
+func parsePrometheus(output []byte) ([]series.Sample, error) {
+	var samples []series.Sample
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parsePrometheusLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func parsePrometheusLine(line string) (series.Sample, error) {
+	var sample series.Sample
+	rest := line
+	if i := strings.IndexAny(line, "{ \t"); i >= 0 {
+		sample.Metric, rest = line[:i], line[i:]
+	}
+	if strings.HasPrefix(rest, "{") {
+		end := strings.LastIndex(rest, "}")
+		if end < 0 {
+			return sample, fmt.Errorf("invalid prometheus line %q", line)
+		}
+		labels, err := parsePrometheusLabels(rest[1:end])
+		if err != nil {
+			return sample, fmt.Errorf("invalid prometheus line %q: %w", line, err)
+		}
+		sample.Labels, rest = labels, rest[end+1:]
+	}
+	fields := strings.Fields(rest)
+	if sample.Metric == "" || len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("invalid prometheus line %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid prometheus line %q: bad value", line)
+	}
+	sample.Value = value
+	if len(fields) == 2 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return sample, fmt.Errorf("invalid prometheus line %q: bad timestamp", line)
+		}
+		sample.Timestamp = ms / 1000
+	}
+	return sample, nil
+}
+
+func parsePrometheusLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return labels, nil
+		}
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return nil, fmt.Errorf("bad label %q", s)
+		}
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			value.WriteByte(rest[i])
+		}
+		if i == len(rest) {
+			return nil, fmt.Errorf("unterminated label %q", name)
+		}
+		labels[strings.TrimSpace(name)] = value.String()
+		s = rest[i+1:]
+	}
+}
+
+// jsonSample is the explicit form of the JSON output.
+type jsonSample struct {
+	Metric string            `json:"metric"`
+	Value  *float64          `json:"value"`
+	Labels map[string]string `json:"labels"`
+}
+
+// parseJSON reads either a list of {"metric", "value", "labels"} objects,
+// or an object whose numeric and boolean leaves become <name>.<path>.
+func parseJSON(name string, output []byte) ([]series.Sample, error) {
+	var list []jsonSample
+	if err := json.Unmarshal(output, &list); err == nil {
+		samples := make([]series.Sample, 0, len(list))
+		for _, s := range list {
+			if s.Metric == "" || s.Value == nil {
+				return nil, fmt.Errorf("JSON samples need a metric and a value")
+			}
+			samples = append(samples, series.Sample{Metric: s.Metric, Labels: s.Labels, Value: *s.Value})
+		}
+		return samples, nil
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal(output, &object); err != nil {
+		return nil, fmt.Errorf("invalid JSON output: %w", err)
+	}
+	var samples []series.Sample
+	flattenJSON(name, object, &samples)
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Metric < samples[j].Metric })
+	return samples, nil
+}
+
+func flattenJSON(prefix string, value any, samples *[]series.Sample) {
+	switch v := value.(type) {
+	case float64:
+		*samples = append(*samples, series.Sample{Metric: prefix, Value: v})
+	case bool:
+		n := 0.0
+		if v {
+			n = 1
+		}
+		*samples = append(*samples, series.Sample{Metric: prefix, Value: n})
+	case map[string]any:
+		for key, child := range v {
+			flattenJSON(prefix+"."+metricName(key), child, samples)
+		}
+	}
+}
+
+// metricName replaces the characters that have no place in a metric name.
+func metricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,69 @@
+package plugins
+
+import (
+	"testing"
+
+	"back/internal/series"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNagios(t *testing.T) {
+	output := "QUEUE WARNING - 42 jobs | depth=42;30;50;0 'oldest job'=95.5s;;\nlong text | lag=U workers=3\n"
+	samples, err := parseNagios("queue", []byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, []series.Sample{
+		{Metric: "queue.depth", Value: 42},
+		{Metric: "queue.oldest_job", Value: 95.5},
+		{Metric: "queue.workers", Value: 3},
+	}, samples)
+
+	samples, err = parseNagios("queue", []byte("OK - no perfdata\n"))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+
+	_, err = parseNagios("queue", []byte("OK | depth"))
+	assert.Error(t, err)
+}
+
+func TestParsePrometheus(t *testing.T) {
+	output := `# HELP jobs_total Jobs processed.
+# TYPE jobs_total counter
+jobs_total{queue="mail",state="done"} 1027 1700000000000
+jobs_total{queue="a \"b\""} 3
+temperature 21.5
+broken_metric NaN
+`
+	samples, err := parsePrometheus([]byte(output))
+	require.NoError(t, err)
+	assert.Equal(t, []series.Sample{
+		{Metric: "jobs_total", Labels: map[string]string{"queue": "mail", "state": "done"}, Timestamp: 1700000000, Value: 1027},
+		{Metric: "jobs_total", Labels: map[string]string{"queue": `a "b"`}, Value: 3},
+		{Metric: "temperature", Value: 21.5},
+	}, samples)
+
+	for _, line := range []string{"novalue", `m{a="1" 2`, `m{a=1} 2`, "m abc", "m 1 2 3"} {
+		_, err := parsePrometheus([]byte(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	samples, err := parseJSON("backup", []byte(`{"size": {"bytes": 1024}, "ok": true, "name": "nightly", "files count": 3}`))
+	require.NoError(t, err)
+	assert.Equal(t, []series.Sample{
+		{Metric: "backup.files_count", Value: 3},
+		{Metric: "backup.ok", Value: 1},
+		{Metric: "backup.size.bytes", Value: 1024},
+	}, samples)
+
+	samples, err = parseJSON("backup", []byte(`[{"metric": "queue_depth", "value": 7, "labels": {"queue": "mail"}}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []series.Sample{{Metric: "queue_depth", Labels: map[string]string{"queue": "mail"}, Value: 7}}, samples)
+
+	_, err = parseJSON("backup", []byte(`[{"metric": "queue_depth"}]`))
+	assert.Error(t, err)
+	_, err = parseJSON("backup", []byte(`not json`))
+	assert.Error(t, err)
+}
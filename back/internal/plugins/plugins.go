@@ -0,0 +1,174 @@
+// Package plugins runs custom collectors: executables run on an interval
+// whose output, in the Nagios plugin, Prometheus text or JSON format, is
+// recorded as application series.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"back/internal/series"
+)
+
+type Config struct {
+	Name       string            `json:"name"`
+	Command    []string          `json:"command"` // executable and arguments, run without a shell
+	Format     string            `json:"format"`  // nagios, prometheus or json
+	IntervalMS int               `json:"interval_ms,omitempty"`
+	TimeoutMS  int               `json:"timeout_ms,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"` // added to every sample
+}
+
+func (c Config) interval() time.Duration {
+	if c.IntervalMS <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.IntervalMS) * time.Millisecond
+}
+
+func (c Config) timeout() time.Duration {
+	if c.TimeoutMS <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.TimeoutMS) * time.Millisecond
+}
+
+func (c Config) Validate() error {
+	if c.Name == "" || len(c.Command) == 0 {
+		return fmt.Errorf("plugin name and command are required")
+	}
+	switch c.Format {
+	case FormatNagios, FormatPrometheus, FormatJSON:
+	default:
+		return fmt.Errorf("plugin %s: unknown format %q", c.Name, c.Format)
+	}
+	if c.TimeoutMS > 0 && c.IntervalMS > 0 && c.TimeoutMS > c.IntervalMS {
+		return fmt.Errorf("plugin %s: timeout longer than the interval", c.Name)
+	}
+	return nil
+}
+
+// LoadConfig reads a JSON list of plugins.
+func LoadConfig(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid plugins file %s: %w", path, err)
+	}
+	names := map[string]bool{}
+	for _, cfg := range configs {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("duplicate plugin %s", cfg.Name)
+		}
+		names[cfg.Name] = true
+	}
+	return configs, nil
+}
+
+// Run executes the plugin once and parses its output. The samples are
+// tagged with host and the plugin labels, and timestamped with now unless
+// the output carries a timestamp.
+//
+// A Nagios plugin always yields <name>.status, its exit code, which is
+// UNKNOWN when it cannot be run or times out. For the other formats a
+// failed run is an error.
+func Run(ctx context.Context, cfg Config, host string, now time.Time) ([]series.Sample, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		runErr = fmt.Errorf("timed out after %s", cfg.timeout())
+	}
+
+	var samples []series.Sample
+	var err error
+	switch cfg.Format {
+	case FormatNagios:
+		status := StatusUnknown
+		var exitErr *exec.ExitError
+		switch {
+		case runErr == nil:
+			status = StatusOK
+		case errors.As(runErr, &exitErr) && exitErr.ExitCode() >= StatusOK && exitErr.ExitCode() <= StatusUnknown:
+			status = exitErr.ExitCode()
+			runErr = nil
+		}
+		samples, err = parseNagios(cfg.Name, stdout.Bytes())
+		samples = append(samples, series.Sample{Metric: cfg.Name + ".status", Value: float64(status)})
+	case FormatPrometheus:
+		samples, err = parsePrometheus(stdout.Bytes())
+	case FormatJSON:
+		samples, err = parseJSON(cfg.Name, stdout.Bytes())
+	}
+	if runErr != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			runErr = fmt.Errorf("%w: %s", runErr, msg)
+		}
+		if cfg.Format != FormatNagios {
+			return nil, runErr
+		}
+		err = errors.Join(runErr, err)
+	}
+
+	for i := range samples {
+		s := &samples[i]
+		s.Host = host
+		if s.Timestamp == 0 {
+			s.Timestamp = now.Unix()
+		}
+		if len(cfg.Labels) > 0 {
+			labels := make(map[string]string, len(cfg.Labels)+len(s.Labels))
+			for k, v := range cfg.Labels {
+				labels[k] = v
+			}
+			for k, v := range s.Labels {
+				labels[k] = v
+			}
+			s.Labels = labels
+		}
+	}
+	return samples, err
+}
+
+// Start runs every plugin on its interval until ctx is done, handing the
+// samples of each run to handler.
+func Start(ctx context.Context, configs []Config, host string, handler func([]series.Sample)) {
+	for _, cfg := range configs {
+		go func() {
+			ticker := time.NewTicker(cfg.interval())
+			defer ticker.Stop()
+			for {
+				samples, err := Run(ctx, cfg, host, time.Now())
+				if err != nil {
+					log.Printf("plugin %s: %v", cfg.Name, err)
+				}
+				if len(samples) > 0 {
+					handler(samples)
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
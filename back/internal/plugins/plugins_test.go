@@ -0,0 +1,74 @@
+package plugins
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"back/internal/series"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeScript(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755))
+	return path
+}
+
+func TestRunNagios(t *testing.T) {
+	script := writeScript(t, "echo 'QUEUE CRITICAL | depth=80'\nexit 2\n")
+	now := time.Unix(1700000000, 0)
+	samples, err := Run(context.Background(), Config{Name: "queue", Command: []string{script}, Format: FormatNagios, Labels: map[string]string{"team": "ops"}}, "web-1", now)
+	require.NoError(t, err)
+	labels := map[string]string{"team": "ops"}
+	assert.Equal(t, []series.Sample{
+		{Metric: "queue.depth", Host: "web-1", Labels: labels, Timestamp: now.Unix(), Value: 80},
+		{Metric: "queue.status", Host: "web-1", Labels: labels, Timestamp: now.Unix(), Value: StatusCritical},
+	}, samples)
+}
+
+func TestRunTimeout(t *testing.T) {
+	script := writeScript(t, "sleep 5\n")
+	cfg := Config{Name: "slow", Command: []string{script}, Format: FormatNagios, TimeoutMS: 100}
+	start := time.Now()
+	samples, err := Run(context.Background(), cfg, "web-1", start)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	require.Len(t, samples, 1)
+	assert.Equal(t, float64(StatusUnknown), samples[0].Value)
+
+	cfg.Format = FormatJSON
+	samples, err = Run(context.Background(), cfg, "web-1", start)
+	assert.ErrorContains(t, err, "timed out")
+	assert.Empty(t, samples)
+}
+
+func TestRunFailure(t *testing.T) {
+	script := writeScript(t, "echo 'cannot connect' >&2\nexit 1\n")
+	_, err := Run(context.Background(), Config{Name: "q", Command: []string{script}, Format: FormatPrometheus}, "web-1", time.Now())
+	assert.ErrorContains(t, err, "cannot connect")
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugins.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"name": "queue", "command": ["/usr/local/bin/check_queue", "-w", "30"], "format": "nagios", "interval_ms": 30000},
+		{"name": "backup", "command": ["/usr/local/bin/backup_stats"], "format": "json"}
+	]`), 0o644))
+	configs, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, 30*time.Second, configs[0].interval())
+	assert.Equal(t, time.Minute, configs[1].interval())
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": "x", "command": ["true"], "format": "xml"}]`), 0o644))
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": "x", "command": ["true"], "format": "json"}, {"name": "x", "command": ["true"], "format": "json"}]`), 0o644))
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
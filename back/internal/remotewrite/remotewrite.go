@@ -0,0 +1,226 @@
+// Package remotewrite decodes Prometheus remote_write 1.0 requests: a
+// snappy-compressed prometheus.WriteRequest protobuf message.
+package remotewrite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"back/internal/series"
+
+	"github.com/golang/snappy"
+)
+
+// MaxDecodedSize bounds the uncompressed size of a request.
+const MaxDecodedSize = 32 << 20
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value     float64
+	Timestamp int64 // milliseconds
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Decode uncompresses and parses a request body. Exemplars, histograms
+// and metadata are skipped.
+func Decode(body []byte) ([]TimeSeries, error) {
+	n, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy payload: %w", err)
+	}
+	if n > MaxDecodedSize {
+		return nil, fmt.Errorf("request too large: %d bytes", n)
+	}
+	buf, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy payload: %w", err)
+	}
+
+	var result []TimeSeries
+	err = eachField(buf, func(num int, typ int, data []byte, _ uint64) error {
+		if num != 1 || typ != wireBytes {
+			return nil
+		}
+		ts, err := decodeTimeSeries(data)
+		if err != nil {
+			return err
+		}
+		result = append(result, ts)
+		return nil
+	})
+	return result, err
+}
+
+func decodeTimeSeries(buf []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := eachField(buf, func(num int, typ int, data []byte, _ uint64) error {
+		if typ != wireBytes {
+			return nil
+		}
+		switch num {
+		case 1:
+			var l Label
+			err := eachField(data, func(num int, typ int, data []byte, _ uint64) error {
+				switch {
+				case num == 1 && typ == wireBytes:
+					l.Name = string(data)
+				case num == 2 && typ == wireBytes:
+					l.Value = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			var s Sample
+			err := eachField(data, func(num int, typ int, _ []byte, v uint64) error {
+				switch {
+				case num == 1 && typ == wireFixed64:
+					s.Value = math.Float64frombits(v)
+				case num == 2 && typ == wireVarint:
+					s.Timestamp = int64(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// eachField calls fn with every field of a message: data for length
+// delimited fields, v for the others.
+func eachField(buf []byte, fn func(num int, typ int, data []byte, v uint64) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errTruncated
+		}
+		buf = buf[n:]
+		num, typ := int(key>>3), int(key&7)
+
+		var data []byte
+		var v uint64
+		switch typ {
+		case wireVarint:
+			v, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errTruncated
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errTruncated
+			}
+			v, buf = binary.LittleEndian.Uint64(buf), buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errTruncated
+			}
+			v, buf = uint64(binary.LittleEndian.Uint32(buf)), buf[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < size {
+				return errTruncated
+			}
+			data, buf = buf[n:n+int(size)], buf[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", typ)
+		}
+		if err := fn(num, typ, data, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToSamples converts time series to samples of host. The metric is the
+// __name__ label and the other labels, instance included, are kept: the
+// host is the one the request was authenticated for, whatever the series
+// claim. NaN values, used by Prometheus as staleness markers, and
+// infinities are skipped.
+func ToSamples(timeSeries []TimeSeries, host string) []series.Sample {
+	var samples []series.Sample
+	for _, ts := range timeSeries {
+		var metric string
+		labels := map[string]string{}
+		for _, l := range ts.Labels {
+			if l.Name == "__name__" {
+				metric = l.Value
+			} else {
+				labels[l.Name] = l.Value
+			}
+		}
+		if metric == "" {
+			continue
+		}
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			samples = append(samples, series.Sample{
+				Metric:    metric,
+				Host:      host,
+				Labels:    labels,
+				Timestamp: s.Timestamp / 1000,
+				Value:     s.Value,
+			})
+		}
+	}
+	return samples
+}
+
+// Encode builds a request body for timeSeries, the reverse of Decode.
+func Encode(timeSeries []TimeSeries) []byte {
+	var req []byte
+	for _, ts := range timeSeries {
+		var msg []byte
+		for _, l := range ts.Labels {
+			var label []byte
+			label = appendBytes(label, 1, []byte(l.Name))
+			label = appendBytes(label, 2, []byte(l.Value))
+			msg = appendBytes(msg, 1, label)
+		}
+		for _, s := range ts.Samples {
+			sample := binary.AppendUvarint(nil, 1<<3|wireFixed64)
+			sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(s.Value))
+			sample = binary.AppendUvarint(sample, 2<<3|wireVarint)
+			sample = binary.AppendUvarint(sample, uint64(s.Timestamp))
+			msg = appendBytes(msg, 2, sample)
+		}
+		req = appendBytes(req, 1, msg)
+	}
+	return snappy.Encode(nil, req)
+}
+
+func appendBytes(buf []byte, num int, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(num)<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
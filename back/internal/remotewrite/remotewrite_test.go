@@ -0,0 +1,72 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"back/internal/series"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSeries = []TimeSeries{
+	{
+		Labels: []Label{{"__name__", "http_requests_total"}, {"instance", "web-1:9100"}, {"job", "node"}},
+		Samples: []Sample{
+			{Value: 10, Timestamp: 1700000000000},
+			{Value: math.NaN(), Timestamp: 1700000015000},
+			{Value: 12, Timestamp: 1700000030500},
+		},
+	},
+	{
+		Labels:  []Label{{"__name__", "up"}},
+		Samples: []Sample{{Value: 1, Timestamp: 1700000000000}},
+	},
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	decoded, err := Decode(Encode(testSeries))
+	require.NoError(t, err)
+	require.Len(t, decoded, 2)
+	assert.Equal(t, testSeries[0].Labels, decoded[0].Labels)
+	assert.Equal(t, testSeries[0].Samples[2], decoded[0].Samples[2])
+	assert.True(t, math.IsNaN(decoded[0].Samples[1].Value))
+	assert.Equal(t, testSeries[1], decoded[1])
+}
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	// metadata (field 3) and a varint field inside the series
+	var ts []byte
+	ts = appendBytes(ts, 1, appendBytes(appendBytes(nil, 1, []byte("__name__")), 2, []byte("up")))
+	ts = binary.AppendUvarint(ts, 9<<3|wireVarint)
+	ts = binary.AppendUvarint(ts, 42)
+	var req []byte
+	req = appendBytes(req, 1, ts)
+	req = appendBytes(req, 3, []byte("metadata"))
+
+	decoded, err := Decode(snappy.Encode(nil, req))
+	require.NoError(t, err)
+	require.Len(t, decoded, 1)
+	assert.Equal(t, []Label{{"__name__", "up"}}, decoded[0].Labels)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode([]byte("not snappy"))
+	assert.Error(t, err)
+
+	truncated := appendBytes(nil, 1, []byte("abc"))
+	_, err = Decode(snappy.Encode(nil, truncated[:len(truncated)-1]))
+	assert.Error(t, err)
+}
+
+func TestToSamples(t *testing.T) {
+	samples := ToSamples(testSeries, "prom")
+	assert.Equal(t, []series.Sample{
+		{Metric: "http_requests_total", Host: "prom", Labels: map[string]string{"instance": "web-1:9100", "job": "node"}, Timestamp: 1700000000, Value: 10},
+		{Metric: "http_requests_total", Host: "prom", Labels: map[string]string{"instance": "web-1:9100", "job": "node"}, Timestamp: 1700000030, Value: 12},
+		{Metric: "up", Host: "prom", Labels: map[string]string{}, Timestamp: 1700000000, Value: 1},
+	}, samples)
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	models "back/internal/domain"
+
+	"gorm.io/gorm"
+)
+
+type AlertRuleRepository interface {
+	Create(rule *models.AlertRule) error
+	Delete(name string) error
+	FindAll() ([]models.AlertRule, error)
+}
+
+type alertRuleRepository struct {
+	db *gorm.DB
+}
+
+func NewAlertRuleRepository(db *gorm.DB) AlertRuleRepository {
+	return &alertRuleRepository{db: db}
+}
+
+func (r *alertRuleRepository) Create(rule *models.AlertRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *alertRuleRepository) Delete(name string) error {
+	return r.db.Where("name = ?", name).Delete(&models.AlertRule{}).Error
+}
+
+func (r *alertRuleRepository) FindAll() ([]models.AlertRule, error) {
+	var rules []models.AlertRule
+	if err := r.db.Order("created_at").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	models "back/internal/domain"
+
+	"gorm.io/gorm"
+)
+
+type CheckRepository interface {
+	Create(check *models.Check) error
+	// Delete removes a check and its results.
+	Delete(name string) error
+	FindAll() ([]models.Check, error)
+
+	CreateResult(result *models.CheckResult) error
+	// LastResults returns the last limit results of a check, newest first.
+	LastResults(check string, limit int) ([]models.CheckResult, error)
+	// PruneResults keeps the last keep results of a check.
+	PruneResults(check string, keep int) error
+}
+
+type checkRepository struct {
+	db *gorm.DB
+}
+
+func NewCheckRepository(db *gorm.DB) CheckRepository {
+	return &checkRepository{db: db}
+}
+
+func (r *checkRepository) Create(check *models.Check) error {
+	return r.db.Create(check).Error
+}
+
+func (r *checkRepository) Delete(name string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("check_name = ?", name).Delete(&models.CheckResult{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("name = ?", name).Delete(&models.Check{}).Error
+	})
+}
+
+func (r *checkRepository) FindAll() ([]models.Check, error) {
+	var checks []models.Check
+	if err := r.db.Order("name").Find(&checks).Error; err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+func (r *checkRepository) CreateResult(result *models.CheckResult) error {
+	return r.db.Create(result).Error
+}
+
+func (r *checkRepository) LastResults(check string, limit int) ([]models.CheckResult, error) {
+	var results []models.CheckResult
+	err := r.db.Where("check_name = ?", check).Order("id DESC").Limit(limit).Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *checkRepository) PruneResults(check string, keep int) error {
+	// the oldest result to keep; no deletion when there are fewer
+	oldest := r.db.Model(&models.CheckResult{}).Select("id").
+		Where("check_name = ?", check).Order("id DESC").Offset(keep - 1).Limit(1)
+	return r.db.Where("check_name = ? AND id < (?)", check, oldest).Delete(&models.CheckResult{}).Error
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	models "back/internal/domain"
+
+	"gorm.io/gorm"
+)
+
+type HostRepository interface {
+	Create(host *models.Host) error
+	FindByID(id string) (*models.Host, error)
+	FindByHostname(hostname string) (*models.Host, error)
+	FindByAgentKeyHash(hash string) (*models.Host, error)
+	FindAll() ([]models.Host, error)
+	Update(host *models.Host) error
+	UpdateColumns(host *models.Host, columns ...string) error
+	Delete(host *models.Host) error
+
+	CreateEnrollmentToken(token *models.EnrollmentToken) error
+	FindEnrollmentTokenByHash(hash string) (*models.EnrollmentToken, error)
+	FindAllEnrollmentTokens() ([]models.EnrollmentToken, error)
+	DeleteEnrollmentToken(id string) error
+}
+
+type hostRepository struct {
+	db *gorm.DB
+}
+
+func NewHostRepository(db *gorm.DB) HostRepository {
+	return &hostRepository{db: db}
+}
+
+func (r *hostRepository) Create(host *models.Host) error {
+	return r.db.Create(host).Error
+}
+
+func (r *hostRepository) FindByID(id string) (*models.Host, error) {
+	var host models.Host
+	if err := r.db.Where("id = ?", id).First(&host).Error; err != nil {
+		return nil, err
+	}
+	return &host, nil
+}
+
+func (r *hostRepository) FindByHostname(hostname string) (*models.Host, error) {
+	var host models.Host
+	if err := r.db.Where("hostname = ?", hostname).First(&host).Error; err != nil {
+		return nil, err
+	}
+	return &host, nil
+}
+
+func (r *hostRepository) FindByAgentKeyHash(hash string) (*models.Host, error) {
+	var host models.Host
+	if err := r.db.Where("agent_key_hash = ?", hash).First(&host).Error; err != nil {
+		return nil, err
+	}
+	return &host, nil
+}
+
+func (r *hostRepository) FindAll() ([]models.Host, error) {
+	var hosts []models.Host
+	if err := r.db.Order("hostname").Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+func (r *hostRepository) Update(host *models.Host) error {
+	return r.db.Save(host).Error
+}
+
+// UpdateColumns writes only the given columns of host, leaving the others
+// as they are in the database.
+func (r *hostRepository) UpdateColumns(host *models.Host, columns ...string) error {
+	return r.db.Model(host).Select(columns).Updates(host).Error
+}
+
+func (r *hostRepository) Delete(host *models.Host) error {
+	return r.db.Delete(host).Error
+}
+
+func (r *hostRepository) CreateEnrollmentToken(token *models.EnrollmentToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *hostRepository) FindEnrollmentTokenByHash(hash string) (*models.EnrollmentToken, error) {
+	var token models.EnrollmentToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *hostRepository) FindAllEnrollmentTokens() ([]models.EnrollmentToken, error) {
+	var tokens []models.EnrollmentToken
+	if err := r.db.Order("created_at").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *hostRepository) DeleteEnrollmentToken(id string) error {
+	result := r.db.Where("id = ?", id).Delete(&models.EnrollmentToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	models "back/internal/domain"
+
+	"gorm.io/gorm"
+)
+
+type LogMetricRepository interface {
+	Create(rule *models.LogMetricRule) error
+	Delete(metric string) error
+	FindAll() ([]models.LogMetricRule, error)
+}
+
+type logMetricRepository struct {
+	db *gorm.DB
+}
+
+func NewLogMetricRepository(db *gorm.DB) LogMetricRepository {
+	return &logMetricRepository{db: db}
+}
+
+func (r *logMetricRepository) Create(rule *models.LogMetricRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *logMetricRepository) Delete(metric string) error {
+	return r.db.Where("metric = ?", metric).Delete(&models.LogMetricRule{}).Error
+}
+
+func (r *logMetricRepository) FindAll() ([]models.LogMetricRule, error) {
+	var rules []models.LogMetricRule
+	if err := r.db.Order("metric").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	models "back/internal/domain"
+
+	"gorm.io/gorm"
+)
+
+// TerminalAuditFilter selects audit entries in sequence order.
+type TerminalAuditFilter struct {
+	AfterSeq uint64
+	From     time.Time // no bound when zero
+	To       time.Time // no bound when zero
+	Limit    int
+}
+
+// ErrTerminalAuditConflict is returned by Create when another entry already
+// has the sequence number or the previous hash of the new one.
+var ErrTerminalAuditConflict = errors.New("terminal audit entry already appended")
+
+// TerminalAuditRepository has no update nor delete: the audit log is
+// append-only, which ProtectTerminalAudit enforces in the database too.
+type TerminalAuditRepository interface {
+	// Last returns the last entry, nil when the log is empty.
+	Last() (*models.TerminalAuditEntry, error)
+	Create(entry *models.TerminalAuditEntry) error
+	Find(filter TerminalAuditFilter) ([]models.TerminalAuditEntry, error)
+}
+
+type terminalAuditRepository struct {
+	db *gorm.DB
+}
+
+func NewTerminalAuditRepository(db *gorm.DB) TerminalAuditRepository {
+	return &terminalAuditRepository{db: db}
+}
+
+func (r *terminalAuditRepository) Last() (*models.TerminalAuditEntry, error) {
+	var entry models.TerminalAuditEntry
+	err := r.db.Order("seq DESC").First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *terminalAuditRepository) Create(entry *models.TerminalAuditEntry) error {
+	err := r.db.Create(entry).Error
+	if translator, ok := r.db.Dialector.(gorm.ErrorTranslator); ok && err != nil {
+		err = translator.Translate(err)
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%w: %v", ErrTerminalAuditConflict, err)
+	}
+	return err
+}
+
+func (r *terminalAuditRepository) Find(filter TerminalAuditFilter) ([]models.TerminalAuditEntry, error) {
+	query := r.db.Where("seq > ?", filter.AfterSeq)
+	if !filter.From.IsZero() {
+		query = query.Where("time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("time <= ?", filter.To)
+	}
+	var entries []models.TerminalAuditEntry
+	if err := query.Order("seq").Limit(filter.Limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ProtectTerminalAudit makes PostgreSQL reject the updates, deletions and
+// truncations of the audit log table. The owner of the table can still drop
+// the triggers: only an anchor kept outside the database reveals the removal
+// of the last entries.
+func ProtectTerminalAudit(db *gorm.DB) error {
+	for _, statement := range []string{
+		`CREATE OR REPLACE FUNCTION terminal_audit_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'terminal_audit_entries is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS terminal_audit_no_change ON terminal_audit_entries`,
+		`CREATE TRIGGER terminal_audit_no_change BEFORE UPDATE OR DELETE ON terminal_audit_entries
+			FOR EACH ROW EXECUTE FUNCTION terminal_audit_append_only()`,
+		`DROP TRIGGER IF EXISTS terminal_audit_no_truncate ON terminal_audit_entries`,
+		`CREATE TRIGGER terminal_audit_no_truncate BEFORE TRUNCATE ON terminal_audit_entries
+			FOR EACH STATEMENT EXECUTE FUNCTION terminal_audit_append_only()`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"strings"
+
+	models "back/internal/domain"
+
+	"gorm.io/gorm"
+)
+
+// TerminalHistoryFilter selects a page of the terminal history, newest first.
+type TerminalHistoryFilter struct {
+	UserID string // all the users when empty
+	Search string // case-insensitive substring of the command or its output
+	Limit  int
+	Offset int
+}
+
+type TerminalHistoryRepository interface {
+	Create(record *models.TerminalCommandRecord) error
+	// Find returns the records of the page and the number of matching records.
+	Find(filter TerminalHistoryFilter) ([]models.TerminalCommandRecord, int64, error)
+}
+
+type terminalHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewTerminalHistoryRepository(db *gorm.DB) TerminalHistoryRepository {
+	return &terminalHistoryRepository{db: db}
+}
+
+func (r *terminalHistoryRepository) Create(record *models.TerminalCommandRecord) error {
+	return r.db.Create(record).Error
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *terminalHistoryRepository) Find(filter TerminalHistoryFilter) ([]models.TerminalCommandRecord, int64, error) {
+	query := r.db.Model(&models.TerminalCommandRecord{})
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Search) + "%"
+		query = query.Where("command ILIKE ? OR output ILIKE ?", pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []models.TerminalCommandRecord
+	err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&records).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
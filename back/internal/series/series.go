@@ -0,0 +1,191 @@
+// Package series stores the application metrics received besides the host
+// samples (StatsD, remote write, plugins...): free-form named series, each
+// identified by its metric name, host and labels.
+package series
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Sample is one value of a series.
+type Sample struct {
+	Metric    string            `json:"metric"`
+	Host      string            `json:"host"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+}
+
+type Point struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Series is a copy of a stored series.
+type Series struct {
+	Metric string            `json:"metric"`
+	Host   string            `json:"host"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []Point           `json:"points"`
+}
+
+// Info describes a series without its points.
+type Info struct {
+	Metric string            `json:"metric"`
+	Host   string            `json:"host"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Count  int               `json:"count"`
+	Last   Point             `json:"last"`
+}
+
+// Filter selects series; empty fields match everything.
+type Filter struct {
+	Metric string
+	Host   string
+	Labels map[string]string // every label must match
+}
+
+func (f Filter) match(s *Series) bool {
+	if f.Metric != "" && f.Metric != s.Metric {
+		return false
+	}
+	if f.Host != "" && f.Host != s.Host {
+		return false
+	}
+	for k, v := range f.Labels {
+		if s.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Store keeps the last points of each series in memory.
+type Store struct {
+	limit     int // points per series
+	maxSeries int
+
+	mu      sync.RWMutex
+	series  map[string]*Series
+	dropped int64 // samples of new series refused beyond maxSeries
+}
+
+func NewStore(limit, maxSeries int) *Store {
+	return &Store{limit: limit, maxSeries: maxSeries, series: map[string]*Series{}}
+}
+
+// Key identifies the series of a sample: metric, host and sorted labels.
+func Key(metric, host string, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(metric)
+	b.WriteByte('\x00')
+	b.WriteString(host)
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteByte('\x00')
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+	}
+	return b.String()
+}
+
+// Add appends a sample to its series. It returns false when the sample
+// starts a new series and the store already holds maxSeries of them.
+func (s *Store) Add(sample Sample) bool {
+	key := Key(sample.Metric, sample.Host, sample.Labels)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ser, ok := s.series[key]
+	if !ok {
+		if s.maxSeries > 0 && len(s.series) >= s.maxSeries {
+			s.dropped++
+			return false
+		}
+		labels := make(map[string]string, len(sample.Labels))
+		for k, v := range sample.Labels {
+			labels[k] = v
+		}
+		ser = &Series{Metric: sample.Metric, Host: sample.Host, Labels: labels}
+		s.series[key] = ser
+	}
+	ser.Points = append(ser.Points, Point{Timestamp: sample.Timestamp, Value: sample.Value})
+	if len(ser.Points) > s.limit {
+		ser.Points = ser.Points[len(ser.Points)-s.limit:]
+	}
+	return true
+}
+
+// List describes the series matching f, sorted by metric, host and labels.
+func (s *Store) List(f Filter) []Info {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	infos := []Info{}
+	for _, key := range s.sortedKeys() {
+		ser := s.series[key]
+		if !f.match(ser) {
+			continue
+		}
+		info := Info{Metric: ser.Metric, Host: ser.Host, Labels: ser.Labels, Count: len(ser.Points)}
+		if len(ser.Points) > 0 {
+			info.Last = ser.Points[len(ser.Points)-1]
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Query returns the series matching f with their points between from and
+// to (unix seconds, inclusive, to <= 0 meaning no upper bound).
+func (s *Store) Query(f Filter, from, to int64) []Series {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := []Series{}
+	for _, key := range s.sortedKeys() {
+		ser := s.series[key]
+		if !f.match(ser) {
+			continue
+		}
+		points := []Point{}
+		for _, p := range ser.Points {
+			if p.Timestamp >= from && (to <= 0 || p.Timestamp <= to) {
+				points = append(points, p)
+			}
+		}
+		result = append(result, Series{Metric: ser.Metric, Host: ser.Host, Labels: ser.Labels, Points: points})
+	}
+	return result
+}
+
+// Dropped returns how many samples were refused because of maxSeries.
+func (s *Store) Dropped() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dropped
+}
+
+// ForgetHost drops the series of a host removed from the inventory.
+func (s *Store) ForgetHost(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, ser := range s.series {
+		if ser.Host == host {
+			delete(s.series, key)
+		}
+	}
+}
+
+func (s *Store) sortedKeys() []string {
+	keys := make([]string, 0, len(s.series))
+	for key := range s.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
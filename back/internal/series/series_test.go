@@ -0,0 +1,48 @@
+package series
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreKeepsSeriesApart(t *testing.T) {
+	s := NewStore(3, 0)
+	for ts := int64(1); ts <= 5; ts++ {
+		s.Add(Sample{Metric: "api.latency", Host: "web-1", Labels: map[string]string{"route": "/a"}, Timestamp: ts, Value: float64(ts)})
+	}
+	s.Add(Sample{Metric: "api.latency", Host: "web-1", Labels: map[string]string{"route": "/b"}, Timestamp: 1, Value: 10})
+	s.Add(Sample{Metric: "api.errors", Host: "web-2", Timestamp: 1, Value: 1})
+
+	infos := s.List(Filter{Metric: "api.latency"})
+	require.Len(t, infos, 2)
+	assert.Equal(t, 3, infos[0].Count)
+	assert.Equal(t, Point{Timestamp: 5, Value: 5}, infos[0].Last)
+	assert.Equal(t, "/b", infos[1].Labels["route"])
+
+	result := s.Query(Filter{Labels: map[string]string{"route": "/a"}}, 4, 0)
+	require.Len(t, result, 1)
+	assert.Equal(t, []Point{{4, 4}, {5, 5}}, result[0].Points)
+
+	assert.Len(t, s.List(Filter{Host: "web-2"}), 1)
+	s.ForgetHost("web-2")
+	assert.Empty(t, s.List(Filter{Host: "web-2"}))
+}
+
+func TestStoreLimitsSeries(t *testing.T) {
+	s := NewStore(10, 2)
+	assert.True(t, s.Add(Sample{Metric: "a", Timestamp: 1}))
+	assert.True(t, s.Add(Sample{Metric: "b", Timestamp: 1}))
+	assert.False(t, s.Add(Sample{Metric: "c", Timestamp: 1}))
+	// existing series still accept points
+	assert.True(t, s.Add(Sample{Metric: "a", Timestamp: 2}))
+	assert.Equal(t, int64(1), s.Dropped())
+}
+
+func TestKeyIgnoresLabelOrder(t *testing.T) {
+	a := Key("m", "h", map[string]string{"x": "1", "y": "2"})
+	b := Key("m", "h", map[string]string{"y": "2", "x": "1"})
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, Key("m", "h", map[string]string{"x": "12"}))
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"encoding/json"
+
+	"back/internal/alerting"
+	models "back/internal/domain"
+	"back/internal/repositories"
+)
+
+// AlertRuleService stores the alert rules created through the API; the
+// default rules and those of the checks are built again on startup.
+type AlertRuleService interface {
+	Create(cfg alerting.RuleConfig) error
+	Delete(name string) error
+	List() ([]alerting.RuleConfig, error)
+}
+
+type alertRuleService struct {
+	repo repositories.AlertRuleRepository
+}
+
+func NewAlertRuleService(repo repositories.AlertRuleRepository) AlertRuleService {
+	return &alertRuleService{repo: repo}
+}
+
+func (s *alertRuleService) Create(cfg alerting.RuleConfig) error {
+	if _, err := alerting.NewRule(cfg); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.repo.Create(&models.AlertRule{Name: cfg.Name, Config: string(data)})
+}
+
+func (s *alertRuleService) Delete(name string) error {
+	return s.repo.Delete(name)
+}
+
+func (s *alertRuleService) List() ([]alerting.RuleConfig, error) {
+	records, err := s.repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]alerting.RuleConfig, len(records))
+	for i, record := range records {
+		if err := json.Unmarshal([]byte(record.Config), &configs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+
+	"back/internal/alerting"
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockAlertRuleRepo struct {
+	rules []models.AlertRule
+}
+
+func (m *mockAlertRuleRepo) Create(rule *models.AlertRule) error {
+	m.rules = append(m.rules, *rule)
+	return nil
+}
+func (m *mockAlertRuleRepo) Delete(name string) error {
+	for i, rule := range m.rules {
+		if rule.Name == name {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+func (m *mockAlertRuleRepo) FindAll() ([]models.AlertRule, error) { return m.rules, nil }
+
+func TestAlertRuleServiceRoundTrip(t *testing.T) {
+	repo := &mockAlertRuleRepo{}
+	service := NewAlertRuleService(repo)
+
+	cfg := alerting.RuleConfig{Name: "queue-high", Type: alerting.TypeThreshold, Metric: "app.queue",
+		Labels: map[string]string{"queue": "mail"}, Operator: ">", Threshold: 100}
+	require.NoError(t, service.Create(cfg))
+	assert.Error(t, service.Create(alerting.RuleConfig{Name: "bad", Type: "unknown", Metric: "cpu"}))
+
+	configs, err := service.List()
+	require.NoError(t, err)
+	assert.Equal(t, []alerting.RuleConfig{cfg}, configs)
+
+	require.NoError(t, service.Delete("queue-high"))
+	configs, err = service.List()
+	require.NoError(t, err)
+	assert.Empty(t, configs)
+}
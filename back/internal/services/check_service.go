@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+
+	"back/internal/checks"
+	models "back/internal/domain"
+	"back/internal/repositories"
+)
+
+// CheckService stores the synthetic checks and their results for the
+// checks.Manager, which keeps them in memory once loaded.
+type CheckService interface {
+	SaveCheck(cfg checks.Config) error
+	DeleteCheck(name string) error
+	LoadChecks() ([]checks.Config, error)
+	SaveResult(res *checks.Result, keep int) error
+	LoadResults(name string, limit int) ([]checks.Result, error)
+}
+
+type checkService struct {
+	repo repositories.CheckRepository
+}
+
+func NewCheckService(repo repositories.CheckRepository) CheckService {
+	return &checkService{repo: repo}
+}
+
+func (s *checkService) SaveCheck(cfg checks.Config) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.repo.Create(&models.Check{Name: cfg.Name, Config: string(data)})
+}
+
+func (s *checkService) DeleteCheck(name string) error {
+	return s.repo.Delete(name)
+}
+
+func (s *checkService) LoadChecks() ([]checks.Config, error) {
+	records, err := s.repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]checks.Config, len(records))
+	for i, record := range records {
+		if err := json.Unmarshal([]byte(record.Config), &configs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
+
+// SaveResult sets the ID of res and keeps the last keep results of its check.
+func (s *checkService) SaveResult(res *checks.Result, keep int) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	record := &models.CheckResult{CheckName: res.Check, Timestamp: res.Timestamp, Success: res.Success, Result: string(data)}
+	if err := s.repo.CreateResult(record); err != nil {
+		return err
+	}
+	res.ID = record.ID
+	return s.repo.PruneResults(res.Check, keep)
+}
+
+// LoadResults returns the last limit results of a check, oldest first.
+func (s *checkService) LoadResults(name string, limit int) ([]checks.Result, error) {
+	records, err := s.repo.LastResults(name, limit)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]checks.Result, len(records))
+	for i, record := range records {
+		res := &results[len(records)-1-i]
+		if err := json.Unmarshal([]byte(record.Result), res); err != nil {
+			return nil, err
+		}
+		res.ID = record.ID
+	}
+	return results, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+
+	"back/internal/checks"
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCheckRepo struct {
+	checks  []models.Check
+	results []models.CheckResult
+	pruned  map[string]int
+}
+
+func (m *mockCheckRepo) Create(check *models.Check) error {
+	m.checks = append(m.checks, *check)
+	return nil
+}
+func (m *mockCheckRepo) Delete(name string) error {
+	m.checks = nil
+	return nil
+}
+func (m *mockCheckRepo) FindAll() ([]models.Check, error) { return m.checks, nil }
+func (m *mockCheckRepo) CreateResult(result *models.CheckResult) error {
+	result.ID = int64(len(m.results) + 1)
+	m.results = append(m.results, *result)
+	return nil
+}
+func (m *mockCheckRepo) LastResults(check string, limit int) ([]models.CheckResult, error) {
+	var results []models.CheckResult
+	for i := len(m.results) - 1; i >= 0 && len(results) < limit; i-- {
+		if m.results[i].CheckName == check {
+			results = append(results, m.results[i])
+		}
+	}
+	return results, nil
+}
+func (m *mockCheckRepo) PruneResults(check string, keep int) error {
+	m.pruned[check] = keep
+	return nil
+}
+
+func TestCheckServiceRoundTrip(t *testing.T) {
+	repo := &mockCheckRepo{pruned: map[string]int{}}
+	service := NewCheckService(repo)
+
+	cfg := checks.Config{Name: "dns", Type: checks.TypeDNS, Target: "example.com", DNS: &checks.DNSConfig{RecordType: "MX"}}
+	require.NoError(t, service.SaveCheck(cfg))
+	configs, err := service.LoadChecks()
+	require.NoError(t, err)
+	assert.Equal(t, []checks.Config{cfg}, configs)
+
+	for i, success := range []bool{false, true, true} {
+		res := &checks.Result{Check: "dns", Timestamp: int64(100 + i), Success: success, Answers: []string{"mx.example.com"}}
+		require.NoError(t, service.SaveResult(res, 2))
+		assert.Equal(t, int64(i+1), res.ID)
+	}
+	assert.Equal(t, 2, repo.pruned["dns"])
+	assert.True(t, repo.results[1].Success)
+	assert.Equal(t, int64(101), repo.results[1].Timestamp)
+
+	results, err := service.LoadResults("dns", 2)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, int64(2), results[0].ID, "oldest first")
+	assert.Equal(t, checks.Result{ID: 3, Check: "dns", Timestamp: 102, Success: true, Answers: []string{"mx.example.com"}}, results[1])
+}
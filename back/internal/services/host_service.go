@@ -0,0 +1,261 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	models "back/internal/domain"
+	"back/internal/repositories"
+)
+
+const (
+	// HostOfflineAfter is how long a host may stay silent before it is reported offline.
+	HostOfflineAfter = 30 * time.Second
+	// heartbeats closer than this are not written to the database
+	heartbeatWriteInterval = 10 * time.Second
+)
+
+var (
+	ErrInvalidEnrollmentToken = errors.New("invalid or expired enrollment token")
+	ErrInvalidAgentKey        = errors.New("invalid agent key")
+	ErrHostAlreadyEnrolled    = errors.New("a host with this hostname is already enrolled")
+)
+
+type HostService interface {
+	CreateEnrollmentToken(description string, ttl time.Duration) (string, *models.EnrollmentToken, error)
+	GetEnrollmentTokens() ([]models.EnrollmentToken, error)
+	RevokeEnrollmentToken(id string) error
+
+	Enroll(enrollmentToken, agentKey string, info models.HostInfo) (*models.Host, string, error)
+	RegisterLocal(info models.HostInfo) (*models.Host, error)
+	Authenticate(agentKey string) (*models.Host, error)
+	Heartbeat(host *models.Host, agentVersion string) error
+
+	GetHostByID(id string) (*models.Host, error)
+	GetAllHosts() ([]models.Host, error)
+	UpdateHostLabels(id string, labels map[string]string) (*models.Host, error)
+	DeleteHost(id string) (*models.Host, error)
+}
+
+type hostService struct {
+	repo repositories.HostRepository
+
+	mu         sync.Mutex
+	lastWrites map[string]time.Time // host ID -> last LastSeen written
+}
+
+func NewHostService(repo repositories.HostRepository) HostService {
+	return &hostService{repo: repo, lastWrites: map[string]time.Time{}}
+}
+
+// CreateEnrollmentToken returns the plain token, which is only known at
+// creation time: the database keeps its hash.
+func (s *hostService) CreateEnrollmentToken(description string, ttl time.Duration) (string, *models.EnrollmentToken, error) {
+	plain, err := generateSecret()
+	if err != nil {
+		return "", nil, err
+	}
+	token := &models.EnrollmentToken{
+		TokenHash:   hashSecret(plain),
+		Description: description,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateEnrollmentToken(token); err != nil {
+		return "", nil, err
+	}
+	return plain, token, nil
+}
+
+func (s *hostService) GetEnrollmentTokens() ([]models.EnrollmentToken, error) {
+	return s.repo.FindAllEnrollmentTokens()
+}
+
+func (s *hostService) RevokeEnrollmentToken(id string) error {
+	return s.repo.DeleteEnrollmentToken(id)
+}
+
+// Enroll registers the host described by info and returns its new agent
+// key. A hostname already in the inventory is only re-enrolled, rotating its
+// key, when agentKey is the current key of that host: an enrollment token
+// alone must not take over the identity and history of a known host.
+func (s *hostService) Enroll(enrollmentToken, agentKey string, info models.HostInfo) (*models.Host, string, error) {
+	token, err := s.repo.FindEnrollmentTokenByHash(hashSecret(enrollmentToken))
+	if err != nil {
+		return nil, "", ErrInvalidEnrollmentToken
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return nil, "", ErrInvalidEnrollmentToken
+	}
+
+	host, err := s.repo.FindByHostname(info.Hostname)
+	if err == nil && !ownsHost(host, agentKey) {
+		return nil, "", ErrHostAlreadyEnrolled
+	}
+
+	newKey, err := generateSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	host, err = s.save(host, info, hashSecret(newKey))
+	if err != nil {
+		return nil, "", err
+	}
+	return host, newKey, nil
+}
+
+// ownsHost reports whether agentKey is the current key of host. The local
+// host has no key, so it can never be enrolled by an agent.
+func ownsHost(host *models.Host, agentKey string) bool {
+	if agentKey == "" || host.AgentKeyHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashSecret(agentKey)), []byte(host.AgentKeyHash)) == 1
+}
+
+// RegisterLocal records the machine the server runs on. It never touches
+// the agent key of the host.
+func (s *hostService) RegisterLocal(info models.HostInfo) (*models.Host, error) {
+	host, _ := s.repo.FindByHostname(info.Hostname)
+	return s.save(host, info, "")
+}
+
+// save creates the host when it is nil, or updates it from info. The agent
+// key hash is only written when one is given.
+func (s *hostService) save(host *models.Host, info models.HostInfo, agentKeyHash string) (*models.Host, error) {
+	isNew := host == nil
+	if isNew {
+		host = &models.Host{Hostname: info.Hostname}
+	}
+	if info.Labels != nil {
+		host.Labels = info.Labels
+	}
+	host.OS = info.OS
+	host.Kernel = info.Kernel
+	host.CPUCount = info.CPUCount
+	host.TotalMemory = info.TotalMemory
+	host.AgentVersion = info.AgentVersion
+	if agentKeyHash != "" {
+		host.AgentKeyHash = agentKeyHash
+	}
+	host.LastSeen = time.Now()
+
+	var err error
+	if isNew {
+		err = s.repo.Create(host)
+	} else {
+		err = s.repo.Update(host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setOnline(host)
+	return host, nil
+}
+
+func (s *hostService) Authenticate(agentKey string) (*models.Host, error) {
+	if agentKey == "" {
+		return nil, ErrInvalidAgentKey
+	}
+	host, err := s.repo.FindByAgentKeyHash(hashSecret(agentKey))
+	if err != nil {
+		return nil, ErrInvalidAgentKey
+	}
+	return host, nil
+}
+
+// Heartbeat marks the host as seen now. Writes are throttled so an agent
+// pushing every second does not update its row every second, and only touch
+// last_seen and agent_version: host may be a stale copy, and writing it
+// whole would undo a concurrent label change.
+func (s *hostService) Heartbeat(host *models.Host, agentVersion string) error {
+	now := time.Now()
+	s.mu.Lock()
+	last, ok := s.lastWrites[host.ID]
+	if ok && now.Sub(last) < heartbeatWriteInterval && (agentVersion == "" || agentVersion == host.AgentVersion) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastWrites[host.ID] = now
+	s.mu.Unlock()
+
+	host.LastSeen = now
+	if agentVersion == "" {
+		return s.repo.UpdateColumns(host, "last_seen")
+	}
+	host.AgentVersion = agentVersion
+	return s.repo.UpdateColumns(host, "last_seen", "agent_version")
+}
+
+func (s *hostService) GetHostByID(id string) (*models.Host, error) {
+	host, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	setOnline(host)
+	return host, nil
+}
+
+func (s *hostService) GetAllHosts() ([]models.Host, error) {
+	hosts, err := s.repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		setOnline(&hosts[i])
+	}
+	return hosts, nil
+}
+
+func (s *hostService) UpdateHostLabels(id string, labels map[string]string) (*models.Host, error) {
+	host, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	host.Labels = labels
+	if err := s.repo.UpdateColumns(host, "labels"); err != nil {
+		return nil, err
+	}
+	setOnline(host)
+	return host, nil
+}
+
+func (s *hostService) DeleteHost(id string) (*models.Host, error) {
+	host, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Delete(host); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	delete(s.lastWrites, host.ID)
+	s.mu.Unlock()
+	return host, nil
+}
+
+// setOnline derives the online flag from the last heartbeat. The throttled
+// writes lag by at most heartbeatWriteInterval, well under HostOfflineAfter.
+func setOnline(host *models.Host) {
+	host.Online = time.Since(host.LastSeen) < HostOfflineAfter
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHostRepo struct {
+	hosts   map[string]*models.Host
+	tokens  map[string]*models.EnrollmentToken
+	updates int
+	nextID  int
+}
+
+func newMockHostRepo() *mockHostRepo {
+	return &mockHostRepo{hosts: map[string]*models.Host{}, tokens: map[string]*models.EnrollmentToken{}}
+}
+
+var errNotFound = errors.New("record not found")
+
+func (m *mockHostRepo) Create(host *models.Host) error {
+	m.nextID++
+	host.ID = fmt.Sprintf("host-%d", m.nextID)
+	stored := *host
+	m.hosts[host.ID] = &stored
+	return nil
+}
+func (m *mockHostRepo) FindByID(id string) (*models.Host, error) {
+	if host, ok := m.hosts[id]; ok {
+		stored := *host
+		return &stored, nil
+	}
+	return nil, errNotFound
+}
+func (m *mockHostRepo) FindByHostname(hostname string) (*models.Host, error) {
+	for _, host := range m.hosts {
+		if host.Hostname == hostname {
+			stored := *host
+			return &stored, nil
+		}
+	}
+	return nil, errNotFound
+}
+func (m *mockHostRepo) FindByAgentKeyHash(hash string) (*models.Host, error) {
+	for _, host := range m.hosts {
+		if host.AgentKeyHash != "" && host.AgentKeyHash == hash {
+			stored := *host
+			return &stored, nil
+		}
+	}
+	return nil, errNotFound
+}
+func (m *mockHostRepo) FindAll() ([]models.Host, error) {
+	hosts := []models.Host{}
+	for _, host := range m.hosts {
+		hosts = append(hosts, *host)
+	}
+	return hosts, nil
+}
+func (m *mockHostRepo) Update(host *models.Host) error {
+	m.updates++
+	stored := *host
+	m.hosts[host.ID] = &stored
+	return nil
+}
+func (m *mockHostRepo) UpdateColumns(host *models.Host, columns ...string) error {
+	m.updates++
+	stored := m.hosts[host.ID]
+	for _, column := range columns {
+		switch column {
+		case "labels":
+			stored.Labels = host.Labels
+		case "last_seen":
+			stored.LastSeen = host.LastSeen
+		case "agent_version":
+			stored.AgentVersion = host.AgentVersion
+		default:
+			return fmt.Errorf("unexpected column %s", column)
+		}
+	}
+	return nil
+}
+func (m *mockHostRepo) Delete(host *models.Host) error {
+	delete(m.hosts, host.ID)
+	return nil
+}
+func (m *mockHostRepo) CreateEnrollmentToken(token *models.EnrollmentToken) error {
+	token.ID = token.TokenHash[:8]
+	m.tokens[token.ID] = token
+	return nil
+}
+func (m *mockHostRepo) FindEnrollmentTokenByHash(hash string) (*models.EnrollmentToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return nil, errNotFound
+}
+func (m *mockHostRepo) FindAllEnrollmentTokens() ([]models.EnrollmentToken, error) {
+	tokens := []models.EnrollmentToken{}
+	for _, token := range m.tokens {
+		tokens = append(tokens, *token)
+	}
+	return tokens, nil
+}
+func (m *mockHostRepo) DeleteEnrollmentToken(id string) error {
+	if _, ok := m.tokens[id]; !ok {
+		return errNotFound
+	}
+	delete(m.tokens, id)
+	return nil
+}
+
+func TestEnrollAndAuthenticate(t *testing.T) {
+	service := NewHostService(newMockHostRepo())
+
+	plain, token, err := service.CreateEnrollmentToken("fleet", time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, token.TokenHash)
+
+	host, agentKey, err := service.Enroll(plain, "", models.HostInfo{Hostname: "web-1", CPUCount: 4, Labels: map[string]string{"env": "prod"}})
+	require.NoError(t, err)
+	assert.Equal(t, "web-1", host.Hostname)
+	assert.True(t, host.Online)
+	assert.NotEmpty(t, agentKey)
+
+	authenticated, err := service.Authenticate(agentKey)
+	require.NoError(t, err)
+	assert.Equal(t, host.ID, authenticated.ID)
+
+	_, err = service.Authenticate("not-a-key")
+	assert.ErrorIs(t, err, ErrInvalidAgentKey)
+
+	// Enrolling again with the current key keeps the host but rotates the key
+	again, newKey, err := service.Enroll(plain, agentKey, models.HostInfo{Hostname: "web-1"})
+	require.NoError(t, err)
+	assert.Equal(t, host.ID, again.ID)
+	assert.Equal(t, "prod", again.Labels["env"])
+	_, err = service.Authenticate(agentKey)
+	assert.Error(t, err)
+	_, err = service.Authenticate(newKey)
+	assert.NoError(t, err)
+}
+
+func TestEnrollRejectsInvalidTokens(t *testing.T) {
+	service := NewHostService(newMockHostRepo())
+
+	_, _, err := service.Enroll("unknown", "", models.HostInfo{Hostname: "web-1"})
+	assert.ErrorIs(t, err, ErrInvalidEnrollmentToken)
+
+	plain, token, err := service.CreateEnrollmentToken("short-lived", time.Hour)
+	require.NoError(t, err)
+	expired := time.Now().Add(-time.Minute)
+	token.ExpiresAt = &expired
+	_, _, err = service.Enroll(plain, "", models.HostInfo{Hostname: "web-1"})
+	assert.ErrorIs(t, err, ErrInvalidEnrollmentToken)
+
+	plain, token, err = service.CreateEnrollmentToken("revoked", 0)
+	require.NoError(t, err)
+	require.NoError(t, service.RevokeEnrollmentToken(token.ID))
+	_, _, err = service.Enroll(plain, "", models.HostInfo{Hostname: "web-1"})
+	assert.ErrorIs(t, err, ErrInvalidEnrollmentToken)
+}
+
+func TestEnrollCannotTakeOverKnownHosts(t *testing.T) {
+	repo := newMockHostRepo()
+	service := NewHostService(repo)
+	plain, _, err := service.CreateEnrollmentToken("fleet", 0)
+	require.NoError(t, err)
+
+	local, err := service.RegisterLocal(models.HostInfo{Hostname: "server"})
+	require.NoError(t, err)
+	web, agentKey, err := service.Enroll(plain, "", models.HostInfo{Hostname: "web-1"})
+	require.NoError(t, err)
+
+	for name, key := range map[string]string{"no key": "", "wrong key": "guess"} {
+		_, _, err = service.Enroll(plain, key, models.HostInfo{Hostname: "web-1"})
+		assert.ErrorIs(t, err, ErrHostAlreadyEnrolled, name)
+	}
+	_, _, err = service.Enroll(plain, agentKey, models.HostInfo{Hostname: "server"})
+	assert.ErrorIs(t, err, ErrHostAlreadyEnrolled)
+	_, err = service.Authenticate(agentKey)
+	assert.NoError(t, err, "the key of web-1 is still valid")
+
+	// restarting the server keeps the keys of the agents
+	_, err = service.RegisterLocal(models.HostInfo{Hostname: "web-1"})
+	require.NoError(t, err)
+	authenticated, err := service.Authenticate(agentKey)
+	require.NoError(t, err)
+	assert.Equal(t, web.ID, authenticated.ID)
+	assert.Empty(t, repo.hosts[local.ID].AgentKeyHash)
+}
+
+func TestHeartbeatKeepsConcurrentLabelChanges(t *testing.T) {
+	repo := newMockHostRepo()
+	service := NewHostService(repo)
+	host, err := service.RegisterLocal(models.HostInfo{Hostname: "server"})
+	require.NoError(t, err)
+
+	_, err = service.UpdateHostLabels(host.ID, map[string]string{"role": "db"})
+	require.NoError(t, err)
+	// host is now a stale copy without the labels
+	require.NoError(t, service.Heartbeat(host, "1.2.3"))
+
+	got, err := service.GetHostByID(host.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "db", got.Labels["role"])
+	assert.Equal(t, "1.2.3", got.AgentVersion)
+}
+
+func TestHeartbeatAndOnlineStatus(t *testing.T) {
+	repo := newMockHostRepo()
+	service := NewHostService(repo)
+
+	host, err := service.RegisterLocal(models.HostInfo{Hostname: "server"})
+	require.NoError(t, err)
+
+	// mark the host as silent for too long
+	stored := repo.hosts[host.ID]
+	stored.LastSeen = time.Now().Add(-2 * HostOfflineAfter)
+	hosts, err := service.GetAllHosts()
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	assert.False(t, hosts[0].Online)
+
+	require.NoError(t, service.Heartbeat(host, "1.2.3"))
+	updates := repo.updates
+	// throttled
+	require.NoError(t, service.Heartbeat(host, ""))
+	assert.Equal(t, updates, repo.updates)
+
+	got, err := service.GetHostByID(host.ID)
+	require.NoError(t, err)
+	assert.True(t, got.Online)
+	assert.Equal(t, "1.2.3", got.AgentVersion)
+}
+
+func TestUpdateLabelsAndDeleteHost(t *testing.T) {
+	service := NewHostService(newMockHostRepo())
+	host, err := service.RegisterLocal(models.HostInfo{Hostname: "server"})
+	require.NoError(t, err)
+
+	updated, err := service.UpdateHostLabels(host.ID, map[string]string{"role": "db"})
+	require.NoError(t, err)
+	assert.Equal(t, "db", updated.Labels["role"])
+
+	_, err = service.DeleteHost(host.ID)
+	require.NoError(t, err)
+	_, err = service.GetHostByID(host.ID)
+	assert.Error(t, err)
+	_, err = service.UpdateHostLabels("missing", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	models "back/internal/domain"
+	"back/internal/logs"
+	"back/internal/repositories"
+)
+
+// LogMetricService stores the rules turning log lines into series.
+type LogMetricService interface {
+	Create(rule logs.MetricRule) error
+	Delete(metric string) error
+	List() ([]logs.MetricRule, error)
+}
+
+type logMetricService struct {
+	repo repositories.LogMetricRepository
+}
+
+func NewLogMetricService(repo repositories.LogMetricRepository) LogMetricService {
+	return &logMetricService{repo: repo}
+}
+
+func (s *logMetricService) Create(rule logs.MetricRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	return s.repo.Create(&models.LogMetricRule{Metric: rule.Metric, Source: rule.Source, Regex: rule.Regex, IntervalMS: rule.IntervalMS})
+}
+
+func (s *logMetricService) Delete(metric string) error {
+	return s.repo.Delete(metric)
+}
+
+func (s *logMetricService) List() ([]logs.MetricRule, error) {
+	records, err := s.repo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]logs.MetricRule, len(records))
+	for i, record := range records {
+		rules[i] = logs.MetricRule{Metric: record.Metric, Source: record.Source, Regex: record.Regex, IntervalMS: record.IntervalMS}
+	}
+	return rules, nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	models "back/internal/domain"
+	"back/internal/logs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockLogMetricRepo struct {
+	rules []models.LogMetricRule
+}
+
+func (m *mockLogMetricRepo) Create(rule *models.LogMetricRule) error {
+	m.rules = append(m.rules, *rule)
+	return nil
+}
+func (m *mockLogMetricRepo) Delete(metric string) error {
+	for i, rule := range m.rules {
+		if rule.Metric == metric {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+func (m *mockLogMetricRepo) FindAll() ([]models.LogMetricRule, error) { return m.rules, nil }
+
+func TestLogMetricServiceRoundTrip(t *testing.T) {
+	repo := &mockLogMetricRepo{}
+	service := NewLogMetricService(repo)
+
+	rule := logs.MetricRule{Metric: "log.app.errors", Source: "app", Regex: `\bERROR\b`, IntervalMS: 5000}
+	require.NoError(t, service.Create(rule))
+	assert.Error(t, service.Create(logs.MetricRule{Metric: "cpu", Source: "app", Regex: "x"}))
+
+	rules, err := service.List()
+	require.NoError(t, err)
+	assert.Equal(t, []logs.MetricRule{rule}, rules)
+
+	require.NoError(t, service.Delete("log.app.errors"))
+	rules, err = service.List()
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+}
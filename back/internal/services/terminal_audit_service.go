@@ -0,0 +1,245 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	models "back/internal/domain"
+	"back/internal/repositories"
+)
+
+const (
+	// terminalAuditAttempts bounds the appends racing with another server
+	// appending to the same log.
+	terminalAuditAttempts = 3
+	terminalAuditBatch    = 1000
+)
+
+// AuditAnchor is the last entry of the audit log at some point. Kept outside
+// the database, it reveals the entries removed from the end of the log,
+// which the chain alone cannot: the database owner can drop the triggers
+// and delete them.
+type AuditAnchor struct {
+	Seq       uint64 `json:"seq"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature,omitempty"` // HMAC-SHA256 of seq and hash with the anchor key
+}
+
+// AuditAnchorConfig says where the anchors go outside the database.
+type AuditAnchorConfig struct {
+	// File receives the anchor of every appended entry when set.
+	File string
+	// Key signs the anchors when set; the anchors to verify must then be
+	// signed with it.
+	Key []byte
+}
+
+// AuditAnchorConfigFromEnv reads TERMINAL_AUDIT_ANCHOR_FILE and
+// TERMINAL_AUDIT_KEY.
+func AuditAnchorConfigFromEnv() AuditAnchorConfig {
+	cfg := AuditAnchorConfig{File: os.Getenv("TERMINAL_AUDIT_ANCHOR_FILE")}
+	if key := os.Getenv("TERMINAL_AUDIT_KEY"); key != "" {
+		cfg.Key = []byte(key)
+	}
+	return cfg
+}
+
+// AuditVerification is the outcome of the check of the audit log chain.
+type AuditVerification struct {
+	Entries  uint64 `json:"entries"`
+	Valid    bool   `json:"valid"`
+	BrokenAt uint64 `json:"broken_at,omitempty"` // sequence number of the first invalid entry
+	Reason   string `json:"reason,omitempty"`
+	LastHash string `json:"last_hash,omitempty"`
+	// AnchorSeq is the entry of the anchor checked, zero when there was no
+	// anchor and the removal of the last entries went unnoticed.
+	AnchorSeq uint64 `json:"anchor_seq,omitempty"`
+	// Anchor is the anchor of the last entry, to keep outside the database.
+	Anchor *AuditAnchor `json:"anchor,omitempty"`
+}
+
+type TerminalAuditService interface {
+	// Record appends entry, setting its sequence number and hashes.
+	Record(entry *models.TerminalAuditEntry) error
+	Entries(filter repositories.TerminalAuditFilter) ([]models.TerminalAuditEntry, error)
+	// Verify checks the chain and that it still holds anchor, or the one of
+	// the anchor file when nil.
+	Verify(anchor *AuditAnchor) (*AuditVerification, error)
+}
+
+type terminalAuditService struct {
+	repo   repositories.TerminalAuditRepository
+	anchor AuditAnchorConfig
+	mu     sync.Mutex
+}
+
+func NewTerminalAuditService(repo repositories.TerminalAuditRepository, anchor AuditAnchorConfig) TerminalAuditService {
+	return &terminalAuditService{repo: repo, anchor: anchor}
+}
+
+func (s *terminalAuditService) Record(entry *models.TerminalAuditEntry) error {
+	entry.Time = entry.Time.Truncate(time.Millisecond)
+	entry.Command = storableText(entry.Command)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for range terminalAuditAttempts {
+		var last *models.TerminalAuditEntry
+		if last, err = s.repo.Last(); err != nil {
+			return err
+		}
+		entry.Seq, entry.PrevHash = 1, ""
+		if last != nil {
+			entry.Seq, entry.PrevHash = last.Seq+1, last.Hash
+		}
+		entry.Hash = entry.ComputeHash()
+		// the unique sequence number and previous hash make a concurrent
+		// append fail rather than fork the chain
+		err = s.repo.Create(entry)
+		if err == nil {
+			return s.writeAnchor(entry)
+		}
+		if !errors.Is(err, repositories.ErrTerminalAuditConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *terminalAuditService) sign(seq uint64, hash string) string {
+	mac := hmac.New(sha256.New, s.anchor.Key)
+	fmt.Fprintf(mac, "%d\n%s", seq, hash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *terminalAuditService) anchorOf(entry *models.TerminalAuditEntry) *AuditAnchor {
+	anchor := &AuditAnchor{Seq: entry.Seq, Hash: entry.Hash}
+	if s.anchor.Key != nil {
+		anchor.Signature = s.sign(entry.Seq, entry.Hash)
+	}
+	return anchor
+}
+
+// writeAnchor replaces the anchor file with the anchor of entry.
+func (s *terminalAuditService) writeAnchor(entry *models.TerminalAuditEntry) error {
+	if s.anchor.File == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.anchorOf(entry))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.anchor.File), ".audit-anchor-*")
+	if err != nil {
+		return fmt.Errorf("entry %d appended, anchor not written: %w", entry.Seq, err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.anchor.File)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("entry %d appended, anchor not written: %w", entry.Seq, err)
+	}
+	return nil
+}
+
+// readAnchor returns the anchor of the anchor file, nil when there is none.
+func (s *terminalAuditService) readAnchor() (*AuditAnchor, error) {
+	if s.anchor.File == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(s.anchor.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var anchor AuditAnchor
+	if err := json.Unmarshal(data, &anchor); err != nil {
+		return nil, fmt.Errorf("invalid anchor file: %w", err)
+	}
+	return &anchor, nil
+}
+
+// Entries clamps the limit to 1..terminalAuditBatch.
+func (s *terminalAuditService) Entries(filter repositories.TerminalAuditFilter) ([]models.TerminalAuditEntry, error) {
+	if filter.Limit <= 0 || filter.Limit > terminalAuditBatch {
+		filter.Limit = terminalAuditBatch
+	}
+	return s.repo.Find(filter)
+}
+
+// Verify walks the whole log, checking that the entries follow each other,
+// that their hashes match their content and that the anchor entry is
+// still there, unchanged.
+func (s *terminalAuditService) Verify(anchor *AuditAnchor) (*AuditVerification, error) {
+	if anchor == nil {
+		var err error
+		if anchor, err = s.readAnchor(); err != nil {
+			return nil, err
+		}
+	}
+	result := &AuditVerification{Valid: true}
+	broken := func(at uint64, reason string) (*AuditVerification, error) {
+		result.Valid = false
+		result.BrokenAt = at
+		result.Reason = reason
+		return result, nil
+	}
+	if anchor != nil {
+		if s.anchor.Key != nil && !hmac.Equal([]byte(anchor.Signature), []byte(s.sign(anchor.Seq, anchor.Hash))) {
+			return broken(anchor.Seq, "anchor signature does not match")
+		}
+		result.AnchorSeq = anchor.Seq
+	}
+
+	filter := repositories.TerminalAuditFilter{Limit: terminalAuditBatch}
+	var last *models.TerminalAuditEntry
+	for {
+		entries, err := s.repo.Find(filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			switch {
+			case entry.Seq != result.Entries+1:
+				return broken(result.Entries+1, fmt.Sprintf("entry %d missing", result.Entries+1))
+			case entry.PrevHash != result.LastHash:
+				return broken(entry.Seq, "previous hash does not match")
+			case entry.Hash != entry.ComputeHash():
+				return broken(entry.Seq, "hash does not match the content")
+			case anchor != nil && entry.Seq == anchor.Seq && entry.Hash != anchor.Hash:
+				return broken(entry.Seq, "hash does not match the anchor")
+			}
+			result.Entries = entry.Seq
+			result.LastHash = entry.Hash
+			last = entry
+		}
+		if len(entries) < filter.Limit {
+			break
+		}
+		filter.AfterSeq = result.Entries
+	}
+	if anchor != nil && result.Entries < anchor.Seq {
+		return broken(result.Entries+1, fmt.Sprintf("entries %d to %d of the anchor missing", result.Entries+1, anchor.Seq))
+	}
+	if last != nil {
+		result.Anchor = s.anchorOf(last)
+	}
+	return result, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+	"back/internal/repositories"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTerminalAuditRepo struct {
+	entries []models.TerminalAuditEntry
+	// beforeCreate runs between Last and Create, like another server appending
+	beforeCreate func()
+	createErr    error
+	creates      int
+}
+
+func (m *mockTerminalAuditRepo) Last() (*models.TerminalAuditEntry, error) {
+	if len(m.entries) == 0 {
+		return nil, nil
+	}
+	last := m.entries[len(m.entries)-1]
+	return &last, nil
+}
+func (m *mockTerminalAuditRepo) Create(entry *models.TerminalAuditEntry) error {
+	m.creates++
+	if m.createErr != nil {
+		return m.createErr
+	}
+	if m.beforeCreate != nil {
+		hook := m.beforeCreate
+		m.beforeCreate = nil
+		hook()
+	}
+	for _, existing := range m.entries {
+		if existing.Seq == entry.Seq || existing.PrevHash == entry.PrevHash {
+			return fmt.Errorf("%w: duplicate key value violates unique constraint", repositories.ErrTerminalAuditConflict)
+		}
+	}
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+func (m *mockTerminalAuditRepo) Find(filter repositories.TerminalAuditFilter) ([]models.TerminalAuditEntry, error) {
+	var found []models.TerminalAuditEntry
+	for _, entry := range m.entries {
+		if entry.Seq > filter.AfterSeq && len(found) < filter.Limit {
+			found = append(found, entry)
+		}
+	}
+	return found, nil
+}
+
+func recordAudit(t *testing.T, service TerminalAuditService, command string) models.TerminalAuditEntry {
+	entry := &models.TerminalAuditEntry{
+		Time:     time.Now(),
+		UserID:   "alice",
+		Mode:     "command",
+		Command:  command,
+		Target:   "host",
+		ExitCode: 0,
+		State:    "success",
+	}
+	require.NoError(t, service.Record(entry))
+	return *entry
+}
+
+func TestTerminalAuditChain(t *testing.T) {
+	repo := &mockTerminalAuditRepo{}
+	service := NewTerminalAuditService(repo, AuditAnchorConfig{})
+
+	first := recordAudit(t, service, "uptime")
+	assert.Equal(t, uint64(1), first.Seq)
+	assert.Empty(t, first.PrevHash)
+	assert.Len(t, first.Hash, 64)
+	assert.Equal(t, first.Time, first.Time.Truncate(time.Millisecond))
+	for i := range 2500 {
+		recordAudit(t, service, fmt.Sprintf("echo %d", i))
+	}
+	assert.Equal(t, first.Hash, repo.entries[1].PrevHash)
+
+	result, err := service.Verify(nil)
+	require.NoError(t, err)
+	last := repo.entries[2500]
+	assert.Equal(t, &AuditVerification{Entries: 2501, Valid: true, LastHash: last.Hash,
+		Anchor: &AuditAnchor{Seq: 2501, Hash: last.Hash}}, result)
+}
+
+func TestTerminalAuditDetectsTampering(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		tamper   func(entries []models.TerminalAuditEntry) []models.TerminalAuditEntry
+		brokenAt uint64
+	}{
+		{"changed", func(entries []models.TerminalAuditEntry) []models.TerminalAuditEntry {
+			entries[2].Command = "echo innocent"
+			return entries
+		}, 3},
+		{"rehashed", func(entries []models.TerminalAuditEntry) []models.TerminalAuditEntry {
+			entries[2].ExitCode = 0
+			entries[2].Hash = entries[2].ComputeHash()
+			return entries // the next entry no longer follows
+		}, 4},
+		{"removed", func(entries []models.TerminalAuditEntry) []models.TerminalAuditEntry {
+			return append(entries[:2], entries[3:]...)
+		}, 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockTerminalAuditRepo{}
+			service := NewTerminalAuditService(repo, AuditAnchorConfig{})
+			for i := range 5 {
+				entry := &models.TerminalAuditEntry{Time: time.Now(), UserID: "alice", Command: fmt.Sprintf("rm -rf /tmp/%d", i), ExitCode: 1}
+				require.NoError(t, service.Record(entry))
+			}
+			repo.entries = tt.tamper(repo.entries)
+
+			result, err := service.Verify(nil)
+			require.NoError(t, err)
+			assert.False(t, result.Valid)
+			assert.Equal(t, tt.brokenAt, result.BrokenAt)
+			assert.NotEmpty(t, result.Reason)
+		})
+	}
+}
+
+func TestTerminalAuditConcurrentAppend(t *testing.T) {
+	repo := &mockTerminalAuditRepo{}
+	service := NewTerminalAuditService(repo, AuditAnchorConfig{})
+	other := NewTerminalAuditService(repo, AuditAnchorConfig{}) // another server on the same database
+
+	recordAudit(t, service, "first")
+	repo.beforeCreate = func() { recordAudit(t, other, "from the other server") }
+	entry := recordAudit(t, service, "second")
+
+	assert.Equal(t, uint64(3), entry.Seq)
+	assert.Equal(t, repo.entries[1].Hash, entry.PrevHash)
+	result, err := service.Verify(nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestTerminalAuditRetriesOnlyConflicts(t *testing.T) {
+	repo := &mockTerminalAuditRepo{createErr: errors.New("connection refused")}
+	service := NewTerminalAuditService(repo, AuditAnchorConfig{})
+
+	err := service.Record(&models.TerminalAuditEntry{Time: time.Now(), UserID: "alice", Command: "uptime"})
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 1, repo.creates)
+}
+
+func TestTerminalAuditAnchor(t *testing.T) {
+	repo := &mockTerminalAuditRepo{}
+	cfg := AuditAnchorConfig{File: filepath.Join(t.TempDir(), "anchor.json"), Key: []byte("secret")}
+	service := NewTerminalAuditService(repo, cfg)
+	for i := range 5 {
+		recordAudit(t, service, fmt.Sprintf("echo %d", i))
+	}
+	result, err := service.Verify(nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, uint64(5), result.AnchorSeq) // from the file
+	anchor := *result.Anchor
+	assert.Equal(t, repo.entries[4].Hash, anchor.Hash)
+	assert.NotEmpty(t, anchor.Signature)
+
+	// the last entries removed, which the chain alone does not reveal
+	repo.entries = repo.entries[:3]
+	result, err = NewTerminalAuditService(repo, AuditAnchorConfig{}).Verify(nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Zero(t, result.AnchorSeq)
+
+	result, err = service.Verify(nil)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint64(4), result.BrokenAt)
+
+	// appending again does not hide the removal from a kept anchor
+	recordAudit(t, service, "echo 3 again")
+	recordAudit(t, service, "echo 4 again")
+	result, err = service.Verify(&anchor)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, uint64(5), result.BrokenAt)
+	assert.Equal(t, "hash does not match the anchor", result.Reason)
+
+	forged := AuditAnchor{Seq: 5, Hash: repo.entries[4].Hash}
+	result, err = service.Verify(&forged)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, "anchor signature does not match", result.Reason)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	models "back/internal/domain"
+	"back/internal/repositories"
+)
+
+const (
+	// TerminalHistoryDefaultLimit and TerminalHistoryMaxLimit are the
+	// default and maximum number of records returned at once.
+	TerminalHistoryDefaultLimit = 50
+	TerminalHistoryMaxLimit     = 500
+	// terminalHistoryMaxOutput bounds the output and error kept per command,
+	// in bytes: only their end is stored beyond.
+	terminalHistoryMaxOutput = 64 * 1024
+)
+
+type TerminalHistoryService interface {
+	Record(record *models.TerminalCommandRecord) error
+	List(filter repositories.TerminalHistoryFilter) ([]models.TerminalCommandRecord, int64, error)
+}
+
+type terminalHistoryService struct {
+	repo repositories.TerminalHistoryRepository
+}
+
+func NewTerminalHistoryService(repo repositories.TerminalHistoryRepository) TerminalHistoryService {
+	return &terminalHistoryService{repo: repo}
+}
+
+func (s *terminalHistoryService) Record(record *models.TerminalCommandRecord) error {
+	record.Command = storableText(record.Command)
+	record.Output = keepEnd(storableText(record.Output), terminalHistoryMaxOutput)
+	record.Error = keepEnd(storableText(record.Error), terminalHistoryMaxOutput)
+	return s.repo.Create(record)
+}
+
+// List clamps the limit to 1..TerminalHistoryMaxLimit.
+func (s *terminalHistoryService) List(filter repositories.TerminalHistoryFilter) ([]models.TerminalCommandRecord, int64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = TerminalHistoryDefaultLimit
+	}
+	filter.Limit = min(filter.Limit, TerminalHistoryMaxLimit)
+	filter.Offset = max(filter.Offset, 0)
+	return s.repo.Find(filter)
+}
+
+// storableText makes command output, which may be binary, fit a Postgres
+// text column: valid UTF-8 without NUL bytes.
+func storableText(s string) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(s, "\uFFFD"), "\x00", "")
+}
+
+// keepEnd returns the last limit bytes of s, from a line start when there
+// is one close to the cut, and marks the cut.
+func keepEnd(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	end := s[len(s)-limit:]
+	if i := strings.IndexByte(end[:min(len(end), 1024)], '\n'); i >= 0 {
+		end = end[i+1:]
+	}
+	for len(end) > 0 && !utf8.RuneStart(end[0]) {
+		end = end[1:]
+	}
+	return "[...]\n" + end
+}
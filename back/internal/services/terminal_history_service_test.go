@@ -0,0 +1,64 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	models "back/internal/domain"
+	"back/internal/repositories"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTerminalHistoryRepo struct {
+	records []models.TerminalCommandRecord
+	filter  repositories.TerminalHistoryFilter
+}
+
+func (m *mockTerminalHistoryRepo) Create(record *models.TerminalCommandRecord) error {
+	m.records = append(m.records, *record)
+	return nil
+}
+func (m *mockTerminalHistoryRepo) Find(filter repositories.TerminalHistoryFilter) ([]models.TerminalCommandRecord, int64, error) {
+	m.filter = filter
+	return m.records, int64(len(m.records)), nil
+}
+
+func TestTerminalHistoryRecordStorableOutput(t *testing.T) {
+	repo := &mockTerminalHistoryRepo{}
+	service := NewTerminalHistoryService(repo)
+
+	long := strings.Repeat("é", terminalHistoryMaxOutput) // 2 bytes each
+	require.NoError(t, service.Record(&models.TerminalCommandRecord{
+		UserID:  "alice",
+		Command: "cat /bin/sh",
+		Output:  "ELF\x00\x01\xff\xfe",
+		Error:   "first line\n" + long,
+	}))
+	record := repo.records[0]
+	assert.Equal(t, "ELF\x01�", record.Output)
+	assert.True(t, utf8.ValidString(record.Error))
+	assert.True(t, strings.HasPrefix(record.Error, "[...]\né"))
+	assert.LessOrEqual(t, len(record.Error), terminalHistoryMaxOutput+len("[...]\n"))
+	assert.NotContains(t, record.Error, "first line")
+
+	short := "line 1\nline 2\n"
+	assert.Equal(t, short, keepEnd(short, 100))
+	assert.Equal(t, "[...]\nline 2\n", keepEnd(short, 10))
+}
+
+func TestTerminalHistoryListLimits(t *testing.T) {
+	repo := &mockTerminalHistoryRepo{}
+	service := NewTerminalHistoryService(repo)
+
+	_, _, err := service.List(repositories.TerminalHistoryFilter{UserID: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, repositories.TerminalHistoryFilter{UserID: "alice", Limit: TerminalHistoryDefaultLimit}, repo.filter)
+
+	_, _, err = service.List(repositories.TerminalHistoryFilter{Limit: 10000, Offset: -5})
+	require.NoError(t, err)
+	assert.Equal(t, TerminalHistoryMaxLimit, repo.filter.Limit)
+	assert.Equal(t, 0, repo.filter.Offset)
+}
@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	models "back/internal/domain"
+)
+
+// GraphiteConfig points at a carbon plaintext listener.
+type GraphiteConfig struct {
+	Addr   string // host:port, usually port 2003
+	Prefix string // prepended to the metric paths
+}
+
+// GraphiteConfigFromEnv reads GRAPHITE_ADDR and GRAPHITE_PREFIX
+// ("monitoverse" by default). ok is false when no address is set.
+func GraphiteConfigFromEnv() (GraphiteConfig, bool) {
+	cfg := GraphiteConfig{Addr: os.Getenv("GRAPHITE_ADDR"), Prefix: os.Getenv("GRAPHITE_PREFIX")}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "monitoverse"
+	}
+	return cfg, cfg.Addr != ""
+}
+
+// Graphite sends the samples over a TCP connection kept between batches,
+// as "<prefix>.<host>.<metric> <value> <timestamp>" lines. The plaintext
+// protocol has second timestamps: carbon keeps one point per second and
+// path, the last sample of a host within a second replacing the others.
+type Graphite struct {
+	cfg GraphiteConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewGraphite(cfg GraphiteConfig) *Graphite {
+	return &Graphite{cfg: cfg}
+}
+
+func (g *Graphite) Name() string {
+	return "graphite"
+}
+
+func (g *Graphite) Send(ctx context.Context, batch []models.MonitoringData) error {
+	var body bytes.Buffer
+	for _, data := range batch {
+		g.writeLines(&body, data)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		var dialer net.Dialer
+		dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		conn, err := dialer.DialContext(dialCtx, "tcp", g.cfg.Addr)
+		cancel()
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+	_ = g.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := g.conn.Write(body.Bytes()); err != nil {
+		// reconnect on the next attempt, the batch is sent again whole
+		_ = g.conn.Close()
+		g.conn = nil
+		return err
+	}
+	return nil
+}
+
+// graphitePathEscaper keeps a host name as a single node of the metric path.
+var graphitePathEscaper = strings.NewReplacer(".", "_", " ", "_")
+
+func (g *Graphite) writeLines(buf *bytes.Buffer, data models.MonitoringData) {
+	path := graphitePathEscaper.Replace(data.Host) + "."
+	if g.cfg.Prefix != "" {
+		path = g.cfg.Prefix + "." + path
+	}
+	for _, metric := range []struct {
+		name  string
+		value float64
+	}{
+		{"cpu", data.CPU},
+		{"memory", data.Memory},
+		{"disk_root", data.DiskRoot},
+		{"disk_home", data.DiskHome},
+	} {
+		fmt.Fprintf(buf, "%s%s %s %d\n", path, metric.name, formatFloat(metric.value), data.Timestamp)
+	}
+}
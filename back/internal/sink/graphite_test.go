@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphitePlaintext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	lines := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	graphite := NewGraphite(GraphiteConfig{Addr: ln.Addr().String(), Prefix: "mv"})
+	data := models.MonitoringData{Host: "web.eu", Timestamp: 1700000000, CPU: 12.5, Memory: 40, DiskRoot: 70.25, DiskHome: 10}
+	require.NoError(t, graphite.Send(context.Background(), []models.MonitoringData{data}))
+
+	var got []string
+	for range 4 {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-time.After(2 * time.Second):
+			t.Fatal("missing graphite lines")
+		}
+	}
+	assert.Equal(t, []string{
+		"mv.web_eu.cpu 12.5 1700000000",
+		"mv.web_eu.memory 40 1700000000",
+		"mv.web_eu.disk_root 70.25 1700000000",
+		"mv.web_eu.disk_home 10 1700000000",
+	}, got)
+}
+
+func TestGraphiteUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	graphite := NewGraphite(GraphiteConfig{Addr: addr})
+	err = graphite.Send(context.Background(), []models.MonitoringData{{Host: "web-1"}})
+	require.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
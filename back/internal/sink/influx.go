@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	models "back/internal/domain"
+)
+
+// InfluxConfig points at an InfluxDB write endpoint, e.g.
+// http://influx:8086/api/v2/write?org=ops&bucket=monitoverse or
+// http://influx:8086/write?db=monitoverse for InfluxDB 1.x.
+type InfluxConfig struct {
+	URL   string
+	Token string // sent as "Authorization: Token ..." when set
+}
+
+// InfluxConfigFromEnv reads INFLUX_URL and INFLUX_TOKEN. ok is false when
+// no URL is set.
+func InfluxConfigFromEnv() (InfluxConfig, bool) {
+	cfg := InfluxConfig{URL: os.Getenv("INFLUX_URL"), Token: os.Getenv("INFLUX_TOKEN")}
+	return cfg, cfg.URL != ""
+}
+
+// Influx sends the samples as line protocol, one "monitoverse" point per
+// sample tagged with its host, timestamped to the millisecond so that the
+// samples of a host within a second do not overwrite each other.
+type Influx struct {
+	cfg    InfluxConfig
+	url    string // cfg.URL with precision=ms
+	client *http.Client
+}
+
+func NewInflux(cfg InfluxConfig) *Influx {
+	writeURL := cfg.URL
+	if u, err := url.Parse(cfg.URL); err == nil {
+		query := u.Query()
+		query.Set("precision", "ms")
+		u.RawQuery = query.Encode()
+		writeURL = u.String()
+	}
+	return &Influx{cfg: cfg, url: writeURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (i *Influx) Name() string {
+	return "influx"
+}
+
+func (i *Influx) Send(ctx context.Context, batch []models.MonitoringData) error {
+	var body bytes.Buffer
+	for _, data := range batch {
+		writeLineProtocol(&body, data)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, &body)
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.cfg.Token)
+	}
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("influx write failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func writeLineProtocol(buf *bytes.Buffer, data models.MonitoringData) {
+	fmt.Fprintf(buf, "monitoverse,host=%s cpu=%s,memory=%s,disk_root=%s,disk_home=%s %d\n",
+		influxTagEscaper.Replace(data.Host),
+		formatFloat(data.CPU), formatFloat(data.Memory), formatFloat(data.DiskRoot), formatFloat(data.DiskHome),
+		timestampMS(data))
+}
+
+// timestampMS is the timestamp of data in milliseconds, from the seconds of
+// the samples that have no TimestampMS.
+func timestampMS(data models.MonitoringData) int64 {
+	if data.TimestampMS == 0 {
+		return data.Timestamp * 1000
+	}
+	return data.TimestampMS
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfluxLineProtocol(t *testing.T) {
+	var body, auth, precision string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body, auth, precision = string(b), r.Header.Get("Authorization"), r.URL.Query().Get("precision")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	influx := NewInflux(InfluxConfig{URL: server.URL + "/write?db=monitoverse&precision=s", Token: "secret"})
+	err := influx.Send(context.Background(), []models.MonitoringData{
+		{Host: "web 1,eu", Timestamp: 1700000000, CPU: 12.5, Memory: 40, DiskRoot: 70.25, DiskHome: 10},
+		{Host: "db", Timestamp: 1700000001, CPU: 1},
+		{Host: "db", Timestamp: 1700000001, TimestampMS: 1700000001250, CPU: 2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Token secret", auth)
+	assert.Equal(t, "ms", precision)
+	assert.Equal(t,
+		`monitoverse,host=web\ 1\,eu cpu=12.5,memory=40,disk_root=70.25,disk_home=10 1700000000000`+"\n"+
+			"monitoverse,host=db cpu=1,memory=0,disk_root=0,disk_home=0 1700000001000\n"+
+			"monitoverse,host=db cpu=2,memory=0,disk_root=0,disk_home=0 1700000001250\n",
+		body)
+}
+
+func TestInfluxErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	influx := NewInflux(InfluxConfig{URL: server.URL})
+	batch := []models.MonitoringData{{Host: "web-1"}}
+
+	err := influx.Send(context.Background(), batch)
+	assert.True(t, IsPermanent(err))
+
+	status = http.StatusServiceUnavailable
+	err = influx.Send(context.Background(), batch)
+	require.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
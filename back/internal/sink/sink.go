@@ -0,0 +1,200 @@
+// Package sink forwards the recorded samples to external systems. Samples
+// are queued in memory and sent in batches; when the destination is down
+// they are kept, up to a bound, and sent again on the next flush. A batch
+// that keeps failing, or that the destination rejects, is dead-lettered:
+// dropped and counted.
+package sink
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	models "back/internal/domain"
+)
+
+// Sender delivers a batch of samples to one destination.
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, batch []models.MonitoringData) error
+}
+
+// permanentError marks a batch the destination will never accept.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps the error of a Send that must not be retried, like a
+// rejected payload.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	return errors.As(err, &permanentError{})
+}
+
+type Config struct {
+	Interval   time.Duration // time between two flushes
+	BatchSize  int           // samples per Send
+	MaxPending int           // samples kept while the destination fails, the oldest are dropped beyond
+	MaxRetries int           // failed attempts before a batch is dead-lettered
+}
+
+// ConfigFromEnv reads the settings shared by the output sinks:
+// SINK_INTERVAL_MS, SINK_BATCH_SIZE, SINK_MAX_PENDING and SINK_MAX_RETRIES.
+func ConfigFromEnv() Config {
+	var cfg Config
+	if ms, err := strconv.Atoi(os.Getenv("SINK_INTERVAL_MS")); err == nil && ms > 0 {
+		cfg.Interval = time.Duration(ms) * time.Millisecond
+	}
+	cfg.BatchSize, _ = strconv.Atoi(os.Getenv("SINK_BATCH_SIZE"))
+	cfg.MaxPending, _ = strconv.Atoi(os.Getenv("SINK_MAX_PENDING"))
+	cfg.MaxRetries, _ = strconv.Atoi(os.Getenv("SINK_MAX_RETRIES"))
+	return cfg.withDefaults()
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 500
+	}
+	if c.MaxPending <= 0 {
+		c.MaxPending = 100000
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 5
+	}
+	return c
+}
+
+// Stats counts the samples going through a Batcher.
+type Stats struct {
+	Name        string `json:"name"`
+	Pending     int    `json:"pending"`
+	Sent        int64  `json:"sent"`
+	Dropped     int64  `json:"dropped"`      // pushed out of a full queue
+	DeadLetters int64  `json:"dead_letters"` // rejected or out of retries
+	Errors      int64  `json:"errors"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+type Batcher struct {
+	cfg    Config
+	sender Sender
+
+	mu      sync.Mutex
+	pending []models.MonitoringData
+	first   int64 // sequence number of pending[0]
+	retries int   // failed attempts of the batch at the head
+	stats   Stats
+}
+
+func NewBatcher(sender Sender, cfg Config) *Batcher {
+	return &Batcher{cfg: cfg.withDefaults(), sender: sender, stats: Stats{Name: sender.Name()}}
+}
+
+// Record queues a sample. It never blocks on the destination.
+func (b *Batcher) Record(data models.MonitoringData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, data)
+	if over := len(b.pending) - b.cfg.MaxPending; over > 0 {
+		b.pending = b.pending[over:]
+		b.first += int64(over)
+		b.stats.Dropped += int64(over)
+	}
+}
+
+func (b *Batcher) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.stats
+	stats.Pending = len(b.pending)
+	return stats
+}
+
+// Flush sends the pending samples in batches. It stops at the first
+// failing batch, which stays pending with the ones after it until it is
+// dead-lettered.
+func (b *Batcher) Flush(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		n := min(len(b.pending), b.cfg.BatchSize)
+		batch := make([]models.MonitoringData, n)
+		copy(batch, b.pending)
+		start := b.first
+		b.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		err := b.sender.Send(ctx, batch)
+
+		b.mu.Lock()
+		if err != nil {
+			b.stats.Errors++
+			b.stats.LastError = err.Error()
+			b.retries++
+			permanent := IsPermanent(err)
+			if !permanent && b.retries < b.cfg.MaxRetries {
+				b.mu.Unlock()
+				return err
+			}
+			b.stats.DeadLetters += b.ack(start, n)
+			b.retries = 0
+			b.mu.Unlock()
+			log.Printf("sink %s: %d samples dead-lettered: %v", b.sender.Name(), n, err)
+			if !permanent {
+				return err
+			}
+			continue
+		}
+		b.stats.Sent += int64(n)
+		b.ack(start, n)
+		b.retries = 0
+		b.mu.Unlock()
+	}
+}
+
+// ack removes the n samples from sequence number start, some of which may
+// have been dropped from the head meanwhile, and returns how many it removed.
+func (b *Batcher) ack(start int64, n int) int64 {
+	acked := start + int64(n) - b.first
+	if acked <= 0 {
+		return 0
+	}
+	b.pending = b.pending[acked:]
+	b.first += acked
+	return acked
+}
+
+// Run flushes every interval until ctx is done, then flushes one last time.
+func (b *Batcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(ctx); err != nil {
+				log.Printf("sink %s: %v", b.sender.Name(), err)
+			}
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := b.Flush(final); err != nil {
+				log.Printf("sink %s: %v", b.sender.Name(), err)
+			}
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	models "back/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSender struct {
+	batches [][]int64
+	fail    bool
+	onSend  func()
+}
+
+func (f *fakeSender) Name() string { return "fake" }
+
+func (f *fakeSender) Send(ctx context.Context, batch []models.MonitoringData) error {
+	if f.onSend != nil {
+		f.onSend()
+	}
+	if f.fail {
+		return errors.New("unreachable")
+	}
+	var ts []int64
+	for _, data := range batch {
+		ts = append(ts, data.Timestamp)
+	}
+	f.batches = append(f.batches, ts)
+	return nil
+}
+
+func record(b *Batcher, from, to int64) {
+	for ts := from; ts <= to; ts++ {
+		b.Record(models.MonitoringData{Timestamp: ts})
+	}
+}
+
+func TestBatcherSendsInBatches(t *testing.T) {
+	sender := &fakeSender{}
+	b := NewBatcher(sender, Config{BatchSize: 2})
+	record(b, 1, 5)
+	require.NoError(t, b.Flush(context.Background()))
+	assert.Equal(t, [][]int64{{1, 2}, {3, 4}, {5}}, sender.batches)
+	assert.Equal(t, Stats{Name: "fake", Sent: 5}, b.Stats())
+}
+
+func TestBatcherKeepsSamplesOnFailure(t *testing.T) {
+	sender := &fakeSender{fail: true}
+	b := NewBatcher(sender, Config{BatchSize: 2, MaxPending: 3})
+	record(b, 1, 2)
+	assert.Error(t, b.Flush(context.Background()))
+	record(b, 3, 4)
+
+	stats := b.Stats()
+	assert.Equal(t, 3, stats.Pending)
+	assert.Equal(t, int64(1), stats.Dropped)
+	assert.Equal(t, int64(1), stats.Errors)
+
+	sender.fail = false
+	require.NoError(t, b.Flush(context.Background()))
+	assert.Equal(t, [][]int64{{2, 3}, {4}}, sender.batches)
+}
+
+func TestBatcherDropsWhileSending(t *testing.T) {
+	sender := &fakeSender{}
+	b := NewBatcher(sender, Config{BatchSize: 2, MaxPending: 3})
+	record(b, 1, 3)
+	// samples 1 and 2 are being sent while 4 and 5 push them out of the queue
+	sender.onSend = func() {
+		sender.onSend = nil
+		record(b, 4, 5)
+	}
+	require.NoError(t, b.Flush(context.Background()))
+	assert.Equal(t, [][]int64{{1, 2}, {3, 4}, {5}}, sender.batches)
+	assert.Zero(t, b.Stats().Pending)
+}
+
+type errorSender struct {
+	err   error
+	calls int
+}
+
+func (e *errorSender) Name() string { return "error" }
+
+func (e *errorSender) Send(ctx context.Context, batch []models.MonitoringData) error {
+	e.calls++
+	return e.err
+}
+
+func TestBatcherDeadLettersAfterMaxRetries(t *testing.T) {
+	sender := &errorSender{err: errors.New("unreachable")}
+	b := NewBatcher(sender, Config{BatchSize: 2, MaxRetries: 3})
+	record(b, 1, 3)
+	for range 3 {
+		assert.Error(t, b.Flush(context.Background()))
+	}
+
+	stats := b.Stats()
+	assert.Equal(t, int64(2), stats.DeadLetters)
+	assert.Equal(t, 1, stats.Pending)
+	assert.Equal(t, int64(3), stats.Errors)
+	assert.Equal(t, "unreachable", stats.LastError)
+}
+
+func TestBatcherDeadLettersPermanentErrors(t *testing.T) {
+	sender := &errorSender{err: Permanent(errors.New("bad request"))}
+	b := NewBatcher(sender, Config{BatchSize: 2})
+	record(b, 1, 3)
+	require.NoError(t, b.Flush(context.Background()))
+
+	assert.Equal(t, 2, sender.calls)
+	stats := b.Stats()
+	assert.Equal(t, int64(3), stats.DeadLetters)
+	assert.Zero(t, stats.Pending)
+	assert.Zero(t, stats.Sent)
+}
@@ -0,0 +1,184 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"back/internal/series"
+)
+
+// Percentiles reported for timers, histograms and distributions.
+var Percentiles = []float64{50, 90, 95, 99}
+
+const (
+	DefaultGaugeTTL   = 30    // flushes without update before a gauge is forgotten
+	DefaultMaxEntries = 10000 // metrics aggregated at once
+)
+
+type entry struct {
+	kind   Type // Counter, Gauge, Timer or Set
+	name   string
+	host   string
+	labels map[string]string
+
+	updated bool
+	idle    int     // flushes since the last update, for gauges
+	count   float64 // counters, and samples of timers scaled by their rate
+	gauge   float64
+	values  []float64
+	members map[string]struct{}
+}
+
+// Aggregator accumulates the metrics of a flush interval. The "host" tag
+// sets the host of a metric, the other tags become its labels.
+//
+// Gauges are kept across flushes for their deltas until they go gaugeTTL
+// flushes without an update, and at most maxEntries metrics are aggregated
+// at once: the new ones are dropped beyond.
+type Aggregator struct {
+	defaultHost string
+	gaugeTTL    int
+	maxEntries  int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// NewAggregator uses DefaultGaugeTTL and DefaultMaxEntries for the zero
+// values.
+func NewAggregator(defaultHost string, gaugeTTL, maxEntries int) *Aggregator {
+	if gaugeTTL <= 0 {
+		gaugeTTL = DefaultGaugeTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &Aggregator{defaultHost: defaultHost, gaugeTTL: gaugeTTL, maxEntries: maxEntries, entries: map[string]*entry{}}
+}
+
+// Add aggregates m. It returns false when m is a new metric and the
+// aggregator already holds maxEntries.
+func (a *Aggregator) Add(m Metric) bool {
+	host := a.defaultHost
+	labels := map[string]string{}
+	for k, v := range m.Tags {
+		if k == "host" {
+			host = v
+			continue
+		}
+		labels[k] = v
+	}
+	kind := m.Type
+	if kind == Histogram || kind == Distribution {
+		kind = Timer
+	}
+	key := string(kind) + "\x00" + series.Key(m.Name, host, labels)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.entries[key]
+	if !ok {
+		if len(a.entries) >= a.maxEntries {
+			return false
+		}
+		e = &entry{kind: kind, name: m.Name, host: host, labels: labels}
+		a.entries[key] = e
+	}
+	e.updated = true
+	e.idle = 0
+	switch kind {
+	case Counter:
+		e.count += m.Value / m.Rate
+	case Gauge:
+		if m.Delta {
+			e.gauge += m.Value
+		} else {
+			e.gauge = m.Value
+		}
+	case Timer:
+		e.count += 1 / m.Rate
+		e.values = append(e.values, m.Value)
+	case Set:
+		if e.members == nil {
+			e.members = map[string]struct{}{}
+		}
+		e.members[m.Raw] = struct{}{}
+	}
+	return true
+}
+
+// Flush returns the aggregates of the metrics updated since the last flush
+// and resets them, gauges keeping their value for the next deltas until
+// they expire:
+//
+//   - counters: <name> (count over the interval) and <name>.rate (per second)
+//   - gauges: <name>, the last value
+//   - timers, histograms and distributions: <name>.count, .sum, .min, .max,
+//     .mean and .p50, .p90, .p95, .p99
+//   - sets: <name>, the number of unique members
+func (a *Aggregator) Flush(now time.Time, interval time.Duration) []series.Sample {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ts := now.Unix()
+	keys := make([]string, 0, len(a.entries))
+	for key := range a.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var samples []series.Sample
+	for _, key := range keys {
+		e := a.entries[key]
+		if !e.updated {
+			if e.idle++; e.idle >= a.gaugeTTL {
+				delete(a.entries, key)
+			}
+			continue
+		}
+		emit := func(name string, value float64) {
+			samples = append(samples, series.Sample{Metric: name, Host: e.host, Labels: e.labels, Timestamp: ts, Value: value})
+		}
+		switch e.kind {
+		case Counter:
+			emit(e.name, e.count)
+			emit(e.name+".rate", e.count/interval.Seconds())
+			delete(a.entries, key)
+		case Gauge:
+			emit(e.name, e.gauge)
+			e.updated = false
+		case Timer:
+			sort.Float64s(e.values)
+			sum := 0.0
+			for _, v := range e.values {
+				sum += v
+			}
+			emit(e.name+".count", e.count)
+			emit(e.name+".sum", sum)
+			emit(e.name+".min", e.values[0])
+			emit(e.name+".max", e.values[len(e.values)-1])
+			emit(e.name+".mean", sum/float64(len(e.values)))
+			for _, p := range Percentiles {
+				emit(e.name+".p"+formatPercentile(p), percentile(e.values, p))
+			}
+			delete(a.entries, key)
+		case Set:
+			emit(e.name, float64(len(e.members)))
+			delete(a.entries, key)
+		}
+	}
+	return samples
+}
+
+// percentile uses the nearest-rank method on sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func formatPercentile(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
@@ -0,0 +1,102 @@
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	"back/internal/series"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func add(t *testing.T, a *Aggregator, packet string) {
+	metrics, err := Parse([]byte(packet))
+	require.NoError(t, err)
+	for _, m := range metrics {
+		a.Add(m)
+	}
+}
+
+func values(samples []series.Sample) map[string]float64 {
+	result := map[string]float64{}
+	for _, s := range samples {
+		result[s.Metric] = s.Value
+	}
+	return result
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	a := NewAggregator("local", 0, 0)
+	add(t, a, "hits:1|c\nhits:2|c|@0.5\nqueue:10|g\nqueue:+5|g\nusers:a|s\nusers:b|s\nusers:a|s")
+	for i := 1; i <= 10; i++ {
+		a.Add(Metric{Name: "latency", Type: Timer, Value: float64(i * 10), Rate: 1})
+	}
+
+	now := time.Unix(1700000000, 0)
+	samples := a.Flush(now, 10*time.Second)
+	got := values(samples)
+	assert.Equal(t, 5.0, got["hits"])
+	assert.Equal(t, 0.5, got["hits.rate"])
+	assert.Equal(t, 15.0, got["queue"])
+	assert.Equal(t, 2.0, got["users"])
+	assert.Equal(t, 10.0, got["latency.count"])
+	assert.Equal(t, 10.0, got["latency.min"])
+	assert.Equal(t, 100.0, got["latency.max"])
+	assert.Equal(t, 55.0, got["latency.mean"])
+	assert.Equal(t, 50.0, got["latency.p50"])
+	assert.Equal(t, 100.0, got["latency.p99"])
+	for _, s := range samples {
+		assert.Equal(t, "local", s.Host)
+		assert.Equal(t, now.Unix(), s.Timestamp)
+	}
+
+	// nothing new: nothing flushed, but gauges keep their value for deltas
+	assert.Empty(t, a.Flush(now, 10*time.Second))
+	add(t, a, "queue:-3|g")
+	assert.Equal(t, map[string]float64{"queue": 12}, values(a.Flush(now, 10*time.Second)))
+}
+
+func TestAggregatorTags(t *testing.T) {
+	a := NewAggregator("local", 0, 0)
+	add(t, a, "hits:1|c|#host:web-1,route:/a\nhits:1|c|#route:/b\nhits:4|c|#route:/a,host:web-1")
+	samples := a.Flush(time.Unix(0, 0), time.Second)
+
+	var counts []series.Sample
+	for _, s := range samples {
+		if s.Metric == "hits" {
+			counts = append(counts, s)
+		}
+	}
+	require.Len(t, counts, 2)
+	assert.Equal(t, series.Sample{Metric: "hits", Host: "local", Labels: map[string]string{"route": "/b"}, Value: 1}, counts[0])
+	assert.Equal(t, series.Sample{Metric: "hits", Host: "web-1", Labels: map[string]string{"route": "/a"}, Value: 5}, counts[1])
+}
+
+func TestAggregatorForgetsIdleGauges(t *testing.T) {
+	a := NewAggregator("local", 2, 0)
+	add(t, a, "queue:10|g")
+	require.Len(t, a.Flush(time.Unix(0, 0), time.Second), 1)
+
+	assert.Empty(t, a.Flush(time.Unix(1, 0), time.Second))
+	add(t, a, "queue:+1|g") // an update resets the idle count
+	assert.Equal(t, map[string]float64{"queue": 11}, values(a.Flush(time.Unix(2, 0), time.Second)))
+
+	assert.Empty(t, a.Flush(time.Unix(3, 0), time.Second))
+	assert.Empty(t, a.Flush(time.Unix(4, 0), time.Second))
+	// forgotten: the delta starts from zero
+	add(t, a, "queue:+1|g")
+	assert.Equal(t, map[string]float64{"queue": 1}, values(a.Flush(time.Unix(5, 0), time.Second)))
+}
+
+func TestAggregatorMaxEntries(t *testing.T) {
+	a := NewAggregator("local", 0, 2)
+	assert.True(t, a.Add(Metric{Name: "a", Type: Gauge, Value: 1, Rate: 1}))
+	assert.True(t, a.Add(Metric{Name: "b", Type: Counter, Value: 1, Rate: 1}))
+	assert.False(t, a.Add(Metric{Name: "c", Type: Gauge, Value: 1, Rate: 1}))
+	assert.True(t, a.Add(Metric{Name: "a", Type: Gauge, Value: 2, Rate: 1}), "known metrics are still aggregated")
+
+	assert.Equal(t, map[string]float64{"a": 2, "b": 1, "b.rate": 1}, values(a.Flush(time.Unix(0, 0), time.Second)))
+	// the counter was flushed, which leaves room for a new metric
+	assert.True(t, a.Add(Metric{Name: "c", Type: Gauge, Value: 1, Rate: 1}))
+}
@@ -0,0 +1,137 @@
+// Package statsd receives application metrics over UDP in the StatsD
+// protocol, with the DogStatsD extensions (tags, distributions, multiple
+// values), and aggregates them per flush interval into series samples.
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Type string
+
+const (
+	Counter      Type = "c"
+	Gauge        Type = "g"
+	Timer        Type = "ms"
+	Histogram    Type = "h"
+	Distribution Type = "d"
+	Set          Type = "s"
+)
+
+// Metric is one parsed value.
+type Metric struct {
+	Name  string
+	Type  Type
+	Value float64 // unused by sets
+	Raw   string  // the member of a set
+	Delta bool    // a gauge value starting with + or -
+	Rate  float64 // sample rate, 1 when not sampled
+	Tags  map[string]string
+}
+
+// ParseError tells how many lines of a packet were invalid, and why the
+// last one was.
+type ParseError struct {
+	Lines int
+	Last  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Lines == 1 {
+		return e.Last.Error()
+	}
+	return fmt.Sprintf("%d invalid lines, last: %v", e.Lines, e.Last)
+}
+
+func (e *ParseError) Unwrap() error { return e.Last }
+
+// Parse decodes a packet, one metric per line. Events and service checks
+// are skipped. It returns the metrics of the valid lines and a *ParseError
+// when some lines are invalid.
+func Parse(packet []byte) ([]Metric, error) {
+	var metrics []Metric
+	var invalid *ParseError
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+			continue
+		}
+		parsed, err := ParseLine(line)
+		if err != nil {
+			if invalid == nil {
+				invalid = &ParseError{}
+			}
+			invalid.Lines++
+			invalid.Last = err
+			continue
+		}
+		metrics = append(metrics, parsed...)
+	}
+	if invalid != nil {
+		return metrics, invalid
+	}
+	return metrics, nil
+}
+
+// ParseLine decodes "name:value[:value...]|type[|@rate][|#tag:v,tag]".
+// Unknown DogStatsD fields like container IDs are ignored.
+func ParseLine(line string) ([]Metric, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("invalid statsd line %q: missing name", line)
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid statsd line %q: missing type", line)
+	}
+
+	m := Metric{Name: name, Type: Type(fields[1]), Rate: 1}
+	switch m.Type {
+	case Counter, Gauge, Timer, Histogram, Distribution, Set:
+	default:
+		return nil, fmt.Errorf("invalid statsd line %q: unknown type %q", line, fields[1])
+	}
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid statsd line %q: bad sample rate", line)
+			}
+			m.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			m.Tags = parseTags(field[1:])
+		}
+	}
+
+	if m.Type == Set {
+		m.Raw = fields[0]
+		return []Metric{m}, nil
+	}
+	var metrics []Metric
+	for _, raw := range strings.Split(fields[0], ":") {
+		v := m
+		v.Delta = m.Type == Gauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-"))
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statsd line %q: bad value %q", line, raw)
+		}
+		v.Value = value
+		metrics = append(metrics, v)
+	}
+	return metrics, nil
+}
+
+func parseTags(s string) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(tag, ":")
+		tags[name] = value
+	}
+	return tags
+}
@@ -0,0 +1,52 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	metrics, err := ParseLine("api.requests:3|c|@0.5|#env:prod,canary")
+	require.NoError(t, err)
+	assert.Equal(t, []Metric{{
+		Name: "api.requests", Type: Counter, Value: 3, Rate: 0.5,
+		Tags: map[string]string{"env": "prod", "canary": ""},
+	}}, metrics)
+
+	metrics, err = ParseLine("queue.size:-2|g")
+	require.NoError(t, err)
+	assert.True(t, metrics[0].Delta)
+	assert.Equal(t, -2.0, metrics[0].Value)
+
+	metrics, err = ParseLine("users:alice|s")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", metrics[0].Raw)
+
+	// DogStatsD multiple values and container field
+	metrics, err = ParseLine("api.latency:12:30.5|d|#route:/a|c:abc123")
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, 30.5, metrics[1].Value)
+	assert.Equal(t, Distribution, metrics[1].Type)
+}
+
+func TestParseLineErrors(t *testing.T) {
+	for _, line := range []string{"nocolon", ":1|c", "a:1", "a:1|x", "a:abc|c", "a:1|c|@2"} {
+		_, err := ParseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	packet := "a:1|c\n_e{5,4}:title|text\nbroken\n_sc|check|0\nb:2|ms\nc:x|g\n"
+	metrics, err := Parse([]byte(packet))
+	var invalid *ParseError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, 2, invalid.Lines)
+	assert.Contains(t, invalid.Last.Error(), `"c:x|g"`)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "a", metrics[0].Name)
+	assert.Equal(t, "b", metrics[1].Name)
+}
@@ -0,0 +1,121 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"back/internal/series"
+)
+
+type Config struct {
+	Addr          string // UDP address, usually ":8125"
+	FlushInterval time.Duration
+	DefaultHost   string // host of the metrics without a "host" tag
+	GaugeTTL      int    // flushes without update before a gauge is forgotten
+	MaxEntries    int    // metrics aggregated at once
+}
+
+// ConfigFromEnv reads STATSD_ADDR, STATSD_FLUSH_INTERVAL_MS (10s by
+// default), STATSD_GAUGE_TTL (in flushes) and STATSD_MAX_ENTRIES. ok is
+// false when no address is set.
+func ConfigFromEnv() (cfg Config, ok bool) {
+	cfg.Addr = os.Getenv("STATSD_ADDR")
+	cfg.FlushInterval = 10 * time.Second
+	if ms, err := strconv.Atoi(os.Getenv("STATSD_FLUSH_INTERVAL_MS")); err == nil && ms > 0 {
+		cfg.FlushInterval = time.Duration(ms) * time.Millisecond
+	}
+	cfg.GaugeTTL, _ = strconv.Atoi(os.Getenv("STATSD_GAUGE_TTL"))
+	cfg.MaxEntries, _ = strconv.Atoi(os.Getenv("STATSD_MAX_ENTRIES"))
+	return cfg, cfg.Addr != ""
+}
+
+// Server reads StatsD packets and hands the aggregates to handler on each
+// flush.
+type Server struct {
+	cfg     Config
+	agg     *Aggregator
+	handler func([]series.Sample)
+
+	invalid atomic.Int64 // invalid lines since the last flush
+	dropped atomic.Int64 // metrics dropped since the last flush, MaxEntries being reached
+	lastErr atomic.Value
+}
+
+func NewServer(cfg Config, handler func([]series.Sample)) *Server {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 10 * time.Second
+	}
+	return &Server{cfg: cfg, agg: NewAggregator(cfg.DefaultHost, cfg.GaugeTTL, cfg.MaxEntries), handler: handler}
+}
+
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, conn)
+}
+
+// Serve reads packets from conn until ctx is done, then flushes one last
+// time and closes conn.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	go s.flushLoop(ctx)
+
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		metrics, err := Parse(buf[:n])
+		var invalid *ParseError
+		if errors.As(err, &invalid) {
+			s.invalid.Add(int64(invalid.Lines))
+			s.lastErr.Store(invalid.Last.Error())
+		}
+		for _, m := range metrics {
+			if !s.agg.Add(m) {
+				s.dropped.Add(1)
+			}
+		}
+	}
+}
+
+func (s *Server) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.flush(now)
+		case <-ctx.Done():
+			s.flush(time.Now())
+			return
+		}
+	}
+}
+
+func (s *Server) flush(now time.Time) {
+	if invalid := s.invalid.Swap(0); invalid > 0 {
+		log.Printf("statsd: %d invalid lines, last error: %v", invalid, s.lastErr.Load())
+	}
+	if dropped := s.dropped.Swap(0); dropped > 0 {
+		log.Printf("statsd: %d metrics dropped, more than %d at once", dropped, s.agg.maxEntries)
+	}
+	if samples := s.agg.Flush(now, s.cfg.FlushInterval); len(samples) > 0 {
+		s.handler(samples)
+	}
+}
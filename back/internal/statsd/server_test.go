@@ -0,0 +1,62 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"back/internal/series"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerReceivesPackets(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	flushed := make(chan []series.Sample, 10)
+	server := NewServer(Config{FlushInterval: 50 * time.Millisecond, DefaultHost: "local"}, func(samples []series.Sample) {
+		flushed <- samples
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- server.Serve(ctx, conn) }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	_, err = client.Write([]byte("jobs.done:2|c\njobs.done:3|c"))
+	require.NoError(t, err)
+
+	select {
+	case samples := <-flushed:
+		assert.Equal(t, 5.0, values(samples)["jobs.done"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("no flush")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestServerCountsInvalidLines(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := NewServer(Config{FlushInterval: time.Hour}, func([]series.Sample) {})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = server.Serve(ctx, conn) }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+	_, err = client.Write([]byte("broken\njobs.done:1|c\njobs.done:x|c"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return server.invalid.Load() == 2 }, 2*time.Second, 10*time.Millisecond)
+	assert.Contains(t, server.lastErr.Load(), "jobs.done:x|c")
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"back/internal/services"
 
+	"back/internal/agent"
+	"back/internal/collector"
+	domain "back/internal/domain"
+	"back/internal/logs"
+	"back/internal/otlp"
+	"back/internal/plugins"
 	"back/internal/repositories"
+	"back/internal/sink"
+	"back/internal/statsd"
 	"back/models"
 
 	database "back/database"
@@ -19,19 +30,47 @@ import (
 )
 
 func main() {
-	handlers.StartMonitoringBackground()
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		runAgent()
+		return
+	}
 
 	db, err := database.NewDB()
 	if err != nil {
 		log.Fatal("Failed to connect database: ", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &domain.Host{}, &domain.EnrollmentToken{}, &domain.TerminalCommandRecord{}, &domain.TerminalAuditEntry{}, &domain.Check{}, &domain.CheckResult{}, &domain.LogMetricRule{}, &domain.AlertRule{}); err != nil {
 		log.Fatal("Failed to migrate database: ", err)
 	}
+	if err := repositories.ProtectTerminalAudit(db); err != nil {
+		log.Fatal("Failed to protect the terminal audit log: ", err)
+	}
 
 	userRepo := repositories.NewUserRepository(db)
 	userService := services.NewUserService(userRepo)
+	hostRepo := repositories.NewHostRepository(db)
+	hostService := services.NewHostService(hostRepo)
+	terminalHistoryService := services.NewTerminalHistoryService(repositories.NewTerminalHistoryRepository(db))
+	terminalAuditService := services.NewTerminalAuditService(repositories.NewTerminalAuditRepository(db), services.AuditAnchorConfigFromEnv())
+	checkService := services.NewCheckService(repositories.NewCheckRepository(db))
+	logMetricService := services.NewLogMetricService(repositories.NewLogMetricRepository(db))
+	alertRuleService := services.NewAlertRuleService(repositories.NewAlertRuleRepository(db))
+
+	if err := handlers.StartAlertRules(alertRuleService); err != nil {
+		log.Println("Failed to restore alert rules:", err)
+	}
+	startSinks()
+	startStatsD()
+	startPlugins()
+	startLogTailing()
+	if err := handlers.StartLogMetrics(logMetricService); err != nil {
+		log.Println("Failed to restore log metrics:", err)
+	}
+	handlers.StartMonitoringBackground(hostService)
+	if err := handlers.StartChecks(checkService); err != nil {
+		log.Println("Failed to restore checks:", err)
+	}
 
 	frontendOrigin := os.Getenv("FRONTEND_ORIGIN")
 	if frontendOrigin == "" {
@@ -57,10 +96,96 @@ func main() {
 		AllowCredentials: true,
 	}))
 
-	routes.SetupRoutes(router, userService)
+	routes.SetupRoutes(router, userService, hostService, terminalHistoryService, terminalAuditService)
 
 	error := router.Run(":8081")
 	if error != nil {
 		log.Fatal("Failed to start server: ", error)
 	}
 }
+
+// runAgent runs the collectors only and pushes the samples to a central
+// Monitoverse server instead of serving the API.
+func runAgent() {
+	a, err := agent.New(agent.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Failed to start agent: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := a.Run(ctx); err != nil && err != context.Canceled {
+		log.Fatal("Agent stopped: ", err)
+	}
+}
+
+// startSinks forwards the samples to the external systems configured in the
+// environment.
+func startSinks() {
+	var senders []sink.Sender
+	cfg := sink.ConfigFromEnv()
+
+	otlpCfg, ok := otlp.ConfigFromEnv()
+	if ok {
+		senders = append(senders, otlp.NewExporter(otlpCfg))
+	}
+	if influxCfg, ok := sink.InfluxConfigFromEnv(); ok {
+		senders = append(senders, sink.NewInflux(influxCfg))
+	}
+	if graphiteCfg, ok := sink.GraphiteConfigFromEnv(); ok {
+		senders = append(senders, sink.NewGraphite(graphiteCfg))
+	}
+
+	for _, sender := range senders {
+		senderCfg := cfg
+		if sender.Name() == "otlp" && os.Getenv("SINK_INTERVAL_MS") == "" {
+			senderCfg.Interval = otlpCfg.Interval
+		}
+		batcher := sink.NewBatcher(sender, senderCfg)
+		handlers.AddMonitoringSink(batcher)
+		go batcher.Run(context.Background())
+		log.Println("Forwarding metrics to sink", sender.Name())
+	}
+}
+
+// startStatsD receives the application metrics when STATSD_ADDR is set.
+func startStatsD() {
+	cfg, ok := statsd.ConfigFromEnv()
+	if !ok {
+		return
+	}
+	cfg.DefaultHost = collector.Hostname()
+	server := statsd.NewServer(cfg, handlers.RecordSeries)
+	go func() {
+		if err := server.ListenAndServe(context.Background()); err != nil {
+			log.Fatal("StatsD listener failed: ", err)
+		}
+	}()
+	log.Println("Listening for StatsD metrics on", cfg.Addr)
+}
+
+// startPlugins runs the custom collectors listed in EXEC_PLUGINS_FILE.
+func startPlugins() {
+	path := os.Getenv("EXEC_PLUGINS_FILE")
+	if path == "" {
+		return
+	}
+	configs, err := plugins.LoadConfig(path)
+	if err != nil {
+		log.Fatal("Failed to load plugins: ", err)
+	}
+	plugins.Start(context.Background(), configs, collector.Hostname(), handlers.RecordSeries)
+	log.Printf("Running %d exec plugins", len(configs))
+}
+
+// startLogTailing tails the files of LOG_SOURCES.
+func startLogTailing() {
+	sources, err := logs.SourcesFromEnv()
+	if err != nil {
+		log.Fatal("Invalid LOG_SOURCES: ", err)
+	}
+	if len(sources) > 0 {
+		handlers.StartLogTailing(sources)
+	}
+}
@@ -28,8 +28,29 @@ interface TerminalMessage {
 	type: string;
 	command?: TerminalCommand;
 	history?: TerminalCommand[];
+	stream?: "stdout" | "stderr";
+	seq?: number;
 }
 
+// Partial frames carry only the new output chunk of the command.
+const appendChunk = (
+	current: TerminalCommand | null,
+	chunk: TerminalCommand
+): TerminalCommand => {
+	if (!current || current.id !== chunk.id) {
+		return {
+			...chunk,
+			output: chunk.output ?? "",
+			error: chunk.error ?? "",
+		};
+	}
+	return {
+		...current,
+		output: current.output + (chunk.output ?? ""),
+		error: current.error + (chunk.error ?? ""),
+	};
+};
+
 export const TerminalDashboard = () => {
 	const [command, setCommand] = useState("");
 	const [history, setHistory] = useState<TerminalCommand[]>([]);
@@ -64,7 +85,8 @@ export const TerminalDashboard = () => {
 					break;
 				case "partial":
 					if (message.command) {
-						setCurrentCommand(message.command);
+						const chunk = message.command;
+						setCurrentCommand(prev => appendChunk(prev, chunk));
 					}
 					break;
 				case "result":